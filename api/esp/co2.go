@@ -0,0 +1,33 @@
+package esp
+
+import (
+	"Solflora/logger"
+	"Solflora/metrics"
+	"Solflora/state"
+	"Solflora/util"
+)
+
+// controlCO2 switches the enrichment valve. Without a good CO2 reading the
+// valve is closed, so a broken sensor never keeps it open.
+func (s *ControlSamplingService) controlCO2(sample processedSample) {
+	var log = logger.Logger()
+
+	deviceStateMap := s.deviceState.GetAll()
+	valveOpen := deviceStateMap[state.CO2Control]
+
+	open, reason := false, "no valid co2 reading"
+	if pv, ok := sample.filtered[state.CO2PV]; ok {
+		sp := s.modelState.GetAll()[state.CO2SP]
+		metrics.LoopPresentValue.Set(pv, "co2")
+		metrics.LoopSetPoint.Set(sp, "co2")
+		open, reason = util.EvaluateCO2Enrichment(pv, sp, s.controlConfig.CO2Hysteresis, valveOpen,
+			deviceStateMap[state.LightControl], deviceStateMap[state.FanControl])
+	}
+
+	if open != valveOpen {
+		s.deviceState.Set(state.CO2Control, open)
+		metrics.SetActuatorState(string(state.CO2Control), open)
+		s.actuatorRecorder.Switch(sample.deviceID, state.CO2Control, open, state.ActuatorSourceAuto)
+		log.Infof("[INFO] api.esp.controlCO2 | switching co2 valve %s: %s", onOff(open), reason)
+	}
+}
@@ -0,0 +1,44 @@
+package esp
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"net/http"
+)
+
+type DeviceConfigResponseBody struct {
+	DeviceID string `json:"device_id"`
+	state.VersionedDeviceConfig
+}
+
+// DeviceConfig serves the full configuration document; the ESP fetches it
+// whenever config_version in the sampling response differs from its own.
+func DeviceConfig(service *ControlSamplingService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.esp.DeviceConfig")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.esp.DeviceConfig | method not allowed: %s", r.Method)
+			return
+		}
+
+		deviceID := r.URL.Query().Get("device_id")
+		if deviceID == "" {
+			deviceID = state.DefaultDeviceID
+		}
+		config, ok := service.deviceConfigState.Effective(deviceID)
+		if !ok {
+			http.Error(w, "Not Found – no config for device", http.StatusNotFound)
+			log.Errorf("[ERROR] api.esp.DeviceConfig | no config for device %s", deviceID)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DeviceConfigResponseBody{DeviceID: deviceID, VersionedDeviceConfig: config})
+
+		log.Info("[END] api.esp.DeviceConfig")
+	}
+}
@@ -0,0 +1,98 @@
+package esp
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/metrics"
+	"Solflora/state"
+	"Solflora/util"
+	"time"
+)
+
+// controlFan ramps the fan duty towards its target. The humidity loop decides
+// the target: off stops the fan, manual applies the loop output and auto
+// follows the fan settings. Split-range cooling demand raises the duty further.
+func (s *ControlSamplingService) controlFan(sample processedSample) {
+	var log = logger.Logger()
+
+	settings := s.fanState.GetSettings()
+	var target float64
+	source := state.ActuatorSourceManual
+	switch loop := s.loopState.Get(state.LoopHumidity); loop.Mode {
+	case state.LoopModeOff:
+		target = 0
+	case state.LoopModeManual:
+		target = loop.ManualOutput
+	default:
+		target = s.autoFanDuty(sample, settings)
+		if settings.Mode != state.FanModeManual {
+			source = state.ActuatorSourceAuto
+		}
+	}
+	if cooling := s.deviceState.GetAllAnalog()[state.CoolerDuty]; cooling > target {
+		target, source = cooling, state.ActuatorSourceAuto
+	}
+	target = util.LimitFanDuty(target, s.controlConfig.FanDutyMin, s.controlConfig.FanDutyMax)
+
+	ramped := s.fanState.Step(time.Now(), target, s.controlConfig.FanRampRate)
+	duty := util.LimitFanDuty(ramped, s.controlConfig.FanDutyMin, s.controlConfig.FanDutyMax)
+
+	s.deviceState.SetAnalog(state.FanDuty, duty)
+	metrics.ActuatorDuty.Set(duty, string(state.FanControl))
+	s.actuatorRecorder.Duty(sample.deviceID, state.FanDuty, duty, source)
+
+	on := duty > 0
+	if on != s.deviceState.GetAll()[state.FanControl] {
+		s.deviceState.Set(state.FanControl, on)
+		metrics.SetActuatorState(string(state.FanControl), on)
+		log.Infof("[INFO] api.esp.controlFan | switching fan %s (%s, duty %.0f%%)", onOff(on), settings.Mode, duty)
+		s.recordFanRun(sample.deviceID, on)
+	}
+}
+
+// recordFanRun stores a fan run once the fan stops, so the daily reports can
+// sum the fan runtime.
+func (s *ControlSamplingService) recordFanRun(deviceID string, on bool) {
+	var log = logger.Logger()
+
+	now := time.Now()
+	if on {
+		s.fanState.SwitchOn(deviceID, now)
+		return
+	}
+	runDeviceID, start, ok := s.fanState.SwitchOff()
+	if !ok {
+		return
+	}
+	runEntity := dao.FanRunEntity{DeviceID: runDeviceID, Start: start, Duration: now.Sub(start)}
+	if err := runEntity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.esp.recordFanRun | failed to commit fan run entity: %s", err.Error())
+	}
+}
+
+// autoFanDuty is the manual duty of the fan settings or, in their auto modes,
+// a duty proportional to the filtered temperature or humidity. The humidity
+// band of a running crop recipe replaces start and full value of the humidity
+// mode. Without a good reading the current duty is held.
+func (s *ControlSamplingService) autoFanDuty(sample processedSample, settings state.FanSettings) float64 {
+	variable, ok := settings.ControlVariable()
+	if !ok {
+		return settings.ManualDuty
+	}
+	pv, good := sample.filtered[variable]
+	if !good {
+		logger.Logger().Warnf("[WARN] api.esp.autoFanDuty | no good %s, holding fan duty", variable)
+		return s.fanState.Duty()
+	}
+	startValue, fullValue := settings.StartValue, settings.FullValue
+	if variable == state.HumidityPV {
+		modelStateMap := s.modelState.GetAll()
+		humidityMin, hasMin := modelStateMap[state.HumidityMin]
+		humidityMax, hasMax := modelStateMap[state.HumidityMax]
+		if hasMin && hasMax {
+			startValue, fullValue = humidityMin, humidityMax
+		}
+	}
+	return util.ProportionalFanDuty(pv, startValue, fullValue,
+		s.controlConfig.FanDutyMin, s.controlConfig.FanDutyMax)
+}
@@ -0,0 +1,79 @@
+package esp
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+	"net/http"
+	"os"
+	"time"
+)
+
+// reportFirmware updates the update progress of a device from the version it
+// reports running with each sample.
+func (s *ControlSamplingService) reportFirmware(deviceID string, version string, updateError string) {
+	var log = logger.Logger()
+
+	update, changed := s.firmwareState.Report(deviceID, version, updateError, time.Now())
+	if !changed {
+		return
+	}
+	log.Infof("[INFO] api.esp.reportFirmware | %s runs firmware [%s], target [%s]: %s %s",
+		deviceID, update.ReportedVersion, update.TargetVersion, update.Status, update.Message)
+	commitFirmwareUpdate(update)
+}
+
+func commitFirmwareUpdate(update state.FirmwareUpdate) {
+	var log = logger.Logger()
+
+	entity := dao.FirmwareUpdateEntity{Update: update}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.esp.commitFirmwareUpdate | failed to commit firmware update entity: %s", err.Error())
+	}
+}
+
+// FirmwareImage serves an uploaded image. Range requests let the ESP resume an
+// interrupted download; the SHA-256 in X-Checksum-SHA256 and the ETag lets it
+// verify the image before flashing.
+func FirmwareImage(service *ControlSamplingService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.esp.FirmwareImage")
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.esp.FirmwareImage | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		image, ok := service.firmwareState.Image(query.Get("version"))
+		if !ok {
+			http.Error(w, "Not Found – unknown firmware version", http.StatusNotFound)
+			log.Errorf("[ERROR] api.esp.FirmwareImage | unknown firmware version: %s", query.Get("version"))
+			return
+		}
+
+		file, err := os.Open(service.firmwareConfig.ImagePath(image.Version))
+		if err != nil {
+			http.Error(w, "Internal Server Error – firmware image not available", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.esp.FirmwareImage | failed to open image of firmware %s: %s", image.Version, err.Error())
+			return
+		}
+		defer file.Close()
+
+		if deviceID := query.Get("device_id"); deviceID != "" {
+			if update, changed := service.firmwareState.MarkDownloading(deviceID, image.Version, time.Now()); changed {
+				log.Infof("[INFO] api.esp.FirmwareImage | %s downloading firmware [%s]", deviceID, image.Version)
+				commitFirmwareUpdate(update)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("ETag", `"`+image.SHA256+`"`)
+		w.Header().Set("X-Checksum-SHA256", image.SHA256)
+		http.ServeContent(w, r, image.Version+".bin", image.UploadedAt, file)
+
+		log.Info("[END] api.esp.FirmwareImage")
+	}
+}
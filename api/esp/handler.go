@@ -2,16 +2,47 @@ package esp
 
 import (
 	"Solflora/logger"
+	"Solflora/state"
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 )
 
 type RequestBody struct {
-	TemperaturePV float64 `json:"temp_pv"`
-	TemperatureCO float64 `json:"temp_co"`
-	TemperatureSP float64 `json:"temp_sp"`
-	MoisturePV    float64 `json:"moist_pv"`
-	HumidityPV    float64 `json:"humidity_pv"`
+	DeviceID      string   `json:"device_id"`
+	TemperaturePV float64  `json:"temp_pv"`
+	TemperatureCO float64  `json:"temp_co"`
+	TemperatureSP float64  `json:"temp_sp"`
+	MoisturePV    float64  `json:"moist_pv"`
+	HumidityPV    float64  `json:"humidity_pv"`
+	LightPV       *float64 `json:"light_pv"`
+	CO2PV         *float64 `json:"co2_pv"`
+	TankLow       *bool    `json:"tank_low"`
+	FlowPulses    *int64   `json:"flow_pulses"`
+
+	Measurements map[string]float64 `json:"measurements"`
+	AppliedSeq   map[string]uint64  `json:"applied_seq"`
+
+	FirmwareVersion     string `json:"firmware_version"`
+	FirmwareUpdateError string `json:"firmware_update_error"`
+
+	missingFields map[state.ConditionVariable]bool
+}
+
+func (req RequestBody) deviceID() string {
+	if req.DeviceID == "" {
+		return state.DefaultDeviceID
+	}
+	return req.DeviceID
+}
+
+var requiredRequestFields = []state.ConditionVariable{
+	state.TemperaturePV,
+	state.TemperatureSP,
+	state.MoisturePV,
+	state.HumidityPV,
 }
 
 type ResponseBody struct {
@@ -20,7 +51,22 @@ type ResponseBody struct {
 	TemperatureKi    float64 `json:"temp_ki"`
 	TemperatureKd    float64 `json:"temp_kd"`
 	FanControl       int16   `json:"fan_control"`
+	FanDuty          float64 `json:"fan_duty"`
+	HeaterControl    int16   `json:"heater_control"`
+	HeaterDuty       float64 `json:"heater_duty"`
+	CoolerDuty       float64 `json:"cooler_duty"`
+	OutputCycle      float64 `json:"output_cycle_seconds"`
 	WaterPumpControl int16   `json:"water_pump_control"`
+	LightControl     int16   `json:"light_control"`
+	CO2SP            float64 `json:"co2_sp"`
+	CO2Control       int16   `json:"co2_control"`
+	ConfigVersion    int     `json:"config_version"`
+
+	FirmwareVersion string `json:"firmware_version,omitempty"`
+	FirmwareSHA256  string `json:"firmware_sha256,omitempty"`
+	FirmwareSize    int64  `json:"firmware_size,omitempty"`
+
+	CommandSeq map[string]uint64 `json:"command_seq"`
 }
 
 func ControlSampler(service *ControlSamplingService) func(http.ResponseWriter, *http.Request) {
@@ -34,10 +80,10 @@ func ControlSampler(service *ControlSamplingService) func(http.ResponseWriter, *
 			return
 		}
 
-		var reqBody RequestBody
-		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		reqBody, err := decodeRequestBody(r.Body)
+		if err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			log.Error("[ERROR] api.esp.ControlSampler | invalid request body")
+			log.Errorf("[ERROR] api.esp.ControlSampler | invalid request body: %s", err.Error())
 			return
 		}
 		log.Debugf("[DEBUG] api.esp.ControlSampler() | request body: %+v\n", reqBody)
@@ -56,3 +102,34 @@ func ControlSampler(service *ControlSamplingService) func(http.ResponseWriter, *
 	}
 
 }
+
+func decodeRequestBody(body io.Reader) (RequestBody, error) {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return RequestBody{}, err
+	}
+
+	var reqBody RequestBody
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&reqBody); err != nil {
+		return RequestBody{}, err
+	}
+
+	var present map[string]json.RawMessage
+	if err := json.Unmarshal(content, &present); err != nil {
+		return RequestBody{}, err
+	}
+
+	reqBody.missingFields = make(map[state.ConditionVariable]bool)
+	for _, field := range requiredRequestFields {
+		if raw, ok := present[string(field)]; !ok || string(raw) == "null" {
+			reqBody.missingFields[field] = true
+		}
+	}
+	if len(reqBody.missingFields) == len(requiredRequestFields) {
+		return RequestBody{}, fmt.Errorf("request body contains none of the required fields %v", requiredRequestFields)
+	}
+
+	return reqBody, nil
+}
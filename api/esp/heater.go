@@ -0,0 +1,46 @@
+package esp
+
+import (
+	"Solflora/logger"
+	"Solflora/metrics"
+	"Solflora/state"
+	"Solflora/util"
+	"time"
+)
+
+// controlTemperatureOutputs turns temp_co into actuator commands: a heater
+// duty plus its time-proportioned relay state and, with split-range cooling,
+// a cooling duty that controlFan applies to the fan.
+func (s *ControlSamplingService) controlTemperatureOutputs(deviceID string) {
+	var log = logger.Logger()
+
+	co := s.modelState.GetAll()[state.TemperatureCO]
+	coMin, coMax := s.tuneState.GetOutputLimits()
+	heating, cooling := util.SplitRange(co, coMin, coMax, s.controlConfig.HeaterDutyMax, s.controlConfig.CoolerDutyMax)
+	if !s.controlConfig.SplitRangeCooling {
+		cooling = 0
+	}
+
+	heaterOn := s.heaterOutput.Output(time.Now(), heating, s.controlConfig.OutputCyclePeriod)
+
+	s.deviceState.SetAnalog(state.HeaterDuty, heating)
+	s.deviceState.SetAnalog(state.CoolerDuty, cooling)
+	metrics.ActuatorDuty.Set(heating, string(state.HeaterControl))
+	metrics.ActuatorDuty.Set(cooling, string(state.CoolerDuty))
+
+	if heaterOn != s.deviceState.GetAll()[state.HeaterControl] {
+		s.deviceState.Set(state.HeaterControl, heaterOn)
+		metrics.SetActuatorState(string(state.HeaterControl), heaterOn)
+		s.actuatorRecorder.Switch(deviceID, state.HeaterControl, heaterOn, s.temperatureSource())
+		log.Debugf("[DEBUG] api.esp.controlTemperatureOutputs | heater relay %s (co %.1f, duty %.0f%%)", onOff(heaterOn), co, heating)
+	}
+}
+
+// temperatureSource is the cause recorded for heater transitions: the loop
+// output in auto mode, the operator otherwise.
+func (s *ControlSamplingService) temperatureSource() state.ActuatorSource {
+	if s.loopState.Get(state.LoopTemperature).Mode == state.LoopModeAuto {
+		return state.ActuatorSourceAuto
+	}
+	return state.ActuatorSourceManual
+}
@@ -0,0 +1,66 @@
+package esp
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/metrics"
+	"Solflora/state"
+	"Solflora/util"
+	"time"
+)
+
+// dliMaxSampleGap is the longest gap between two light readings that is still
+// integrated; longer outages are left out of the daily light integral.
+const dliMaxSampleGap = 5 * time.Minute
+
+// controlLights integrates the light reading into the daily light integral and
+// switches the grow lights according to the schedule. It returns the DLI
+// measurement to store, or nil when the sample has no good light reading.
+func (s *ControlSamplingService) controlLights(sample processedSample) *dao.MeasurementEntity {
+	var log = logger.Logger()
+
+	now := time.Now().In(s.controlConfig.ScheduleLocation())
+	lightsOn := s.deviceState.GetAll()[state.LightControl]
+
+	var dliEntity *dao.MeasurementEntity
+	naturalPPFD := 0.0
+	ppfd, hasLight := sample.filtered[state.LightPV]
+	if hasLight {
+		dli := s.lightState.Integrate(now, ppfd, dliMaxSampleGap)
+		s.modelState.Set(state.LightDLI, dli)
+		dliEntity = &dao.MeasurementEntity{
+			DeviceID:     sample.deviceID,
+			Variable:     state.LightDLI,
+			PresentValue: dli,
+			RawValue:     dli,
+			Quality:      state.QualityGood,
+		}
+
+		naturalPPFD = ppfd
+		if lightsOn {
+			naturalPPFD -= s.controlConfig.LightLampPPFD
+		}
+	}
+
+	schedule := s.lightState.GetSchedule()
+	if schedule.Mode == state.LightModeManual {
+		return dliEntity
+	}
+
+	dli, _, _ := s.lightState.GetDLI()
+	on, reason := util.EvaluateLights(now, schedule, dli, naturalPPFD)
+	if on != lightsOn {
+		s.deviceState.Set(state.LightControl, on)
+		metrics.SetActuatorState(string(state.LightControl), on)
+		s.actuatorRecorder.Switch(sample.deviceID, state.LightControl, on, state.ActuatorSourceSchedule)
+		log.Infof("[INFO] api.esp.controlLights | switching lights %s: %s", onOff(on), reason)
+	}
+	return dliEntity
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
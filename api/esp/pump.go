@@ -0,0 +1,88 @@
+package esp
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+	"fmt"
+	"time"
+)
+
+// flowPulseMaxLag is how long after a run has ended pulses are still counted
+// for it, since the ESP reports pulses only with its next sample.
+const flowPulseMaxLag = time.Minute
+
+// updateTankLevel stores the tank level switch of the device for the pump
+// interlocks and stops the device's running pump as soon as its tank reports
+// low.
+func (s *ControlSamplingService) updateTankLevel(deviceID string, tankLow bool) {
+	var log = logger.Logger()
+
+	wasLow := s.pumpState.TankLow(deviceID)
+	s.pumpState.SetTankLow(deviceID, tankLow)
+	if !tankLow || wasLow {
+		return
+	}
+
+	message := fmt.Sprintf("tank level sensor of device %s reports low water", deviceID)
+	if s.pumpController.StopDevice(deviceID, state.ActuatorSourceInterlock) {
+		message += ", running pump stopped"
+	}
+	log.Warnf("[WARN] api.esp.updateTankLevel | %s", message)
+
+	alarm := dao.AlarmEntity{Source: string(state.WaterPumpControl), Code: string(state.PumpTankLow), Message: message}
+	if err := alarm.Commit(); err != nil {
+		log.Errorf("[ERROR] api.esp.updateTankLevel | failed to commit alarm entity: %s", err.Error())
+	}
+}
+
+// countFlowPulses adds the flow-meter pulses the device counted since its
+// previous sample to the current run, if the run is the device's own, and
+// stops a volume dose once it is delivered.
+func (s *ControlSamplingService) countFlowPulses(deviceID string, pulses int64) {
+	var log = logger.Logger()
+
+	run, counted, reached := s.pumpState.AddPulses(deviceID, time.Now(), pulses, flowPulseMaxLag)
+	if !counted {
+		return
+	}
+	log.Debugf("[DEBUG] api.esp.countFlowPulses | %d pulses, %.0f of %.0f ml delivered", pulses, run.DeliveredML, run.RequestedML)
+
+	if reached && s.pumpController.StopDevice(deviceID, state.ActuatorSourceAuto) {
+		log.Infof("[INFO] api.esp.countFlowPulses | dose of %.0f ml delivered, pump stopped", run.RequestedML)
+		return
+	}
+
+	runEntity := dao.PumpRunEntity{Run: run}
+	if err := runEntity.Update(); err != nil {
+		log.Errorf("[ERROR] api.esp.countFlowPulses | failed to update pump run entity: %s", err.Error())
+	}
+}
+
+// controlMoisture waters automatically while the moisture loop is in auto
+// mode and the filtered moisture is below the threshold, moist_sp_min of a
+// running crop recipe or the configured one. The interlocks, in particular
+// the minimum off-time, pace the runs.
+func (s *ControlSamplingService) controlMoisture(sample processedSample) {
+	var log = logger.Logger()
+
+	if s.loopState.Get(state.LoopMoisture).Mode != state.LoopModeAuto {
+		return
+	}
+	threshold, ok := s.modelState.GetAll()[state.MoistureMin]
+	if !ok {
+		threshold = s.controlConfig.MoistureAutoThreshold
+	}
+	moisture, ok := sample.filtered[state.MoisturePV]
+	if !ok || moisture >= threshold {
+		return
+	}
+
+	run := state.PumpRun{DeviceID: sample.deviceID, Start: time.Now(), Duration: s.controlConfig.WaterPumpOnStateDuration}
+	if err := s.pumpController.StartAuto(run); err != nil {
+		log.Debugf("[DEBUG] api.esp.controlMoisture | automatic watering refused: %s", err.Error())
+		return
+	}
+	log.Infof("[INFO] api.esp.controlMoisture | moisture %.1f%% below %.1f%%, watering for %s",
+		moisture, threshold, run.Duration)
+}
@@ -0,0 +1,95 @@
+package esp
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"Solflora/util"
+)
+
+// processedSample carries one ESP request through calibration, validation and
+// filtering: raw as received, value calibrated, filtered only for good values.
+// The set-point is not a measurement and only takes part in validation.
+type processedSample struct {
+	deviceID string
+	setPoint float64
+	missing  map[state.ConditionVariable]bool
+	raw      map[state.ConditionVariable]float64
+	value    map[state.ConditionVariable]float64
+	quality  map[state.ConditionVariable]state.SampleQuality
+	filtered map[state.ConditionVariable]float64
+}
+
+var legacyPresentValues = []state.ConditionVariable{
+	state.TemperaturePV,
+	state.HumidityPV,
+	state.MoisturePV,
+}
+
+func newProcessedSample(req RequestBody) processedSample {
+	var log = logger.Logger()
+
+	sample := processedSample{
+		deviceID: req.deviceID(),
+		setPoint: req.TemperatureSP,
+		missing:  req.missingFields,
+		raw: map[state.ConditionVariable]float64{
+			state.TemperaturePV: req.TemperaturePV,
+			state.HumidityPV:    req.HumidityPV,
+			state.MoisturePV:    req.MoisturePV,
+		},
+	}
+	if req.LightPV != nil {
+		sample.raw[state.LightPV] = *req.LightPV
+	}
+	if req.CO2PV != nil {
+		sample.raw[state.CO2PV] = *req.CO2PV
+	}
+	for name, value := range req.Measurements {
+		variable := state.ConditionVariable(name)
+		if _, exists := sample.raw[variable]; exists {
+			log.Warnf("[WARN] api.esp.newProcessedSample | measurement %s duplicates a top-level field, ignoring it", name)
+			continue
+		}
+		sample.raw[variable] = value
+	}
+	return sample
+}
+
+func (p processedSample) filteredValue(variable state.ConditionVariable) *float64 {
+	if value, ok := p.filtered[variable]; ok {
+		return &value
+	}
+	return nil
+}
+
+// applyCalibration converts the raw readings of the device's sensors into
+// engineering units before validation, control and storage.
+func (s *ControlSamplingService) applyCalibration(sample *processedSample) {
+	var log = logger.Logger()
+
+	sample.value = make(map[state.ConditionVariable]float64, len(sample.raw))
+	for variable, raw := range sample.raw {
+		if sample.missing[variable] {
+			sample.value[variable] = raw
+			continue
+		}
+		sample.value[variable] = s.calibrationState.Apply(sample.deviceID, variable, raw)
+	}
+	if lux, ok := sample.value[state.LightPV]; ok && !sample.missing[state.LightPV] && s.controlConfig.LightSensorUnit == "lux" {
+		sample.value[state.LightPV] = util.LuxToPPFD(lux, s.controlConfig.LightLuxToPPFD)
+	}
+
+	log.Debugf("[DEBUG] api.esp.applyCalibration | device %s: raw %v -> calibrated %v", sample.deviceID, sample.raw, sample.value)
+}
+
+// applyFilters feeds the good values of a sample through the configured
+// filters; control runs on the filtered values.
+func (s *ControlSamplingService) applyFilters(sample *processedSample) {
+	sample.filtered = make(map[state.ConditionVariable]float64, len(sample.value))
+	for variable, value := range sample.value {
+		if !sample.quality[variable].IsGood() {
+			continue
+		}
+		sample.filtered[variable] = s.filterState.Apply(sample.deviceID, variable, value)
+	}
+}
@@ -1,38 +1,117 @@
 package esp
 
 import (
+	"Solflora/config"
 	"Solflora/dao"
 	"Solflora/logger"
+	"Solflora/metrics"
 	"Solflora/state"
 	"Solflora/util"
+	"time"
 )
 
 type ControlSamplingService struct {
-	modelState    *state.ModelState
-	deviceState   *state.DeviceState
-	tuneState     *state.TuneState
-	integralState *state.TrackingIntegralState
+	modelState        *state.ModelState
+	deviceState       *state.DeviceState
+	tuneState         *state.TuneState
+	integralState     *state.TrackingIntegralState
+	sampleHistory     *state.SampleHistory
+	calibrationState  *state.CalibrationState
+	filterState       *state.FilterState
+	variableRegistry  *state.VariableRegistry
+	lightState        *state.LightState
+	pumpState         *state.PumpState
+	fanState          *state.FanState
+	heaterOutput      *state.TimeProportioningState
+	loopState         *state.LoopState
+	pumpController    *util.PumpController
+	actuatorRecorder  *util.ActuatorRecorder
+	commandState      *state.CommandState
+	deviceConfigState *state.DeviceConfigState
+	firmwareState     *state.FirmwareState
+
+	controlConfig  config.ControlConfig
+	firmwareConfig config.FirmwareConfig
 }
 
 func NewControlSamplingService(
 	modelState *state.ModelState,
 	deviceState *state.DeviceState,
 	tuneState *state.TuneState,
-	integralState *state.TrackingIntegralState) *ControlSamplingService {
+	integralState *state.TrackingIntegralState,
+	sampleHistory *state.SampleHistory,
+	calibrationState *state.CalibrationState,
+	filterState *state.FilterState,
+	variableRegistry *state.VariableRegistry,
+	lightState *state.LightState,
+	pumpState *state.PumpState,
+	fanState *state.FanState,
+	heaterOutput *state.TimeProportioningState,
+	loopState *state.LoopState,
+	pumpController *util.PumpController,
+	actuatorRecorder *util.ActuatorRecorder,
+	commandState *state.CommandState,
+	deviceConfigState *state.DeviceConfigState,
+	firmwareState *state.FirmwareState,
+	controlConfig config.ControlConfig,
+	firmwareConfig config.FirmwareConfig) *ControlSamplingService {
 	return &ControlSamplingService{
-		modelState:    modelState,
-		deviceState:   deviceState,
-		tuneState:     tuneState,
-		integralState: integralState}
+		modelState:        modelState,
+		deviceState:       deviceState,
+		tuneState:         tuneState,
+		integralState:     integralState,
+		sampleHistory:     sampleHistory,
+		calibrationState:  calibrationState,
+		filterState:       filterState,
+		variableRegistry:  variableRegistry,
+		lightState:        lightState,
+		pumpState:         pumpState,
+		fanState:          fanState,
+		heaterOutput:      heaterOutput,
+		loopState:         loopState,
+		pumpController:    pumpController,
+		actuatorRecorder:  actuatorRecorder,
+		commandState:      commandState,
+		deviceConfigState: deviceConfigState,
+		firmwareState:     firmwareState,
+		controlConfig:     controlConfig,
+		firmwareConfig:    firmwareConfig}
 }
 
 func (s *ControlSamplingService) HandleControlSampling(req RequestBody) (ResponseBody, error) {
 	var log = logger.Logger()
 	log.Infof("[START] api.esp.HandleControlSampling")
 
-	var newTemperatureEntity = buildTemperatureEntity(req, s.integralState, s.tuneState)
-	var newHumidityEntity = buildHumidityEntity(req)
-	var newMoistureEntity = buildMoistureEntity(req)
+	start := time.Now()
+	defer func() { metrics.ControlSamplingDuration.Observe(time.Since(start).Seconds()) }()
+	metrics.EspSamplesTotal.Inc()
+
+	sample := newProcessedSample(req)
+	s.commandState.Acknowledge(sample.deviceID, req.AppliedSeq, start)
+	s.applyCalibration(&sample)
+	validateSample(&sample, s.sampleHistory, s.variableRegistry, s.controlConfig)
+	s.applyFilters(&sample)
+
+	var newTemperatureEntity = s.buildTemperatureEntity(sample)
+	var newHumidityEntity = s.buildHumidityEntity(sample)
+	var newMoistureEntity = s.buildMoistureEntity(sample)
+	var newMeasurementEntities = s.buildMeasurementEntities(sample)
+	if dliEntity := s.controlLights(sample); dliEntity != nil {
+		newMeasurementEntities = append(newMeasurementEntities, dliEntity)
+	}
+	s.controlTemperatureOutputs(sample.deviceID)
+	s.controlFan(sample)
+	s.controlCO2(sample)
+	if req.TankLow != nil {
+		s.updateTankLevel(sample.deviceID, *req.TankLow)
+	}
+	if req.FlowPulses != nil {
+		s.countFlowPulses(sample.deviceID, *req.FlowPulses)
+	}
+	s.controlMoisture(sample)
+	if req.FirmwareVersion != "" {
+		s.reportFirmware(sample.deviceID, req.FirmwareVersion, req.FirmwareUpdateError)
+	}
 
 	err := newTemperatureEntity.Commit()
 	if err != nil {
@@ -55,16 +134,50 @@ func (s *ControlSamplingService) HandleControlSampling(req RequestBody) (Respons
 	}
 	log.Debugf("[DEBUG] api.esp.HandleControlSampling | generated moisture entity: %+v\n", newMoistureEntity)
 
-	modelStateMap := s.modelState.GetAll()
-	deviceStateMap := s.deviceState.GetAll()
-	tuneStateMap := s.tuneState.GetAll()
+	for _, measurementEntity := range newMeasurementEntities {
+		err = measurementEntity.Commit()
+		if err != nil {
+			log.Errorf("[ERROR] api.esp.HandlerControlSampling() | measurement-entity %s cannot be committed | %s\n",
+				measurementEntity.Variable, err.Error())
+			return ResponseBody{}, err
+		}
+		log.Debugf("[DEBUG] api.esp.HandleControlSampling | generated measurement entity: %+v\n", measurementEntity)
+	}
+
+	observeLoopMetrics(newTemperatureEntity, newHumidityEntity, newMoistureEntity)
+	// only registered variables become label values, unknown names sent by
+	// the ESP would add a new series each
+	for variable, value := range sample.filtered {
+		if _, ok := s.variableRegistry.Get(variable); ok {
+			metrics.MeasurementValue.Set(value, sample.deviceID, string(variable))
+		}
+	}
+
+	// the response and the delivered commands come from one snapshot, so the
+	// sequence numbers acknowledge exactly the values sent
+	desired := state.DesiredCommands(sample.deviceID, s.deviceState, s.modelState, s.tuneState, s.pumpState)
+	deviceConfig, _ := s.deviceConfigState.Effective(sample.deviceID)
+	firmware, _ := s.firmwareState.Target(sample.deviceID)
 	responseBody := ResponseBody{
-		TemperatureSP:    modelStateMap[state.TemperatureSP],
-		TemperatureKp:    tuneStateMap[state.TemperatureKp],
-		TemperatureKi:    tuneStateMap[state.TemperatureKi],
-		TemperatureKd:    tuneStateMap[state.TemperatureKd],
-		FanControl:       boolToInt16(deviceStateMap[state.FanControl]),
-		WaterPumpControl: boolToInt16(deviceStateMap[state.WaterPumpControl]),
+		TemperatureSP:    desired["temp_sp"],
+		TemperatureKp:    desired["temp_kp"],
+		TemperatureKi:    desired["temp_ki"],
+		TemperatureKd:    desired["temp_kd"],
+		FanControl:       int16(desired["fan_control"]),
+		FanDuty:          desired["fan_duty"],
+		HeaterControl:    int16(desired["heater_control"]),
+		HeaterDuty:       desired["heater_duty"],
+		CoolerDuty:       desired["cooler_duty"],
+		OutputCycle:      s.controlConfig.OutputCyclePeriod.Seconds(),
+		WaterPumpControl: int16(desired["water_pump_control"]),
+		LightControl:     int16(desired["light_control"]),
+		CO2SP:            desired["co2_sp"],
+		CO2Control:       int16(desired["co2_control"]),
+		ConfigVersion:    deviceConfig.Version,
+		FirmwareVersion:  firmware.Version,
+		FirmwareSHA256:   firmware.SHA256,
+		FirmwareSize:     firmware.Size,
+		CommandSeq:       s.commandState.Deliver(sample.deviceID, desired, time.Now()),
 	}
 
 	log.Debugf("[DEBUG] api.esp.HandleControlSampling | generated response to esp: %+v", responseBody)
@@ -72,30 +185,112 @@ func (s *ControlSamplingService) HandleControlSampling(req RequestBody) (Respons
 	return responseBody, nil
 }
 
-func buildTemperatureEntity(req RequestBody, integralState *state.TrackingIntegralState, tuneState *state.TuneState) *dao.TemperatureEntity {
-
-	return &dao.TemperatureEntity{
-		PresentValue:     req.TemperaturePV,
-		ControllerOutput: util.CalculateCO(req.TemperatureSP, req.TemperaturePV, integralState, tuneState),
-		SetPoint:         req.TemperatureSP,
+// buildTemperatureEntity runs the controller for good samples in auto mode; a
+// rejected sample is stored for diagnostics with the last controller output
+// held. In manual mode the operator's output is applied and in off mode zero,
+// while the tracking error keeps following the process for a bumpless return.
+func (s *ControlSamplingService) buildTemperatureEntity(sample processedSample) *dao.TemperatureEntity {
+	quality := worstQuality(sample.quality[state.TemperaturePV], sample.quality[state.TemperatureSP])
+	entity := &dao.TemperatureEntity{
+		DeviceID:         sample.deviceID,
+		PresentValue:     sample.value[state.TemperaturePV],
+		RawValue:         sample.raw[state.TemperaturePV],
+		FilteredValue:    sample.filteredValue(state.TemperaturePV),
+		ControllerOutput: s.modelState.GetAll()[state.TemperatureCO],
+		SetPoint:         sample.setPoint,
+		Quality:          quality,
 	}
+	loop := s.loopState.Get(state.LoopTemperature)
+	if loop.Mode != state.LoopModeAuto {
+		controllerOutput := 0.0
+		if loop.Mode == state.LoopModeManual {
+			outputMin, outputMax := s.tuneState.GetOutputLimits()
+			controllerOutput = util.Clamp(loop.ManualOutput, outputMin, outputMax)
+		}
+		if quality.IsGood() {
+			pv := sample.filtered[state.TemperaturePV]
+			s.modelState.Set(state.TemperaturePV, pv)
+			s.integralState.SetTrackingErrorValue(sample.setPoint - pv)
+		}
+		s.modelState.Set(state.TemperatureCO, controllerOutput)
+		entity.ControllerOutput = controllerOutput
+		return entity
+	}
+	if !quality.IsGood() {
+		return entity
+	}
+
+	pv := sample.filtered[state.TemperaturePV]
+	outputMin, outputMax := s.tuneState.GetOutputLimits()
+	controllerOutput := util.CalculateCO(sample.setPoint, pv, outputMin, outputMax, s.integralState, s.tuneState)
+	s.modelState.Set(state.TemperaturePV, pv)
+	s.modelState.Set(state.TemperatureCO, controllerOutput)
+
+	entity.ControllerOutput = controllerOutput
+	return entity
 }
 
-func buildHumidityEntity(req RequestBody) *dao.HumidityEntity {
+func (s *ControlSamplingService) buildHumidityEntity(sample processedSample) *dao.HumidityEntity {
+	if pv, ok := sample.filtered[state.HumidityPV]; ok {
+		s.modelState.Set(state.HumidityPV, pv)
+	}
 	return &dao.HumidityEntity{
-		PresentValue: req.HumidityPV,
+		DeviceID:      sample.deviceID,
+		PresentValue:  sample.value[state.HumidityPV],
+		RawValue:      sample.raw[state.HumidityPV],
+		FilteredValue: sample.filteredValue(state.HumidityPV),
+		Quality:       sample.quality[state.HumidityPV],
 	}
 }
 
-func buildMoistureEntity(req RequestBody) *dao.MoistureEntity {
+func (s *ControlSamplingService) buildMoistureEntity(sample processedSample) *dao.MoistureEntity {
+	if pv, ok := sample.filtered[state.MoisturePV]; ok {
+		s.modelState.Set(state.MoisturePV, pv)
+	}
 	return &dao.MoistureEntity{
-		PresentValue: req.MoisturePV,
+		DeviceID:      sample.deviceID,
+		PresentValue:  sample.value[state.MoisturePV],
+		RawValue:      sample.raw[state.MoisturePV],
+		FilteredValue: sample.filteredValue(state.MoisturePV),
+		Quality:       sample.quality[state.MoisturePV],
 	}
 }
 
-func boolToInt16(b bool) int16 {
-	if b {
-		return 1
+// buildMeasurementEntities stores every registered variable that has no legacy
+// table in the generic measurement table; unknown variables are dropped.
+func (s *ControlSamplingService) buildMeasurementEntities(sample processedSample) []*dao.MeasurementEntity {
+	var entities []*dao.MeasurementEntity
+	for variable, value := range sample.value {
+		definition, ok := s.variableRegistry.Get(variable)
+		if !ok || definition.StorageTable() != state.MeasurementTable {
+			continue
+		}
+
+		if pv, ok := sample.filtered[variable]; ok {
+			s.modelState.Set(variable, pv)
+		}
+		entities = append(entities, &dao.MeasurementEntity{
+			DeviceID:      sample.deviceID,
+			Variable:      variable,
+			PresentValue:  value,
+			RawValue:      sample.raw[variable],
+			FilteredValue: sample.filteredValue(variable),
+			Quality:       sample.quality[variable],
+		})
+	}
+	return entities
+}
+
+func observeLoopMetrics(temp *dao.TemperatureEntity, hum *dao.HumidityEntity, moist *dao.MoistureEntity) {
+	if temp.Quality.IsGood() {
+		metrics.LoopPresentValue.Set(temp.PresentValue, "temperature")
+		metrics.LoopSetPoint.Set(temp.SetPoint, "temperature")
+		metrics.LoopControllerOutput.Set(temp.ControllerOutput, "temperature")
+	}
+	if hum.Quality.IsGood() {
+		metrics.LoopPresentValue.Set(hum.PresentValue, "humidity")
+	}
+	if moist.Quality.IsGood() {
+		metrics.LoopPresentValue.Set(moist.PresentValue, "moisture")
 	}
-	return 0
 }
@@ -0,0 +1,91 @@
+package esp
+
+import (
+	"Solflora/config"
+	"Solflora/logger"
+	"Solflora/metrics"
+	"Solflora/state"
+	"math"
+)
+
+type sampleBounds struct {
+	min     float64
+	max     float64
+	maxStep float64
+}
+
+// validateSample assigns a quality flag to every value of the sample using
+// the ranges of the variable registry. Only good values are added to the spike
+// history, so a rejected reading never becomes the reference for the next one.
+func validateSample(
+	sample *processedSample,
+	history *state.SampleHistory,
+	registry *state.VariableRegistry,
+	controlConfig config.ControlConfig) {
+
+	var log = logger.Logger()
+	sample.quality = make(map[state.ConditionVariable]state.SampleQuality, len(sample.value)+1)
+
+	for variable, value := range sample.value {
+		definition, ok := registry.Get(variable)
+		if !ok {
+			sample.quality[variable] = state.QualityUnknown
+			continue
+		}
+
+		bounds := sampleBounds{min: definition.Min, max: definition.Max, maxStep: definition.MaxStep}
+		sample.quality[variable] = checkValue(sample.deviceID, variable, value, sample.missing[variable], bounds, history)
+		if sample.quality[variable].IsGood() {
+			history.Accept(sample.deviceID, variable, value)
+		}
+	}
+
+	spBounds := sampleBounds{min: controlConfig.TemperatureSPMin, max: controlConfig.TemperatureSPMax}
+	sample.quality[state.TemperatureSP] = checkValue(sample.deviceID, state.TemperatureSP, sample.setPoint,
+		sample.missing[state.TemperatureSP], spBounds, nil)
+
+	for variable, q := range sample.quality {
+		if !q.IsGood() {
+			metrics.EspSamplesRejectedTotal.Inc(string(variable), string(q))
+			log.Warnf("[WARN] api.esp.validateSample | %s from %s rejected: %s", variable, sample.deviceID, q)
+		}
+	}
+}
+
+func checkValue(
+	deviceID string,
+	variable state.ConditionVariable,
+	value float64,
+	missing bool,
+	bounds sampleBounds,
+	history *state.SampleHistory) state.SampleQuality {
+
+	switch {
+	case missing:
+		return state.QualityMissing
+	case math.IsNaN(value) || math.IsInf(value, 0):
+		return state.QualityInvalid
+	case value < bounds.min || value > bounds.max:
+		return state.QualityOutOfRange
+	}
+
+	if history == nil || bounds.maxStep <= 0 {
+		return state.QualityGood
+	}
+	if median, ok := history.Median(deviceID, variable); ok && math.Abs(value-median) > bounds.maxStep {
+		if history.RecordSpike(deviceID, variable) {
+			logger.Logger().Warnf("[WARN] api.esp.checkValue | %s history reset after repeated spikes, accepting new level", variable)
+		}
+		return state.QualitySpike
+	}
+	return state.QualityGood
+}
+
+func worstQuality(qualities ...state.SampleQuality) state.SampleQuality {
+	for _, q := range qualities {
+		if !q.IsGood() {
+			return q
+		}
+	}
+	return state.QualityGood
+}
@@ -0,0 +1,120 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// recordedActuators are the actuators whose transitions are stored; the value
+// of fan_duty is the duty in %, of the others 1 (on) or 0 (off).
+var recordedActuators = map[state.DeviceControlVariable]bool{
+	state.WaterPumpControl: true,
+	state.FanDuty:          true,
+	state.LightControl:     true,
+	state.CO2Control:       true,
+	state.HeaterControl:    true,
+}
+
+// seriesActuators is the actuator whose history is overlaid on the series
+// chart of a variable.
+var seriesActuators = map[state.ConditionVariable]state.DeviceControlVariable{
+	state.MoisturePV: state.WaterPumpControl,
+	state.HumidityPV: state.FanDuty,
+}
+
+// ActuatorHistoryEntry is one actuator transition. End and DurationSeconds are
+// left out while the value is still in effect.
+type ActuatorHistoryEntry struct {
+	Actuator        state.DeviceControlVariable `json:"actuator"`
+	DeviceID        string                      `json:"device_id"`
+	Value           float64                     `json:"value"`
+	On              bool                        `json:"on"`
+	Source          state.ActuatorSource        `json:"source"`
+	Timestamp       string                      `json:"time"`
+	TimestampMs     int64                       `json:"time_ms"`
+	EndTimestamp    string                      `json:"end,omitempty"`
+	EndTimestampMs  int64                       `json:"end_ms,omitempty"`
+	DurationSeconds *float64                    `json:"duration_seconds,omitempty"`
+
+	start time.Time
+}
+
+type ActuatorHistoryResponseBody struct {
+	Actuator state.DeviceControlVariable `json:"actuator,omitempty"`
+	Entries  []ActuatorHistoryEntry      `json:"entries"`
+}
+
+func ReturnActuatorHistory(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnActuatorHistory")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnActuatorHistory | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		actuator, err := mapQueryParamToActuator(query.Get("actuator"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnActuatorHistory | query parameter are not valid | error: %s", err)
+			return
+		}
+		tr, err := mapQueryParamsToTimeRange(query)
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnActuatorHistory | query parameter are not valid | error: %s", err)
+			return
+		}
+		location, err := mapQueryParamToLocation(query.Get("tz"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnActuatorHistory | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		entries, err := service.ReturnActuatorHistory(actuator, query.Get("device_id"), tr)
+		if err != nil {
+			http.Error(w, "Internal Server Error – ReturnActuatorHistory failed", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.ReturnActuatorHistory | ReturnActuatorHistory failed | err: %s", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ActuatorHistoryResponseBody{
+			Actuator: actuator,
+			Entries:  mapTimeStampToSpecifiedFormatForActuatorHistory(entries, location),
+		})
+
+		log.Info("[END] api.web.ReturnActuatorHistory")
+	}
+}
+
+// mapQueryParamToActuator accepts an empty value, which selects every
+// recorded actuator.
+func mapQueryParamToActuator(actuatorS string) (state.DeviceControlVariable, error) {
+	actuator := state.DeviceControlVariable(actuatorS)
+	if actuator != "" && !recordedActuators[actuator] {
+		return "", fmt.Errorf("actuator %q has no recorded history", actuatorS)
+	}
+	return actuator, nil
+}
+
+func mapTimeStampToSpecifiedFormatForActuatorHistory(entries []ActuatorHistoryEntry, location *time.Location) []ActuatorHistoryEntry {
+	for i := 0; i < len(entries); i++ {
+		start := entries[i].start.In(location)
+		entries[i].Timestamp, entries[i].TimestampMs = start.Format(time.RFC3339), start.UnixMilli()
+		if entries[i].DurationSeconds != nil {
+			end := start.Add(time.Duration(*entries[i].DurationSeconds * float64(time.Second)))
+			entries[i].EndTimestamp, entries[i].EndTimestampMs = end.Format(time.RFC3339), end.UnixMilli()
+		}
+	}
+
+	return entries
+}
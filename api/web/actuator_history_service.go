@@ -0,0 +1,54 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+	"time"
+)
+
+// CloseActuatorHistory ends the transitions left open by the previous run,
+// since every actuator starts switched off.
+func (s *ControlHandlerService) CloseActuatorHistory() error {
+	var log = logger.Logger()
+
+	closed, err := dao.CloseOpenActuatorEvents(time.Now())
+	if err != nil {
+		log.Errorf("[ERROR] api.web.CloseActuatorHistory | failed to close actuator events: %s", err.Error())
+		return err
+	}
+	log.Infof("[INFO] api.web.CloseActuatorHistory | %d open actuator events closed", closed)
+	return nil
+}
+
+// ReturnActuatorHistory lists the transitions of one actuator, or of all when
+// actuator is empty, that were in effect during the range.
+func (s *ControlHandlerService) ReturnActuatorHistory(actuator state.DeviceControlVariable, deviceID string, tr timeRange) ([]ActuatorHistoryEntry, error) {
+	var log = logger.Logger()
+
+	entities, err := dao.LoadActuatorEvents(deviceID, actuator, tr.From, tr.To)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.ReturnActuatorHistory | failed to load actuator events: %s", err.Error())
+		return nil, err
+	}
+
+	entries := make([]ActuatorHistoryEntry, 0, len(entities))
+	for _, entity := range entities {
+		entry := ActuatorHistoryEntry{
+			Actuator: entity.Transition.Actuator,
+			DeviceID: entity.Transition.DeviceID,
+			Value:    entity.Transition.Value,
+			On:       entity.Transition.Value > 0,
+			Source:   entity.Transition.Source,
+			start:    entity.Transition.Time,
+		}
+		if entity.Duration != nil {
+			seconds := entity.Duration.Seconds()
+			entry.DurationSeconds = &seconds
+		}
+		entries = append(entries, entry)
+	}
+	log.Debugf("[DEBUG] api.web.ReturnActuatorHistory | %d transitions of [%s] between %s and %s",
+		len(entries), actuator, tr.From, tr.To)
+	return entries, nil
+}
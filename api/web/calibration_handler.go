@@ -0,0 +1,200 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type SensorCalibrationRequestBody struct {
+	DeviceID string                   `json:"device_id"`
+	Variable state.ConditionVariable  `json:"variable"`
+	Offset   float64                  `json:"offset"`
+	Gain     *float64                 `json:"gain"`
+	Points   []state.CalibrationPoint `json:"points"`
+}
+
+type SensorCalibrationResponseBody struct {
+	DeviceID string                   `json:"device_id"`
+	Variable state.ConditionVariable  `json:"variable"`
+	Offset   float64                  `json:"offset"`
+	Gain     float64                  `json:"gain"`
+	Points   []state.CalibrationPoint `json:"points"`
+	LastRaw  *float64                 `json:"last_raw_value,omitempty"`
+}
+
+type CalibrationPointRequestBody struct {
+	DeviceID       string                  `json:"device_id"`
+	Variable       state.ConditionVariable `json:"variable"`
+	Label          string                  `json:"label"`
+	RawValue       *float64                `json:"raw_value"`
+	ReferenceValue float64                 `json:"reference_value"`
+}
+
+func ReturnSensorCalibration(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnSensorCalibration")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnSensorCalibration | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		deviceID, variable, err := mapCalibrationTarget(service, query.Get("device_id"), query.Get("variable"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnSensorCalibration | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		respBody := service.ReturnSensorCalibration(deviceID, variable)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.ReturnSensorCalibration")
+	}
+}
+
+func SetSensorCalibration(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.SetSensorCalibration")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.SetSensorCalibration | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody SensorCalibrationRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetSensorCalibration | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.SetSensorCalibration | request body: %+v\n", reqBody)
+
+		deviceID, variable, err := mapCalibrationTarget(service, reqBody.DeviceID, string(reqBody.Variable))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetSensorCalibration | calibration target not valid | error: %s", err)
+			return
+		}
+
+		calibration := state.Calibration{Offset: reqBody.Offset, Gain: 1, Points: reqBody.Points}
+		if reqBody.Gain != nil {
+			calibration.Gain = *reqBody.Gain
+		}
+
+		respBody, err := service.SetSensorCalibration(deviceID, variable, calibration)
+		if errors.Is(err, errCalibrationInvalid) {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetSensorCalibration | calibration not valid | error: %s", err)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error – failed to commit sensor calibration", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.SetSensorCalibration | failed to commit sensor calibration: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.SetSensorCalibration")
+	}
+}
+
+func ResetSensorCalibration(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ResetSensorCalibration")
+
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ResetSensorCalibration | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		deviceID, variable, err := mapCalibrationTarget(service, query.Get("device_id"), query.Get("variable"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ResetSensorCalibration | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		if err := service.ResetSensorCalibration(deviceID, variable); err != nil {
+			http.Error(w, "Internal Server Error – failed to reset sensor calibration", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.ResetSensorCalibration | failed to reset sensor calibration: %s", err.Error())
+			return
+		}
+
+		log.Info("[END] api.web.ResetSensorCalibration")
+	}
+}
+
+func RecordCalibrationPoint(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.RecordCalibrationPoint")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.RecordCalibrationPoint | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody CalibrationPointRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.RecordCalibrationPoint | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.RecordCalibrationPoint | request body: %+v\n", reqBody)
+
+		deviceID, variable, err := mapCalibrationTarget(service, reqBody.DeviceID, string(reqBody.Variable))
+		if err == nil && reqBody.Label == "" {
+			err = fmt.Errorf("label is required (e.g. dry, wet)")
+		}
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.RecordCalibrationPoint | calibration point not valid | error: %s", err)
+			return
+		}
+
+		respBody, err := service.RecordCalibrationPoint(deviceID, variable, reqBody.Label, reqBody.RawValue, reqBody.ReferenceValue)
+		if errors.Is(err, errCalibrationManual) {
+			http.Error(w, "Conflict – "+err.Error(), http.StatusConflict)
+			log.Errorf("[ERROR] api.web.RecordCalibrationPoint | %s", err)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Unprocessable Entity – "+err.Error(), http.StatusUnprocessableEntity)
+			log.Errorf("[ERROR] api.web.RecordCalibrationPoint | failed to record calibration point: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.RecordCalibrationPoint")
+	}
+}
+
+func mapCalibrationTarget(service *ControlHandlerService, deviceID string, variable string) (string, state.ConditionVariable, error) {
+	if deviceID == "" {
+		deviceID = state.DefaultDeviceID
+	}
+	if _, ok := service.variableRegistry.Get(state.ConditionVariable(variable)); !ok {
+		return "", "", fmt.Errorf("variable [%s] cannot be calibrated", variable)
+	}
+	return deviceID, state.ConditionVariable(variable), nil
+}
@@ -0,0 +1,140 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+	"errors"
+	"fmt"
+)
+
+var (
+	errCalibrationInvalid = errors.New("sensor calibration not valid")
+	errCalibrationManual  = errors.New("manual sensor calibration active")
+)
+
+func (s *ControlHandlerService) LoadSensorCalibrations() error {
+	var log = logger.Logger()
+
+	entities, err := dao.LoadSensorCalibrations()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadSensorCalibrations | failed to load sensor calibrations: %s", err.Error())
+		return err
+	}
+
+	for _, entity := range entities {
+		s.calibrationState.Set(entity.DeviceID, entity.Variable, entity.Calibration)
+	}
+	log.Infof("[INFO] api.web.LoadSensorCalibrations | %d sensor calibrations restored", len(entities))
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnSensorCalibration(deviceID string, variable state.ConditionVariable) SensorCalibrationResponseBody {
+	calibration := s.calibrationState.Get(deviceID, variable)
+	respBody := SensorCalibrationResponseBody{
+		DeviceID: deviceID,
+		Variable: variable,
+		Offset:   calibration.Offset,
+		Gain:     calibration.Gain,
+		Points:   calibration.Points,
+	}
+	if raw, ok := s.calibrationState.LastRaw(deviceID, variable); ok {
+		respBody.LastRaw = &raw
+	}
+	return respBody
+}
+
+func (s *ControlHandlerService) SetSensorCalibration(
+	deviceID string,
+	variable state.ConditionVariable,
+	calibration state.Calibration) (SensorCalibrationResponseBody, error) {
+
+	var log = logger.Logger()
+
+	if err := calibration.Validate(); err != nil {
+		return SensorCalibrationResponseBody{}, fmt.Errorf("%w: %w", errCalibrationInvalid, err)
+	}
+
+	entity := dao.SensorCalibrationEntity{DeviceID: deviceID, Variable: variable, Calibration: calibration}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.SetSensorCalibration | failed to commit calibration entity: %s", err.Error())
+		return SensorCalibrationResponseBody{}, err
+	}
+
+	s.calibrationState.Set(deviceID, variable, calibration)
+	log.Debugf("[DEBUG] api.web.SetSensorCalibration | %s/%s calibration: %+v", deviceID, variable, calibration)
+	return s.ReturnSensorCalibration(deviceID, variable), nil
+}
+
+// ResetSensorCalibration returns the sensor to raw values and discards its
+// recorded points.
+func (s *ControlHandlerService) ResetSensorCalibration(deviceID string, variable state.ConditionVariable) error {
+	var log = logger.Logger()
+
+	if err := dao.DeleteSensorCalibration(deviceID, variable); err != nil {
+		log.Errorf("[ERROR] api.web.ResetSensorCalibration | failed to delete calibration: %s", err.Error())
+		return err
+	}
+
+	s.calibrationState.Reset(deviceID, variable)
+	log.Debugf("[DEBUG] api.web.ResetSensorCalibration | %s/%s calibration reset", deviceID, variable)
+	return nil
+}
+
+// RecordCalibrationPoint stores a reference point and rebuilds the sensor's
+// calibration from the latest point per label. Without an explicit raw value
+// the sensor's most recent reading is used. A single point yields an offset
+// correction, two or more points a piecewise-linear curve. The point is only
+// stored when the resulting curve is valid, and only while the calibration is
+// the one the stored points yield: a manual calibration has to be reset first
+// instead of being silently replaced.
+func (s *ControlHandlerService) RecordCalibrationPoint(
+	deviceID string,
+	variable state.ConditionVariable,
+	label string,
+	rawValue *float64,
+	referenceValue float64) (SensorCalibrationResponseBody, error) {
+
+	var log = logger.Logger()
+
+	point := state.CalibrationPoint{Label: label, ReferenceValue: referenceValue}
+	if rawValue != nil {
+		point.RawValue = *rawValue
+	} else if raw, ok := s.calibrationState.LastRaw(deviceID, variable); ok {
+		point.RawValue = raw
+	} else {
+		return SensorCalibrationResponseBody{}, fmt.Errorf("no raw_value given and no reading received yet from %s/%s", deviceID, variable)
+	}
+
+	stored, err := dao.LoadLatestCalibrationPoints(deviceID, variable)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.RecordCalibrationPoint | failed to load calibration points: %s", err.Error())
+		return SensorCalibrationResponseBody{}, err
+	}
+	if !s.calibrationState.Get(deviceID, variable).Equal(state.CalibrationFromPoints(stored)) {
+		return SensorCalibrationResponseBody{}, fmt.Errorf("%w on %s/%s, reset it before recording points",
+			errCalibrationManual, deviceID, variable)
+	}
+
+	points := []state.CalibrationPoint{point}
+	for _, storedPoint := range stored {
+		if storedPoint.Label != point.Label {
+			points = append(points, storedPoint)
+		}
+	}
+	calibration := state.CalibrationFromPoints(points)
+	if err := calibration.Validate(); err != nil {
+		return SensorCalibrationResponseBody{}, fmt.Errorf("%w: %w", errCalibrationInvalid, err)
+	}
+
+	pointEntity := dao.CalibrationPointEntity{DeviceID: deviceID, Variable: variable, Point: point}
+	calEntity := dao.SensorCalibrationEntity{DeviceID: deviceID, Variable: variable, Calibration: calibration}
+	if err := dao.CommitCalibrationPoint(&pointEntity, &calEntity); err != nil {
+		log.Errorf("[ERROR] api.web.RecordCalibrationPoint | failed to commit calibration point: %s", err.Error())
+		return SensorCalibrationResponseBody{}, err
+	}
+
+	s.calibrationState.Set(deviceID, variable, calibration)
+	log.Debugf("[DEBUG] api.web.RecordCalibrationPoint | %s/%s point %+v, calibration: %+v", deviceID, variable, point, calibration)
+	return s.ReturnSensorCalibration(deviceID, variable), nil
+}
@@ -0,0 +1,61 @@
+package web
+
+import (
+	"Solflora/logger"
+	"encoding/json"
+	"net/http"
+)
+
+type CO2SetPointResponseBody struct {
+	CO2SP float64 `json:"co2_sp"`
+}
+
+func CO2SetPointControl(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.CO2SetPointControl")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.CO2SetPointControl | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		newCO2SP, err := mapQueryParamToF64(query.Get("sp_value"))
+		if err != nil {
+			http.Error(w, "Bad Request – sp_value query parameter are not valid", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.CO2SetPointControl | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		if err := service.UpdateCO2SetPoint(newCO2SP); err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.CO2SetPointControl | set-point rejected | error: %s", err)
+			return
+		}
+		log.Info("[END] api.web.CO2SetPointControl")
+	}
+}
+
+func ReturnCO2SetPoint(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnCO2SetPoint")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnCO2SetPoint | method not allowed: %s", r.Method)
+			return
+		}
+
+		respBody := CO2SetPointResponseBody{
+			CO2SP: service.ReturnCO2SetPoint(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.ReturnCO2SetPoint")
+	}
+}
@@ -0,0 +1,42 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/metrics"
+	"Solflora/state"
+	"fmt"
+)
+
+func (s *ControlHandlerService) UpdateCO2SetPoint(updatedSetPoint float64) error {
+	var log = logger.Logger()
+
+	if updatedSetPoint < s.controlConfig.CO2SPMin || updatedSetPoint > s.controlConfig.CO2SPMax {
+		return fmt.Errorf("co2_sp %g is outside the allowed range [%g, %g]",
+			updatedSetPoint, s.controlConfig.CO2SPMin, s.controlConfig.CO2SPMax)
+	}
+
+	s.modelState.Set(state.CO2SP, updatedSetPoint)
+	log.Debug("[DEBUG] api.web.UpdateCO2SetPoint | updating co2_sp to ", updatedSetPoint)
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnCO2SetPoint() float64 {
+	var log = logger.Logger()
+	co2Sp := s.modelState.GetAll()[state.CO2SP]
+	log.Debug("[DEBUG] api.web.ReturnCO2SetPoint | returning co2 set-point: ", co2Sp)
+	return co2Sp
+}
+
+// stopCO2Enrichment closes the CO2 valve right away instead of waiting for the
+// next ESP sample, e.g. when the fan starts venting the room.
+func (s *ControlHandlerService) stopCO2Enrichment(reason string) {
+	var log = logger.Logger()
+	if !s.deviceState.GetAll()[state.CO2Control] {
+		return
+	}
+
+	s.deviceState.Set(state.CO2Control, false)
+	metrics.SetActuatorState(string(state.CO2Control), false)
+	s.recordSharedSwitch(state.CO2Control, false, state.ActuatorSourceInterlock)
+	log.Infof("[INFO] api.web.stopCO2Enrichment | closing co2 valve: %s", reason)
+}
@@ -0,0 +1,39 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type CommandStatusEntry struct {
+	Command     string              `json:"command"`
+	Value       float64             `json:"value"`
+	Seq         uint64              `json:"seq,omitempty"`
+	Status      state.CommandStatus `json:"status"`
+	DeliveredAt *time.Time          `json:"delivered_at,omitempty"`
+	AppliedAt   *time.Time          `json:"applied_at,omitempty"`
+	Message     string              `json:"message"`
+}
+
+func ReturnCommandStatus(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnCommandStatus")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnCommandStatus | method not allowed: %s", r.Method)
+			return
+		}
+
+		deviceID := mapQueryParamToDeviceID(r.URL.Query().Get("device_id"))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(service.ReturnCommandStatus(deviceID))
+
+		log.Info("[END] api.web.ReturnCommandStatus")
+	}
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"Solflora/state"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ReturnCommandStatus compares the commands the ESP should currently run with
+// those last delivered to the device and acknowledged by it.
+func (s *ControlHandlerService) ReturnCommandStatus(deviceID string) []CommandStatusEntry {
+	now := time.Now()
+	desired := state.DesiredCommands(deviceID, s.deviceState, s.modelState, s.tuneState, s.pumpState)
+
+	delivered := make(map[string]state.Command)
+	for _, c := range s.commandState.Commands(deviceID) {
+		delivered[c.Name] = c
+	}
+
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]CommandStatusEntry, 0, len(names))
+	for _, name := range names {
+		value := desired[name]
+		c, ok := delivered[name]
+		if !ok || c.Value != value {
+			entries = append(entries, CommandStatusEntry{
+				Command: name,
+				Value:   value,
+				Status:  state.CommandPending,
+				Message: fmt.Sprintf("%s=%g not yet delivered", name, value),
+			})
+			continue
+		}
+
+		entry := CommandStatusEntry{
+			Command:     name,
+			Value:       value,
+			Seq:         c.Seq,
+			Status:      c.Status(now, s.controlConfig.CommandAckTimeout),
+			DeliveredAt: c.DeliveredAt,
+			AppliedAt:   c.AppliedAt,
+		}
+		switch entry.Status {
+		case state.CommandApplied:
+			entry.Message = fmt.Sprintf("%s=%g applied", name, value)
+		case state.CommandTimedOut:
+			entry.Message = fmt.Sprintf("%s=%g not applied within %s of delivery", name, value, s.controlConfig.CommandAckTimeout)
+		default:
+			entry.Message = fmt.Sprintf("%s=%g delivered %s ago, not yet applied", name, value, now.Sub(*c.DeliveredAt).Round(time.Second))
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,91 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type DeviceConfigRequestBody struct {
+	DeviceID string `json:"device_id"`
+	Version  *int   `json:"version"`
+	state.DeviceConfig
+}
+
+type DeviceConfigResponseBody struct {
+	DeviceID string `json:"device_id"`
+	state.VersionedDeviceConfig
+}
+
+func ReturnDeviceConfig(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnDeviceConfig")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnDeviceConfig | method not allowed: %s", r.Method)
+			return
+		}
+
+		deviceID := mapQueryParamToDeviceID(r.URL.Query().Get("device_id"))
+		config, ok := service.ReturnDeviceConfig(deviceID)
+		if !ok {
+			http.Error(w, "Not Found – no config for device", http.StatusNotFound)
+			log.Errorf("[ERROR] api.web.ReturnDeviceConfig | no config for device %s", deviceID)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DeviceConfigResponseBody{DeviceID: deviceID, VersionedDeviceConfig: config})
+
+		log.Info("[END] api.web.ReturnDeviceConfig")
+	}
+}
+
+func SetDeviceConfig(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.SetDeviceConfig")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.SetDeviceConfig | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody DeviceConfigRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetDeviceConfig | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.SetDeviceConfig | request body: %+v\n", reqBody)
+
+		if err := reqBody.DeviceConfig.Validate(); err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetDeviceConfig | device config not valid | error: %s", err)
+			return
+		}
+
+		deviceID := mapQueryParamToDeviceID(reqBody.DeviceID)
+		config, err := service.SetDeviceConfig(deviceID, reqBody.DeviceConfig, reqBody.Version)
+		if errors.Is(err, errDeviceConfigVersionConflict) {
+			http.Error(w, "Conflict – "+err.Error(), http.StatusConflict)
+			log.Errorf("[ERROR] api.web.SetDeviceConfig | %s", err)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error – failed to commit device config", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.SetDeviceConfig | failed to commit device config: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DeviceConfigResponseBody{DeviceID: deviceID, VersionedDeviceConfig: config})
+
+		log.Info("[END] api.web.SetDeviceConfig")
+	}
+}
@@ -0,0 +1,56 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errDeviceConfigVersionConflict = errors.New("device config version conflict")
+
+func (s *ControlHandlerService) LoadDeviceConfigs() error {
+	var log = logger.Logger()
+
+	entities, err := dao.LoadDeviceConfigs()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadDeviceConfigs | failed to load device configs: %s", err.Error())
+		return err
+	}
+	for _, entity := range entities {
+		s.deviceConfigState.Set(entity.DeviceID, entity.Config)
+	}
+	log.Infof("[INFO] api.web.LoadDeviceConfigs | %d device configs restored", len(entities))
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnDeviceConfig(deviceID string) (state.VersionedDeviceConfig, bool) {
+	return s.deviceConfigState.Get(deviceID)
+}
+
+// SetDeviceConfig stores the document under the next version of the shared
+// sequence, so the config_version an ESP sees changes on every edit that
+// affects it, its own or the default's. When expectedVersion is given it must
+// match the current version, so concurrent edits do not silently overwrite
+// each other.
+func (s *ControlHandlerService) SetDeviceConfig(deviceID string, config state.DeviceConfig, expectedVersion *int) (state.VersionedDeviceConfig, error) {
+	var log = logger.Logger()
+
+	current, next, ok := s.deviceConfigState.Update(deviceID, config, expectedVersion, time.Now())
+	if !ok {
+		return current, fmt.Errorf("%w: expected version %d, current version is %d",
+			errDeviceConfigVersionConflict, *expectedVersion, current.Version)
+	}
+
+	entity := dao.DeviceConfigEntity{DeviceID: deviceID, Config: next}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.SetDeviceConfig | failed to commit device config entity: %s", err.Error())
+		s.deviceConfigState.Revert(deviceID, current, next)
+		return current, err
+	}
+
+	log.Debugf("[DEBUG] api.web.SetDeviceConfig | %s config version %d: %+v", deviceID, next.Version, config)
+	return next, nil
+}
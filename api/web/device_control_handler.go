@@ -2,13 +2,20 @@ package web
 
 import (
 	"Solflora/logger"
+	"Solflora/state"
+	"Solflora/util"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 )
 
+type PumpRefusalResponseBody struct {
+	ErrorCode state.PumpInterlockCode `json:"error_code"`
+	Message   string                  `json:"message"`
+}
+
 func WaterPumpControl(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var log = logger.Logger()
@@ -20,13 +27,28 @@ func WaterPumpControl(service *ControlHandlerService) func(http.ResponseWriter,
 			return
 		}
 
-		waterPumpOnStateDuration, err := time.ParseDuration(os.Getenv("WATER_PUMP_ON_STATE_DURATION"))
-		if err != nil {
-			log.Warn("[WARN] api.web.WaterPumpControl | $env:{WATER_PUMP_ON_STATE_DURATION} is not valid duration – defaulting to 4s")
-			waterPumpOnStateDuration = 4 * time.Second
+		var duration time.Duration
+		if rawDuration := r.URL.Query().Get("duration"); rawDuration != "" {
+			parsed, err := time.ParseDuration(rawDuration)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "Bad Request – duration query parameter is not valid", http.StatusBadRequest)
+				log.Errorf("[ERROR] api.web.WaterPumpControl | query parameter are not valid | error: %v", err)
+				return
+			}
+			duration = parsed
 		}
 
-		service.ActivateWaterPump(waterPumpOnStateDuration)
+		if err := service.ActivateWaterPump(duration); err != nil {
+			var interlockErr *util.PumpInterlockError
+			if errors.As(err, &interlockErr) {
+				writePumpRefusal(w, interlockErr)
+				log.Errorf("[ERROR] api.web.WaterPumpControl | pump run refused | %s", err)
+				return
+			}
+			http.Error(w, "Internal Server Error – failed to activate water pump", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.WaterPumpControl | failed to activate water pump: %s", err.Error())
+			return
+		}
 		log.Info("[END] api.web.WaterPumpControl")
 	}
 }
@@ -50,7 +72,11 @@ func AirFanControl(service *ControlHandlerService) func(http.ResponseWriter, *ht
 			return
 		}
 
-		service.UpdateAirFanState(airFanState)
+		if err := service.UpdateAirFanState(airFanState); err != nil {
+			http.Error(w, "Internal Server Error – failed to commit fan settings", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.AirFanControl | failed to commit fan settings: %s", err.Error())
+			return
+		}
 		log.Info("[END] api.web.AirFanControl")
 	}
 }
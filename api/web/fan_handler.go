@@ -0,0 +1,100 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"net/http"
+)
+
+type FanSettingsResponseBody struct {
+	state.FanSettings
+	Duty     float64 `json:"duty"`
+	DutyMin  float64 `json:"duty_min"`
+	DutyMax  float64 `json:"duty_max"`
+	RampRate float64 `json:"ramp_rate"`
+}
+
+func FanSpeedControl(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.FanSpeedControl")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.FanSpeedControl | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		duty, err := mapQueryParamToF64(query.Get("duty"))
+		if err != nil || duty < 0 || duty > 100 {
+			http.Error(w, "Bad Request – duty query parameter must be between 0 and 100", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.FanSpeedControl | query parameter are not valid | error: %v", err)
+			return
+		}
+
+		if err := service.UpdateFanSpeed(duty); err != nil {
+			http.Error(w, "Internal Server Error – failed to commit fan settings", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.FanSpeedControl | failed to commit fan settings: %s", err.Error())
+			return
+		}
+		log.Info("[END] api.web.FanSpeedControl")
+	}
+}
+
+func ReturnFanSettings(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnFanSettings")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnFanSettings | method not allowed: %s", r.Method)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(service.ReturnFanSettings())
+
+		log.Info("[END] api.web.ReturnFanSettings")
+	}
+}
+
+func SetFanSettings(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.SetFanSettings")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.SetFanSettings | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody state.FanSettings
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetFanSettings | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.SetFanSettings | request body: %+v\n", reqBody)
+
+		if err := reqBody.Validate(); err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetFanSettings | fan settings not valid | error: %s", err)
+			return
+		}
+
+		if err := service.SetFanSettings(reqBody); err != nil {
+			http.Error(w, "Internal Server Error – failed to commit fan settings", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.SetFanSettings | failed to commit fan settings: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(service.ReturnFanSettings())
+
+		log.Info("[END] api.web.SetFanSettings")
+	}
+}
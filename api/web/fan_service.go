@@ -0,0 +1,65 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+)
+
+func (s *ControlHandlerService) LoadFanSettings() error {
+	var log = logger.Logger()
+
+	entity, ok, err := dao.LoadFanSettings()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadFanSettings | failed to load fan settings: %s", err.Error())
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	if err := entity.Settings.Validate(); err != nil {
+		log.Warnf("[WARN] api.web.LoadFanSettings | stored fan settings not valid, using default: %s", err.Error())
+		return nil
+	}
+
+	s.fanState.SetSettings(entity.Settings)
+	log.Infof("[INFO] api.web.LoadFanSettings | fan settings %+v restored", entity.Settings)
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnFanSettings() FanSettingsResponseBody {
+	return FanSettingsResponseBody{
+		FanSettings: s.fanState.GetSettings(),
+		Duty:        s.deviceState.GetAllAnalog()[state.FanDuty],
+		DutyMin:     s.controlConfig.FanDutyMin,
+		DutyMax:     s.controlConfig.FanDutyMax,
+		RampRate:    s.controlConfig.FanRampRate,
+	}
+}
+
+// SetFanSettings stores the settings; the duty follows with the next ESP
+// sample, ramped at the configured rate.
+func (s *ControlHandlerService) SetFanSettings(settings state.FanSettings) error {
+	var log = logger.Logger()
+
+	entity := dao.FanSettingsEntity{Settings: settings}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.SetFanSettings | failed to commit fan settings entity: %s", err.Error())
+		return err
+	}
+
+	s.fanState.SetSettings(settings)
+	if settings.Mode == state.FanModeManual && settings.ManualDuty > 0 {
+		s.stopCO2Enrichment("fan switched on")
+	}
+	log.Debugf("[DEBUG] api.web.SetFanSettings | fan settings: %+v", settings)
+	return nil
+}
+
+// UpdateFanSpeed switches the fan to manual mode at the given duty.
+func (s *ControlHandlerService) UpdateFanSpeed(duty float64) error {
+	settings := s.fanState.GetSettings()
+	settings.Mode = state.FanModeManual
+	settings.ManualDuty = duty
+	return s.SetFanSettings(settings)
+}
@@ -0,0 +1,84 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type SignalFilterRequestBody struct {
+	Variable state.ConditionVariable `json:"variable"`
+	state.FilterConfig
+}
+
+type SignalFilterResponseBody struct {
+	Variable state.ConditionVariable `json:"variable"`
+	state.FilterConfig
+}
+
+func ReturnSignalFilters(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnSignalFilters")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnSignalFilters | method not allowed: %s", r.Method)
+			return
+		}
+
+		respBody := service.ReturnSignalFilters()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.ReturnSignalFilters")
+	}
+}
+
+func SetSignalFilter(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.SetSignalFilter")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.SetSignalFilter | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody SignalFilterRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetSignalFilter | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.SetSignalFilter | request body: %+v\n", reqBody)
+
+		if err := validateSignalFilter(service, reqBody); err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetSignalFilter | filter not valid | error: %s", err)
+			return
+		}
+
+		if err := service.SetSignalFilter(reqBody.Variable, reqBody.FilterConfig); err != nil {
+			http.Error(w, "Internal Server Error – failed to commit signal filter", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.SetSignalFilter | failed to commit signal filter: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SignalFilterResponseBody(reqBody))
+
+		log.Info("[END] api.web.SetSignalFilter")
+	}
+}
+
+func validateSignalFilter(service *ControlHandlerService, reqBody SignalFilterRequestBody) error {
+	if _, ok := service.variableRegistry.Get(reqBody.Variable); !ok {
+		return fmt.Errorf("variable [%s] cannot be filtered", reqBody.Variable)
+	}
+	return reqBody.FilterConfig.Validate()
+}
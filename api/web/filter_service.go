@@ -0,0 +1,53 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+)
+
+func (s *ControlHandlerService) LoadSignalFilters() error {
+	var log = logger.Logger()
+
+	entities, err := dao.LoadSignalFilters()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadSignalFilters | failed to load signal filters: %s", err.Error())
+		return err
+	}
+
+	for _, entity := range entities {
+		if err := entity.Config.Validate(); err != nil {
+			log.Warnf("[WARN] api.web.LoadSignalFilters | skipping filter of %s: %s", entity.Variable, err.Error())
+			continue
+		}
+		s.filterState.SetConfig(entity.Variable, entity.Config)
+	}
+	log.Infof("[INFO] api.web.LoadSignalFilters | %d signal filters restored", len(entities))
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnSignalFilters() []SignalFilterResponseBody {
+	definitions := s.variableRegistry.GetAll()
+	filters := make([]SignalFilterResponseBody, 0, len(definitions))
+	for _, definition := range definitions {
+		filters = append(filters, SignalFilterResponseBody{
+			Variable:     definition.Name,
+			FilterConfig: s.filterState.GetConfig(definition.Name),
+		})
+	}
+	return filters
+}
+
+func (s *ControlHandlerService) SetSignalFilter(variable state.ConditionVariable, filterConfig state.FilterConfig) error {
+	var log = logger.Logger()
+
+	entity := dao.SignalFilterEntity{Variable: variable, Config: filterConfig}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.SetSignalFilter | failed to commit signal filter entity: %s", err.Error())
+		return err
+	}
+
+	s.filterState.SetConfig(variable, filterConfig)
+	log.Debugf("[DEBUG] api.web.SetSignalFilter | %s filter: %+v", variable, filterConfig)
+	return nil
+}
@@ -0,0 +1,214 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type FirmwareTargetRequestBody struct {
+	DeviceID string `json:"device_id"`
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+}
+
+type FirmwareTargetsResponseBody struct {
+	Devices      map[string]string `json:"devices"`
+	Groups       map[string]string `json:"groups"`
+	DeviceGroups map[string]string `json:"device_groups"`
+}
+
+type DeviceGroupRequestBody struct {
+	DeviceID string `json:"device_id"`
+	Group    string `json:"group"`
+}
+
+// UploadFirmware takes the raw image as request body; version and the
+// expected sha256 (hex) are query parameters.
+func UploadFirmware(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.UploadFirmware")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.UploadFirmware | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		version := query.Get("version")
+		checksum := query.Get("sha256")
+		if err := validateFirmwareUpload(version, checksum); err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.UploadFirmware | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		image, err := service.UploadFirmware(version, checksum, r.Body)
+		switch {
+		case errors.Is(err, errFirmwareExists):
+			http.Error(w, "Conflict – "+err.Error(), http.StatusConflict)
+			log.Errorf("[ERROR] api.web.UploadFirmware | %s", err)
+			return
+		case errors.Is(err, errFirmwareRejected):
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.UploadFirmware | %s", err)
+			return
+		case err != nil:
+			http.Error(w, "Internal Server Error – failed to store firmware", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.UploadFirmware | failed to store firmware: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(image)
+
+		log.Info("[END] api.web.UploadFirmware")
+	}
+}
+
+func ReturnFirmwareImages(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnFirmwareImages")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnFirmwareImages | method not allowed: %s", r.Method)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(service.ReturnFirmwareImages())
+
+		log.Info("[END] api.web.ReturnFirmwareImages")
+	}
+}
+
+func ReturnFirmwareTargets(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnFirmwareTargets")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnFirmwareTargets | method not allowed: %s", r.Method)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(service.ReturnFirmwareTargets())
+
+		log.Info("[END] api.web.ReturnFirmwareTargets")
+	}
+}
+
+// SetFirmwareTarget assigns a version to either a device or a group; an empty
+// version removes the assignment.
+func SetFirmwareTarget(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.SetFirmwareTarget")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.SetFirmwareTarget | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody FirmwareTargetRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetFirmwareTarget | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.SetFirmwareTarget | request body: %+v\n", reqBody)
+
+		scope, name := state.FirmwareTargetDevice, reqBody.DeviceID
+		if reqBody.Group != "" {
+			scope, name = state.FirmwareTargetGroup, reqBody.Group
+		}
+		if (reqBody.DeviceID == "") == (reqBody.Group == "") {
+			http.Error(w, "Bad Request – exactly one of device_id and group is required", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetFirmwareTarget | exactly one of device_id and group is required")
+			return
+		}
+
+		if err := service.SetFirmwareTarget(scope, name, reqBody.Version); err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetFirmwareTarget | firmware target not set | error: %s", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(service.ReturnFirmwareTargets())
+
+		log.Info("[END] api.web.SetFirmwareTarget")
+	}
+}
+
+func SetDeviceGroup(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.SetDeviceGroup")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.SetDeviceGroup | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody DeviceGroupRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetDeviceGroup | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.SetDeviceGroup | request body: %+v\n", reqBody)
+
+		if err := service.SetDeviceGroup(mapQueryParamToDeviceID(reqBody.DeviceID), reqBody.Group); err != nil {
+			http.Error(w, "Internal Server Error – failed to commit device group", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.SetDeviceGroup | failed to commit device group: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(service.ReturnFirmwareTargets())
+
+		log.Info("[END] api.web.SetDeviceGroup")
+	}
+}
+
+func ReturnFirmwareUpdates(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnFirmwareUpdates")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnFirmwareUpdates | method not allowed: %s", r.Method)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(service.ReturnFirmwareUpdates())
+
+		log.Info("[END] api.web.ReturnFirmwareUpdates")
+	}
+}
+
+func validateFirmwareUpload(version string, checksum string) error {
+	if err := state.ValidateFirmwareVersion(version); err != nil {
+		return err
+	}
+	if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != 32 {
+		return fmt.Errorf("sha256 must be 64 hex characters")
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	errFirmwareExists   = errors.New("firmware version already uploaded")
+	errFirmwareRejected = errors.New("firmware image rejected")
+)
+
+// LoadFirmware restores images, assignments, groups and update progress.
+func (s *ControlHandlerService) LoadFirmware() error {
+	var log = logger.Logger()
+
+	images, err := dao.LoadFirmwareImages()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadFirmware | failed to load firmware images: %s", err.Error())
+		return err
+	}
+	for _, entity := range images {
+		if _, err := os.Stat(s.firmwareConfig.ImagePath(entity.Image.Version)); err != nil {
+			log.Warnf("[WARN] api.web.LoadFirmware | image of firmware %s not available: %s", entity.Image.Version, err.Error())
+			continue
+		}
+		s.firmwareState.AddImage(entity.Image)
+	}
+
+	targets, err := dao.LoadFirmwareTargets()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadFirmware | failed to load firmware targets: %s", err.Error())
+		return err
+	}
+	for _, entity := range targets {
+		s.firmwareState.SetTarget(entity.Scope, entity.Name, entity.Version)
+	}
+
+	groups, err := dao.LoadDeviceGroups()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadFirmware | failed to load device groups: %s", err.Error())
+		return err
+	}
+	for _, entity := range groups {
+		s.firmwareState.SetGroup(entity.DeviceID, entity.Group)
+	}
+
+	updates, err := dao.LoadFirmwareUpdates()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadFirmware | failed to load firmware updates: %s", err.Error())
+		return err
+	}
+	for _, entity := range updates {
+		s.firmwareState.RestoreUpdate(entity.Update)
+	}
+
+	log.Infof("[INFO] api.web.LoadFirmware | %d images, %d targets, %d device groups, %d updates restored",
+		len(images), len(targets), len(groups), len(updates))
+	return nil
+}
+
+// UploadFirmware stores an image after checking its size and SHA-256 checksum.
+// The image is written to a temporary file first, so a failed upload never
+// replaces or exposes a partial image.
+func (s *ControlHandlerService) UploadFirmware(version string, checksum string, body io.Reader) (state.FirmwareImage, error) {
+	var log = logger.Logger()
+
+	if _, ok := s.firmwareState.Image(version); ok {
+		return state.FirmwareImage{}, fmt.Errorf("%w: %s", errFirmwareExists, version)
+	}
+	if err := os.MkdirAll(s.firmwareConfig.Dir, 0o755); err != nil {
+		log.Errorf("[ERROR] api.web.UploadFirmware | failed to create firmware dir: %s", err.Error())
+		return state.FirmwareImage{}, err
+	}
+
+	file, err := os.CreateTemp(s.firmwareConfig.Dir, "upload-*.tmp")
+	if err != nil {
+		log.Errorf("[ERROR] api.web.UploadFirmware | failed to create temporary file: %s", err.Error())
+		return state.FirmwareImage{}, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(body, int64(s.firmwareConfig.MaxSize)+1))
+	if err != nil {
+		log.Errorf("[ERROR] api.web.UploadFirmware | failed to receive image: %s", err.Error())
+		return state.FirmwareImage{}, err
+	}
+	if size == 0 {
+		return state.FirmwareImage{}, fmt.Errorf("%w: image is empty", errFirmwareRejected)
+	}
+	if size > int64(s.firmwareConfig.MaxSize) {
+		return state.FirmwareImage{}, fmt.Errorf("%w: image exceeds %d bytes", errFirmwareRejected, s.firmwareConfig.MaxSize)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if sum != strings.ToLower(checksum) {
+		return state.FirmwareImage{}, fmt.Errorf("%w: sha256 mismatch, expected %s, received image has %s", errFirmwareRejected, checksum, sum)
+	}
+
+	if err := file.Close(); err != nil {
+		log.Errorf("[ERROR] api.web.UploadFirmware | failed to write image: %s", err.Error())
+		return state.FirmwareImage{}, err
+	}
+	// a link fails when the image exists, so of two concurrent uploads of the
+	// same version only one stores its image and the other removes nothing
+	path := s.firmwareConfig.ImagePath(version)
+	if err := os.Link(file.Name(), path); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return state.FirmwareImage{}, fmt.Errorf("%w: %s", errFirmwareExists, version)
+		}
+		log.Errorf("[ERROR] api.web.UploadFirmware | failed to store image: %s", err.Error())
+		return state.FirmwareImage{}, err
+	}
+
+	image := state.FirmwareImage{Version: version, SHA256: sum, Size: size, UploadedAt: time.Now()}
+	entity := dao.FirmwareImageEntity{Image: image}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.UploadFirmware | failed to commit firmware image entity: %s", err.Error())
+		os.Remove(path)
+		return state.FirmwareImage{}, err
+	}
+
+	s.firmwareState.AddImage(image)
+	log.Infof("[INFO] api.web.UploadFirmware | firmware %s uploaded (%d bytes, sha256 %s)", version, size, sum)
+	return image, nil
+}
+
+func (s *ControlHandlerService) ReturnFirmwareImages() []state.FirmwareImage {
+	return s.firmwareState.Images()
+}
+
+// SetFirmwareTarget assigns an uploaded version to a device or group; an empty
+// version removes the assignment.
+func (s *ControlHandlerService) SetFirmwareTarget(scope state.FirmwareTargetScope, name string, version string) error {
+	var log = logger.Logger()
+
+	if version != "" {
+		if _, ok := s.firmwareState.Image(version); !ok {
+			return fmt.Errorf("firmware version [%s] has not been uploaded", version)
+		}
+	}
+
+	entity := dao.FirmwareTargetEntity{Scope: scope, Name: name, Version: version}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.SetFirmwareTarget | failed to commit firmware target entity: %s", err.Error())
+		return err
+	}
+
+	s.firmwareState.SetTarget(scope, name, version)
+	log.Infof("[INFO] api.web.SetFirmwareTarget | %s %s targets firmware [%s]", scope, name, version)
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnFirmwareTargets() FirmwareTargetsResponseBody {
+	devices, groups := s.firmwareState.Targets()
+	return FirmwareTargetsResponseBody{Devices: devices, Groups: groups, DeviceGroups: s.firmwareState.Groups()}
+}
+
+func (s *ControlHandlerService) SetDeviceGroup(deviceID string, group string) error {
+	var log = logger.Logger()
+
+	entity := dao.DeviceGroupEntity{DeviceID: deviceID, Group: group}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.SetDeviceGroup | failed to commit device group entity: %s", err.Error())
+		return err
+	}
+
+	s.firmwareState.SetGroup(deviceID, group)
+	log.Debugf("[DEBUG] api.web.SetDeviceGroup | %s in group [%s]", deviceID, group)
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnFirmwareUpdates() []state.FirmwareUpdate {
+	return s.firmwareState.Updates()
+}
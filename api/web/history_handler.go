@@ -0,0 +1,128 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultHistoryLimit = 1000
+	maxHistoryLimit     = 10000
+)
+
+type HistoryEntry struct {
+	ID            int64    `json:"id"`
+	DeviceID      string   `json:"device_id"`
+	Value         float64  `json:"value"`
+	RawValue      *float64 `json:"raw"`
+	FilteredValue *float64 `json:"filtered"`
+	Quality       string   `json:"quality"`
+	Timestamp     string   `json:"time"`
+	TimestampMs   int64    `json:"time_ms"`
+
+	createdAt time.Time
+}
+
+type HistoryResponseBody struct {
+	Variable   state.ConditionVariable `json:"variable"`
+	Unit       string                  `json:"unit"`
+	Order      string                  `json:"order"`
+	Entries    []HistoryEntry          `json:"entries"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// ReturnHistory serves raw rows page by page: pass next_cursor of a response
+// as cursor, with the same other parameters, to get the following page.
+func ReturnHistory(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnHistory")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnHistory | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		definition, ok := service.variableRegistry.Get(state.ConditionVariable(query.Get("variable")))
+		if !ok {
+			http.Error(w, "Invalid variable query parameter", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnHistory | unknown variable: %s", query.Get("variable"))
+			return
+		}
+		tr, err := mapQueryParamsToTimeRange(query)
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnHistory | query parameter are not valid | error: %s", err)
+			return
+		}
+		order, limit, cursor, err := mapQueryParamsToHistoryPage(query.Get("order"), query.Get("limit"), query.Get("cursor"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnHistory | query parameter are not valid | error: %s", err)
+			return
+		}
+		location, err := mapQueryParamToLocation(query.Get("tz"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnHistory | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		entries, next, err := service.ReturnHistory(definition, query.Get("device_id"), tr, order == "desc", limit, cursor)
+		if err != nil {
+			http.Error(w, "Internal Server Error – ReturnHistory failed", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.ReturnHistory | ReturnHistory failed | err: %s", err)
+			return
+		}
+
+		for i := range entries {
+			createdAt := entries[i].createdAt.In(location)
+			entries[i].Timestamp, entries[i].TimestampMs = createdAt.Format(time.RFC3339Nano), createdAt.UnixMilli()
+		}
+		respBody := HistoryResponseBody{Variable: definition.Name, Unit: definition.Unit, Order: order, Entries: entries}
+		if next != nil {
+			respBody.NextCursor = next.encode()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.ReturnHistory")
+	}
+}
+
+func mapQueryParamsToHistoryPage(order string, limitS string, cursorS string) (string, int, *historyCursor, error) {
+	switch order {
+	case "":
+		order = "asc"
+	case "asc", "desc":
+	default:
+		return "", 0, nil, fmt.Errorf("order must be asc or desc")
+	}
+
+	limit := defaultHistoryLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			return "", 0, nil, fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit)
+		}
+	}
+
+	var cursor *historyCursor
+	if cursorS != "" {
+		decoded, err := decodeHistoryCursor(cursorS)
+		if err != nil {
+			return "", 0, nil, err
+		}
+		cursor = &decoded
+	}
+	return order, limit, cursor, nil
+}
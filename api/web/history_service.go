@@ -0,0 +1,107 @@
+package web
+
+import (
+	"Solflora/db"
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyCursor is the position after the last returned row; rows are ordered
+// by (created_at, id), so the position stays stable while new rows arrive.
+type historyCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+func (c historyCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", c.CreatedAt.UnixNano(), c.ID)))
+}
+
+func decodeHistoryCursor(encoded string) (historyCursor, error) {
+	var c historyCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return c, fmt.Errorf("cursor is not valid")
+	}
+	nanos, id, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return c, fmt.Errorf("cursor is not valid")
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return c, fmt.Errorf("cursor is not valid")
+	}
+	if c.ID, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return c, fmt.Errorf("cursor is not valid")
+	}
+	c.CreatedAt = time.Unix(0, unixNano)
+	return c, nil
+}
+
+// ReturnHistory pages through the raw rows of a variable, including rejected
+// samples. The next cursor is nil on the last page.
+func (s *ControlHandlerService) ReturnHistory(
+	definition state.VariableDefinition,
+	deviceID string,
+	tr timeRange,
+	descending bool,
+	limit int,
+	cursor *historyCursor) ([]HistoryEntry, *historyCursor, error) {
+
+	var log = logger.Logger()
+
+	table := definition.StorageTable()
+	query := `
+		SELECT id, device_id, present_value, raw_value, filtered_value, quality, created_at
+		FROM ` + table + `
+		WHERE created_at >= $1 AND created_at < $2`
+	args := []any{tr.From, tr.To}
+	if table == state.MeasurementTable {
+		args = append(args, definition.Name)
+		query += fmt.Sprintf(" AND variable = $%d", len(args))
+	}
+	if deviceID != "" {
+		args = append(args, deviceID)
+		query += fmt.Sprintf(" AND device_id = $%d", len(args))
+	}
+	direction, comparison := "ASC", ">"
+	if descending {
+		direction, comparison = "DESC", "<"
+	}
+	if cursor != nil {
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		query += fmt.Sprintf(" AND (created_at, id) %s ($%d, $%d)", comparison, len(args)-1, len(args))
+	}
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY created_at %[1]s, id %[1]s LIMIT $%[2]d", direction, len(args))
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.ReturnHistory | failed to retrieve %s history (range: %s – %s): %s", definition.Name, tr.From, tr.To, err.Error())
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]HistoryEntry, 0, limit)
+	var next *historyCursor
+	for rows.Next() {
+		if len(entries) == limit {
+			last := entries[len(entries)-1]
+			next = &historyCursor{CreatedAt: last.createdAt, ID: last.ID}
+			break
+		}
+		var entry HistoryEntry
+		if err := rows.Scan(&entry.ID, &entry.DeviceID, &entry.Value, &entry.RawValue, &entry.FilteredValue,
+			&entry.Quality, &entry.createdAt); err != nil {
+			log.Errorf("[ERROR] api.web.ReturnHistory | failed to scan row: %s", err.Error())
+			return nil, nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, next, rows.Err()
+}
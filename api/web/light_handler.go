@@ -0,0 +1,118 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"net/http"
+)
+
+type DailyLightIntegralResponseBody struct {
+	DLI        float64 `json:"dli"`
+	DLITarget  float64 `json:"dli_target"`
+	PPFD       float64 `json:"ppfd"`
+	LightsOn   bool    `json:"lights_on"`
+	LastSample string  `json:"last_sample,omitempty"`
+}
+
+func ReturnLightSchedule(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnLightSchedule")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnLightSchedule | method not allowed: %s", r.Method)
+			return
+		}
+
+		respBody := service.ReturnLightSchedule()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.ReturnLightSchedule")
+	}
+}
+
+func SetLightSchedule(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.SetLightSchedule")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.SetLightSchedule | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody state.LightSchedule
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetLightSchedule | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.SetLightSchedule | request body: %+v\n", reqBody)
+
+		if err := reqBody.Validate(); err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetLightSchedule | light schedule not valid | error: %s", err)
+			return
+		}
+
+		if err := service.SetLightSchedule(reqBody); err != nil {
+			http.Error(w, "Internal Server Error – failed to commit light schedule", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.SetLightSchedule | failed to commit light schedule: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reqBody)
+
+		log.Info("[END] api.web.SetLightSchedule")
+	}
+}
+
+func LightControl(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.LightControl")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.LightControl | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		lightState, err := mapQueryParamToBoolState(query.Get("state"))
+		if err != nil {
+			http.Error(w, "Bad Request – state query parameter are not valid", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.LightControl | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		service.UpdateLightState(lightState)
+		log.Info("[END] api.web.LightControl")
+	}
+}
+
+func ReturnDailyLightIntegral(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnDailyLightIntegral")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnDailyLightIntegral | method not allowed: %s", r.Method)
+			return
+		}
+
+		respBody := service.ReturnDailyLightIntegral()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.ReturnDailyLightIntegral")
+	}
+}
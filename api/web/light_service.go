@@ -0,0 +1,99 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/metrics"
+	"Solflora/state"
+	"time"
+)
+
+// LoadLightSchedule restores the stored light schedule and today's daily light
+// integral, so a restart neither loses the photoperiod nor the DLI so far.
+func (s *ControlHandlerService) LoadLightSchedule() error {
+	var log = logger.Logger()
+
+	entity, ok, err := dao.LoadLightSchedule()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadLightSchedule | failed to load light schedule: %s", err.Error())
+		return err
+	}
+	if ok {
+		if err := entity.Schedule.Validate(); err != nil {
+			log.Warnf("[WARN] api.web.LoadLightSchedule | stored light schedule not valid, using default: %s", err.Error())
+		} else {
+			s.lightState.SetSchedule(entity.Schedule)
+		}
+	}
+
+	now := time.Now().In(s.controlConfig.ScheduleLocation())
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	dli, ok, err := dao.LoadLatestMeasurement(state.LightDLI, midnight)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadLightSchedule | failed to load today's DLI: %s", err.Error())
+		return err
+	}
+	if ok {
+		s.lightState.RestoreDLI(now, dli)
+	}
+
+	log.Infof("[INFO] api.web.LoadLightSchedule | light schedule %+v, DLI %.2f mol/m²/d restored", s.lightState.GetSchedule(), dli)
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnLightSchedule() state.LightSchedule {
+	return s.lightState.GetSchedule()
+}
+
+func (s *ControlHandlerService) SetLightSchedule(schedule state.LightSchedule) error {
+	var log = logger.Logger()
+
+	entity := dao.LightScheduleEntity{Schedule: schedule}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.SetLightSchedule | failed to commit light schedule entity: %s", err.Error())
+		return err
+	}
+
+	s.lightState.SetSchedule(schedule)
+	log.Debugf("[DEBUG] api.web.SetLightSchedule | light schedule: %+v", schedule)
+	return nil
+}
+
+// UpdateLightState switches the lights by hand; the next ESP sample overrides
+// it again unless the schedule is in manual mode.
+func (s *ControlHandlerService) UpdateLightState(updatedState bool) {
+	var log = logger.Logger()
+	s.deviceState.Set(state.LightControl, updatedState)
+	metrics.SetActuatorState(string(state.LightControl), updatedState)
+	s.recordSharedSwitch(state.LightControl, updatedState, state.ActuatorSourceManual)
+	log.Debug("[DEBUG] api.web.UpdateLightState | updating lights to ", updatedState)
+	if !updatedState {
+		s.stopCO2Enrichment("lights switched off")
+	}
+}
+
+// recordSharedSwitch records a switch of an actuator every device is commanded
+// to, such as the lights, under each device that received commands so far,
+// the same keys the ESP sampling records under. Devices already recorded with
+// that value are skipped by the recorder.
+func (s *ControlHandlerService) recordSharedSwitch(actuator state.DeviceControlVariable, on bool, source state.ActuatorSource) {
+	for _, deviceID := range s.commandState.Devices() {
+		s.actuatorRecorder.Switch(deviceID, actuator, on, source)
+	}
+}
+
+func (s *ControlHandlerService) ReturnDailyLightIntegral() DailyLightIntegralResponseBody {
+	dli, ppfd, lastSample := s.lightState.GetDLI()
+	schedule := s.lightState.GetSchedule()
+	respBody := DailyLightIntegralResponseBody{
+		DLI:        dli,
+		DLITarget:  schedule.DLITarget,
+		PPFD:       ppfd,
+		LightsOn:   s.deviceState.GetAll()[state.LightControl],
+		LastSample: lastSample.Format(time.RFC3339),
+	}
+	if lastSample.IsZero() {
+		respBody.LastSample = ""
+	}
+	return respBody
+}
@@ -0,0 +1,113 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type LoopSettingsRequestBody struct {
+	Loop         state.LoopName `json:"loop"`
+	Mode         state.LoopMode `json:"mode"`
+	ManualOutput *float64       `json:"manual_output"`
+}
+
+type LoopSettingsResponseBody struct {
+	Loop state.LoopName `json:"loop"`
+	state.LoopSettings
+	Output float64 `json:"output"`
+}
+
+func ReturnLoopSettings(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnLoopSettings")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnLoopSettings | method not allowed: %s", r.Method)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(service.ReturnLoopSettings())
+
+		log.Info("[END] api.web.ReturnLoopSettings")
+	}
+}
+
+// SetLoopSettings switches a loop between manual, auto and off. The switch to
+// auto is bumpless, which relies on the PID integral accumulating the error:
+// gains stored before that change must be re-tuned before the temperature
+// loop runs in auto.
+func SetLoopSettings(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.SetLoopSettings")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.SetLoopSettings | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody LoopSettingsRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetLoopSettings | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.SetLoopSettings | request body: %+v\n", reqBody)
+
+		settings, err := validateLoopSettings(service, reqBody)
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetLoopSettings | loop settings not valid | error: %s", err)
+			return
+		}
+
+		respBody, err := service.SetLoopSettings(reqBody.Loop, settings, reqBody.ManualOutput != nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error – failed to commit loop settings", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.SetLoopSettings | failed to commit loop settings: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.SetLoopSettings")
+	}
+}
+
+func validateLoopSettings(service *ControlHandlerService, reqBody LoopSettingsRequestBody) (state.LoopSettings, error) {
+	if !state.IsLoop(reqBody.Loop) {
+		return state.LoopSettings{}, fmt.Errorf("unknown loop [%s]", reqBody.Loop)
+	}
+	settings := state.LoopSettings{Mode: reqBody.Mode}
+	if err := settings.Validate(); err != nil {
+		return settings, err
+	}
+	if reqBody.ManualOutput == nil {
+		return settings, nil
+	}
+
+	settings.ManualOutput = *reqBody.ManualOutput
+	switch reqBody.Loop {
+	case state.LoopTemperature:
+		// the tune profile's limits, which a preset may have narrowed
+		outputMin, outputMax := service.tuneState.GetOutputLimits()
+		if settings.ManualOutput < outputMin || settings.ManualOutput > outputMax {
+			return settings, fmt.Errorf("manual_output must be between %g and %g", outputMin, outputMax)
+		}
+	case state.LoopHumidity:
+		if settings.ManualOutput < 0 || settings.ManualOutput > 100 {
+			return settings, fmt.Errorf("manual_output must be a fan duty between 0 and 100")
+		}
+	case state.LoopMoisture:
+		return settings, fmt.Errorf("the moisture loop has no manual output, use the pump endpoints")
+	}
+	return settings, nil
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/util"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultSettlingBand     = 0.5
+	maxLoopPerformanceRange = 31 * 24 * time.Hour
+)
+
+// LoopPerformancePeriod is the analysis of the time one tune profile was in
+// effect; TuneProfile is nil before the first stored profile.
+type LoopPerformancePeriod struct {
+	TuneProfile *TuneProfileRevision `json:"tune_profile"`
+	From        string               `json:"from"`
+	To          string               `json:"to"`
+	util.LoopPerformance
+
+	from time.Time
+	to   time.Time
+}
+
+func ReturnLoopPerformance(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnLoopPerformance")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnLoopPerformance | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		tr, err := mapQueryParamsToTimeRange(query)
+		if err == nil && tr.Length() > maxLoopPerformanceRange {
+			err = fmt.Errorf("the range must not exceed %s", maxLoopPerformanceRange)
+		}
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnLoopPerformance | query parameter are not valid | error: %s", err)
+			return
+		}
+		settlingBand := defaultSettlingBand
+		if band := query.Get("settling_band"); band != "" {
+			if settlingBand, err = mapQueryParamToF64(band); err != nil || settlingBand <= 0 {
+				http.Error(w, "Invalid settling_band query parameter", http.StatusBadRequest)
+				log.Errorf("[ERROR] api.web.ReturnLoopPerformance | settling_band parameter is not valid: %s", band)
+				return
+			}
+		}
+		location, err := mapQueryParamToLocation(query.Get("tz"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnLoopPerformance | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		periods, err := service.ReturnLoopPerformance(query.Get("device_id"), tr, settlingBand)
+		if errors.Is(err, errLoopPerformanceTooManyProfiles) {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnLoopPerformance | %s", err)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error – ReturnLoopPerformance failed", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.ReturnLoopPerformance | ReturnLoopPerformance failed | err: %s", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mapTimeStampToSpecifiedFormatForLoopPerformance(periods, location))
+
+		log.Info("[END] api.web.ReturnLoopPerformance")
+	}
+}
+
+func mapTimeStampToSpecifiedFormatForLoopPerformance(periods []LoopPerformancePeriod, location *time.Location) []LoopPerformancePeriod {
+	for i := 0; i < len(periods); i++ {
+		periods[i].From = periods[i].from.In(location).Format(time.RFC3339)
+		periods[i].To = periods[i].to.In(location).Format(time.RFC3339)
+		if periods[i].TuneProfile != nil {
+			formatted := formatTuneProfileRevision(*periods[i].TuneProfile, location)
+			periods[i].TuneProfile = &formatted
+		}
+		for j := range periods[i].Steps {
+			periods[i].Steps[j].Time = periods[i].Steps[j].Time.In(location)
+		}
+	}
+
+	return periods
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/util"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errLoopPerformanceTooManyProfiles = errors.New("too many tune profile changes in the range")
+
+// loopPerformanceMaxGap is the longest interval between two temperature rows
+// that is still integrated; longer gaps are outages, not control behaviour.
+const loopPerformanceMaxGap = 5 * time.Minute
+
+// ReturnLoopPerformance analyzes the temperature loop per tune profile
+// period: the range is cut wherever a new gain set took effect, so the
+// periods can be compared with each other.
+func (s *ControlHandlerService) ReturnLoopPerformance(deviceID string, tr timeRange, settlingBand float64) ([]LoopPerformancePeriod, error) {
+	var log = logger.Logger()
+
+	initial, ok, err := dao.LoadTuneProfileAt(tr.From)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.ReturnLoopPerformance | failed to load tune profile at %s: %s", tr.From, err.Error())
+		return nil, err
+	}
+	// one more than the limit tells a complete list from a truncated one,
+	// which would merge the oldest periods into the initial profile
+	changes, err := dao.LoadTuneProfiles(tr.From, tr.To, maxTuneHistoryLimit+1)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.ReturnLoopPerformance | failed to load tune profiles: %s", err.Error())
+		return nil, err
+	}
+	if len(changes) > maxTuneHistoryLimit {
+		return nil, fmt.Errorf("%w: more than %d, narrow the range", errLoopPerformanceTooManyProfiles, maxTuneHistoryLimit)
+	}
+	entities, err := dao.LoadLoopSamples(deviceID, tr.From, tr.To)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.ReturnLoopPerformance | failed to load temperature rows: %s", err.Error())
+		return nil, err
+	}
+
+	// changes are newest first; periods are built oldest first
+	var profiles []*dao.TuneProfileEntity
+	if ok {
+		profiles = append(profiles, &initial)
+	} else {
+		profiles = append(profiles, nil)
+	}
+	for i := len(changes) - 1; i >= 0; i-- {
+		if ok && changes[i].ID == initial.ID {
+			continue
+		}
+		profiles = append(profiles, &changes[i])
+	}
+
+	periods := make([]LoopPerformancePeriod, 0, len(profiles))
+	next := 0
+	for i, profile := range profiles {
+		period := LoopPerformancePeriod{from: tr.From, to: tr.To}
+		if i > 0 {
+			period.from = profile.CreatedAt
+		}
+		if i+1 < len(profiles) {
+			period.to = profiles[i+1].CreatedAt
+		}
+
+		options := util.LoopPerformanceOptions{
+			OutputMin:    s.controlConfig.TemperatureCOMin,
+			OutputMax:    s.controlConfig.TemperatureCOMax,
+			SettlingBand: settlingBand,
+			MaxGap:       loopPerformanceMaxGap,
+		}
+		if profile != nil {
+			revision := mapTuneProfileEntityToRevision(*profile)
+			period.TuneProfile = &revision
+			if profile.OutputMin != nil && profile.OutputMax != nil {
+				options.OutputMin, options.OutputMax = *profile.OutputMin, *profile.OutputMax
+			}
+		}
+
+		var samples []util.LoopSample
+		for ; next < len(entities) && entities[next].CreatedAt.Before(period.to); next++ {
+			entity := entities[next]
+			samples = append(samples, util.LoopSample{
+				Time:             entity.CreatedAt,
+				PresentValue:     entity.PresentValue,
+				SetPoint:         entity.SetPoint,
+				ControllerOutput: entity.ControllerOutput,
+			})
+		}
+		period.LoopPerformance = util.AnalyzeLoop(samples, options)
+		periods = append(periods, period)
+	}
+
+	log.Debugf("[DEBUG] api.web.ReturnLoopPerformance | %d rows analyzed in %d periods", len(entities), len(periods))
+	return periods, nil
+}
@@ -0,0 +1,91 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+	"Solflora/util"
+)
+
+func (s *ControlHandlerService) LoadLoopSettings() error {
+	var log = logger.Logger()
+
+	entities, err := dao.LoadLoopSettings()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadLoopSettings | failed to load loop settings: %s", err.Error())
+		return err
+	}
+
+	for _, entity := range entities {
+		if !state.IsLoop(entity.Loop) || entity.Settings.Validate() != nil {
+			log.Warnf("[WARN] api.web.LoadLoopSettings | skipping stored settings of loop %s: %+v", entity.Loop, entity.Settings)
+			continue
+		}
+		s.loopState.Set(entity.Loop, entity.Settings)
+	}
+	log.Infof("[INFO] api.web.LoadLoopSettings | %d loop settings restored", len(entities))
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnLoopSettings() []LoopSettingsResponseBody {
+	names := s.loopState.Names()
+	loops := make([]LoopSettingsResponseBody, 0, len(names))
+	for _, name := range names {
+		loops = append(loops, LoopSettingsResponseBody{
+			Loop:         name,
+			LoopSettings: s.loopState.Get(name),
+			Output:       s.currentLoopOutput(name),
+		})
+	}
+	return loops
+}
+
+// SetLoopSettings switches a loop's mode. Leaving auto without an explicit
+// manual output keeps the current output; entering auto on the temperature
+// loop seeds the integral from the current output so temp_co does not jump.
+func (s *ControlHandlerService) SetLoopSettings(name state.LoopName, settings state.LoopSettings, manualOutputSet bool) (LoopSettingsResponseBody, error) {
+	var log = logger.Logger()
+
+	previous := s.loopState.Get(name)
+	if settings.Mode == state.LoopModeManual && !manualOutputSet {
+		if previous.Mode == state.LoopModeManual {
+			settings.ManualOutput = previous.ManualOutput
+		} else {
+			settings.ManualOutput = s.currentLoopOutput(name)
+		}
+	}
+
+	entity := dao.LoopSettingsEntity{Loop: name, Settings: settings}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.SetLoopSettings | failed to commit loop settings entity: %s", err.Error())
+		return LoopSettingsResponseBody{}, err
+	}
+
+	if name == state.LoopTemperature && settings.Mode == state.LoopModeAuto && previous.Mode != state.LoopModeAuto {
+		modelStateMap := s.modelState.GetAll()
+		pidErr := modelStateMap[state.TemperatureSP] - modelStateMap[state.TemperaturePV]
+		util.InitializeBumpless(modelStateMap[state.TemperatureCO], pidErr, s.integralState, s.tuneState)
+		log.Infof("[INFO] api.web.SetLoopSettings | temperature loop to auto, bumpless from temp_co %.2f", modelStateMap[state.TemperatureCO])
+	}
+	if name == state.LoopMoisture && settings.Mode == state.LoopModeOff && s.pumpController.Stop(state.ActuatorSourceManual) {
+		log.Infof("[INFO] api.web.SetLoopSettings | moisture loop off, running pump stopped")
+	}
+
+	s.loopState.Set(name, settings)
+	log.Debugf("[DEBUG] api.web.SetLoopSettings | %s loop: %+v -> %+v", name, previous, settings)
+	return LoopSettingsResponseBody{Loop: name, LoopSettings: settings, Output: s.currentLoopOutput(name)}, nil
+}
+
+func (s *ControlHandlerService) currentLoopOutput(name state.LoopName) float64 {
+	switch name {
+	case state.LoopTemperature:
+		return s.modelState.GetAll()[state.TemperatureCO]
+	case state.LoopHumidity:
+		return s.deviceState.GetAllAnalog()[state.FanDuty]
+	default:
+		if s.deviceState.GetAll()[state.WaterPumpControl] {
+			return 1
+		}
+		return 0
+	}
+}
@@ -13,20 +13,26 @@ type TemperatureSetPointResponseBody struct {
 }
 
 type TemperatureChartDataEntry struct {
-	TemperaturePV float64 `json:"temp_pv"`
-	TemperatureCO float64 `json:"temp_co"`
-	TemperatureSP float64 `json:"temp_sp"`
-	Timestamp     string  `json:"time"`
+	TemperaturePV         float64  `json:"temp_pv"`
+	TemperatureFilteredPV *float64 `json:"temp_pv_filtered"`
+	TemperatureCO         float64  `json:"temp_co"`
+	TemperatureSP         float64  `json:"temp_sp"`
+	Timestamp             string   `json:"time"`
+	TimestampMs           int64    `json:"time_ms"`
 }
 
 type HumidityChartDataEntry struct {
-	HumidityPV float64 `json:"humidity"`
-	Timestamp  string  `json:"time"`
+	HumidityPV         float64  `json:"humidity"`
+	HumidityFilteredPV *float64 `json:"humidity_filtered"`
+	Timestamp          string   `json:"time"`
+	TimestampMs        int64    `json:"time_ms"`
 }
 
 type MoistureChartDataEntry struct {
-	MoisturePV float64 `json:"moisture"`
-	Timestamp  string  `json:"time"`
+	MoisturePV         float64  `json:"moisture"`
+	MoistureFilteredPV *float64 `json:"moisture_filtered"`
+	Timestamp          string   `json:"time"`
+	TimestampMs        int64    `json:"time_ms"`
 }
 
 func TemperatureSetPointControl(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
@@ -48,7 +54,11 @@ func TemperatureSetPointControl(service *ControlHandlerService) func(http.Respon
 			return
 		}
 
-		service.UpdateTemperatureSetPoint(newTempSP)
+		if err := service.UpdateTemperatureSetPoint(newTempSP); err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.TemperatureSetPointControl | set-point rejected | error: %s", err)
+			return
+		}
 		log.Info("[END] api.web.TemperatureSetPointControl")
 	}
 }
@@ -87,25 +97,34 @@ func ReturnMoistureChartData(service *ControlHandlerService) func(http.ResponseW
 		}
 
 		query := r.URL.Query()
-		interval, err := mapQueryParamToDuration(query.Get("interval"))
+		tr, err := mapQueryParamsToTimeRange(query)
 		if err != nil {
-			http.Error(w, "Invalid interval query parameter", http.StatusBadRequest)
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
 			log.Errorf("[ERROR] api.web.ReturnMoistureChartData | query parameter are not valid | error: %s", err)
+			return
 		}
 		sampling, err := mapQueryParamToDuration(query.Get("sampling"))
 		if err != nil {
 			http.Error(w, "Invalid sampling query parameter", http.StatusBadRequest)
 			log.Errorf("[ERROR] api.web.ReturnMoistureChartData | sampling parameter are not valid | error: %s", err)
+			return
+		}
+		location, err := mapQueryParamToLocation(query.Get("tz"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnMoistureChartData | query parameter are not valid | error: %s", err)
+			return
 		}
 
-		entries, err := service.ReturnMoistureChartData(interval, sampling)
-		respBody := mapTimeStampToSpecifiedFormatForMoisture(entries)
-
+		entries, err := service.ReturnMoistureChartData(tr, sampling)
 		if err != nil {
 			http.Error(w, "Internal Server Error – ReturnMoistureChartData failed", http.StatusInternalServerError)
 			log.Errorf("[ERROR] api.web.ReturnMoistureChartData | ReturnMoistureChartData failed | err: %s", err)
+			return
 		}
 
+		respBody := mapTimeStampToSpecifiedFormatForMoisture(entries, location)
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(respBody)
 
@@ -125,25 +144,34 @@ func ReturnHumidityChartData(service *ControlHandlerService) func(http.ResponseW
 		}
 
 		query := r.URL.Query()
-		interval, err := mapQueryParamToDuration(query.Get("interval"))
+		tr, err := mapQueryParamsToTimeRange(query)
 		if err != nil {
-			http.Error(w, "Invalid interval query parameter", http.StatusBadRequest)
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
 			log.Errorf("[ERROR] api.web.ReturnHumidityChartData | query parameter are not valid | error: %s", err)
+			return
 		}
 		sampling, err := mapQueryParamToDuration(query.Get("sampling"))
 		if err != nil {
 			http.Error(w, "Invalid sampling query parameter", http.StatusBadRequest)
 			log.Errorf("[ERROR] api.web.ReturnHumidityChartData | sampling parameter are not valid | error: %s", err)
+			return
+		}
+		location, err := mapQueryParamToLocation(query.Get("tz"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnHumidityChartData | query parameter are not valid | error: %s", err)
+			return
 		}
 
-		entries, err := service.ReturnHumidityChartData(interval, sampling)
-		respBody := mapTimeStampToSpecifiedFormatForHumidity(entries)
-
+		entries, err := service.ReturnHumidityChartData(tr, sampling)
 		if err != nil {
 			http.Error(w, "Internal Server Error – ReturnTemperatureChartData failed", http.StatusInternalServerError)
 			log.Errorf("[ERROR] api.web.ReturnHumidityChartData | ReturnTemperatureChartData failed | err: %s", err)
+			return
 		}
 
+		respBody := mapTimeStampToSpecifiedFormatForHumidity(entries, location)
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(respBody)
 
@@ -163,25 +191,34 @@ func ReturnTemperatureChartData(service *ControlHandlerService) func(http.Respon
 		}
 
 		query := r.URL.Query()
-		interval, err := mapQueryParamToDuration(query.Get("interval"))
+		tr, err := mapQueryParamsToTimeRange(query)
 		if err != nil {
-			http.Error(w, "Invalid interval query parameter", http.StatusBadRequest)
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
 			log.Errorf("[ERROR] api.web.ReturnTemperatureChartData | query parameter are not valid | error: %s", err)
+			return
 		}
 		sampling, err := mapQueryParamToDuration(query.Get("sampling"))
 		if err != nil {
 			http.Error(w, "Invalid sampling query parameter", http.StatusBadRequest)
 			log.Errorf("[ERROR] api.web.ReturnTemperatureChartData | sampling parameter are not valid | error: %s", err)
+			return
+		}
+		location, err := mapQueryParamToLocation(query.Get("tz"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnTemperatureChartData | query parameter are not valid | error: %s", err)
+			return
 		}
 
-		entries, err := service.ReturnTemperatureChartData(interval, sampling)
-		respBody := mapTimeStampToSpecifiedFormatForTemp(entries)
-
+		entries, err := service.ReturnTemperatureChartData(tr, sampling)
 		if err != nil {
 			http.Error(w, "Internal Server Error – ReturnTemperatureChartData failed", http.StatusInternalServerError)
 			log.Errorf("[ERROR] api.web.ReturnTemperatureChartData | ReturnTemperatureChartData failed | err: %s", err)
+			return
 		}
 
+		respBody := mapTimeStampToSpecifiedFormatForTemp(entries, location)
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(respBody)
 
@@ -195,26 +232,23 @@ func mapQueryParamToF64(floatS string) (float64, error) {
 func mapQueryParamToDuration(durationS string) (time.Duration, error) {
 	return time.ParseDuration(durationS)
 }
-func mapTimeStampToSpecifiedFormatForTemp(entries []TemperatureChartDataEntry) []TemperatureChartDataEntry {
+func mapTimeStampToSpecifiedFormatForTemp(entries []TemperatureChartDataEntry, location *time.Location) []TemperatureChartDataEntry {
 	for i := 0; i < len(entries); i++ {
-		t, _ := time.Parse(time.RFC3339Nano, entries[i].Timestamp)
-		entries[i].Timestamp = t.Format("15:04:05")
+		entries[i].Timestamp, entries[i].TimestampMs = formatTimestamp(entries[i].Timestamp, location)
 	}
 
 	return entries
 }
-func mapTimeStampToSpecifiedFormatForHumidity(entries []HumidityChartDataEntry) []HumidityChartDataEntry {
+func mapTimeStampToSpecifiedFormatForHumidity(entries []HumidityChartDataEntry, location *time.Location) []HumidityChartDataEntry {
 	for i := 0; i < len(entries); i++ {
-		t, _ := time.Parse(time.RFC3339Nano, entries[i].Timestamp)
-		entries[i].Timestamp = t.Format("15:04:05")
+		entries[i].Timestamp, entries[i].TimestampMs = formatTimestamp(entries[i].Timestamp, location)
 	}
 
 	return entries
 }
-func mapTimeStampToSpecifiedFormatForMoisture(entries []MoistureChartDataEntry) []MoistureChartDataEntry {
+func mapTimeStampToSpecifiedFormatForMoisture(entries []MoistureChartDataEntry, location *time.Location) []MoistureChartDataEntry {
 	for i := 0; i < len(entries); i++ {
-		t, _ := time.Parse(time.RFC3339Nano, entries[i].Timestamp)
-		entries[i].Timestamp = t.Format("15:04:05")
+		entries[i].Timestamp, entries[i].TimestampMs = formatTimestamp(entries[i].Timestamp, location)
 	}
 
 	return entries
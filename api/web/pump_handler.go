@@ -0,0 +1,202 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"Solflora/util"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+type FlowCalibrationRequestBody struct {
+	DeviceID string `json:"device_id"`
+	state.FlowCalibration
+}
+
+type FlowCalibrationResponseBody struct {
+	DeviceID string `json:"device_id"`
+	state.FlowCalibration
+}
+
+type WaterDoseResponseBody struct {
+	DeviceID        string  `json:"device_id"`
+	VolumeML        float64 `json:"volume_ml"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+type WaterUsageEntry struct {
+	DeliveredML     float64 `json:"delivered_ml"`
+	RequestedML     float64 `json:"requested_ml"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Metered         bool    `json:"metered"`
+	Timestamp       string  `json:"time"`
+	TimestampMs     int64   `json:"time_ms"`
+}
+
+func WaterDoseControl(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.WaterDoseControl")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.WaterDoseControl | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		deviceID := mapQueryParamToDeviceID(query.Get("device_id"))
+		volumeML, err := strconv.ParseFloat(query.Get("volume_ml"), 64)
+		if err != nil || volumeML <= 0 {
+			http.Error(w, "Bad Request – volume_ml query parameter is not valid", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.WaterDoseControl | query parameter are not valid | error: %v", err)
+			return
+		}
+
+		duration, err := service.DoseWater(deviceID, volumeML)
+		if err != nil {
+			var interlockErr *util.PumpInterlockError
+			if errors.As(err, &interlockErr) {
+				writePumpRefusal(w, interlockErr)
+				log.Errorf("[ERROR] api.web.WaterDoseControl | pump run refused | %s", err)
+				return
+			}
+			http.Error(w, "Unprocessable Entity – "+err.Error(), http.StatusUnprocessableEntity)
+			log.Errorf("[ERROR] api.web.WaterDoseControl | failed to dose water: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(WaterDoseResponseBody{DeviceID: deviceID, VolumeML: volumeML, DurationSeconds: duration.Seconds()})
+
+		log.Info("[END] api.web.WaterDoseControl")
+	}
+}
+
+func ReturnFlowCalibration(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnFlowCalibration")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnFlowCalibration | method not allowed: %s", r.Method)
+			return
+		}
+
+		deviceID := mapQueryParamToDeviceID(r.URL.Query().Get("device_id"))
+		calibration, ok := service.ReturnFlowCalibration(deviceID)
+		if !ok {
+			http.Error(w, "Not Found – no pump flow calibration for device", http.StatusNotFound)
+			log.Errorf("[ERROR] api.web.ReturnFlowCalibration | no pump flow calibration for device %s", deviceID)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(FlowCalibrationResponseBody{DeviceID: deviceID, FlowCalibration: calibration})
+
+		log.Info("[END] api.web.ReturnFlowCalibration")
+	}
+}
+
+func SetFlowCalibration(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.SetFlowCalibration")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.SetFlowCalibration | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody FlowCalibrationRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetFlowCalibration | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.SetFlowCalibration | request body: %+v\n", reqBody)
+
+		reqBody.DeviceID = mapQueryParamToDeviceID(reqBody.DeviceID)
+		if err := reqBody.FlowCalibration.Validate(); err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.SetFlowCalibration | flow calibration not valid | error: %s", err)
+			return
+		}
+
+		if err := service.SetFlowCalibration(reqBody.DeviceID, reqBody.FlowCalibration); err != nil {
+			http.Error(w, "Internal Server Error – failed to commit pump flow calibration", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.SetFlowCalibration | failed to commit pump flow calibration: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(FlowCalibrationResponseBody(reqBody))
+
+		log.Info("[END] api.web.SetFlowCalibration")
+	}
+}
+
+func ReturnWaterUsage(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnWaterUsage")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnWaterUsage | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		tr, err := mapQueryParamsToTimeRange(query)
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnWaterUsage | query parameter are not valid | error: %s", err)
+			return
+		}
+		bucket := query.Get("bucket")
+		if bucket == "" {
+			bucket = "day"
+		}
+		if bucket != "day" && bucket != "event" {
+			http.Error(w, "Invalid bucket query parameter (day or event)", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnWaterUsage | unknown bucket: %s", bucket)
+			return
+		}
+		location, err := mapQueryParamToLocation(query.Get("tz"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnWaterUsage | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		entries, err := service.ReturnWaterUsage(query.Get("device_id"), tr, bucket, location)
+		if err != nil {
+			http.Error(w, "Internal Server Error – ReturnWaterUsage failed", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.ReturnWaterUsage | ReturnWaterUsage failed | err: %s", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+
+		log.Info("[END] api.web.ReturnWaterUsage")
+	}
+}
+
+func writePumpRefusal(w http.ResponseWriter, interlockErr *util.PumpInterlockError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(PumpRefusalResponseBody{ErrorCode: interlockErr.Code, Message: interlockErr.Message})
+}
+
+func mapQueryParamToDeviceID(deviceID string) string {
+	if deviceID == "" {
+		return state.DefaultDeviceID
+	}
+	return deviceID
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/db"
+	"Solflora/logger"
+	"Solflora/state"
+	"fmt"
+	"time"
+)
+
+// DoseWater converts a volume into pump on-time using the device's flow
+// calibration; the run then passes the same interlocks as a timed run.
+func (s *ControlHandlerService) DoseWater(deviceID string, volumeML float64) (time.Duration, error) {
+	calibration, ok := s.pumpState.GetFlowCalibration(deviceID)
+	if !ok {
+		return 0, fmt.Errorf("device [%s] has no pump flow calibration", deviceID)
+	}
+
+	duration := calibration.DurationFor(volumeML)
+	run := state.PumpRun{DeviceID: deviceID, Start: time.Now(), Duration: duration, RequestedML: volumeML}
+	return duration, s.pumpController.Start(run)
+}
+
+func (s *ControlHandlerService) LoadFlowCalibrations() error {
+	var log = logger.Logger()
+
+	entities, err := dao.LoadFlowCalibrations()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadFlowCalibrations | failed to load pump flow calibrations: %s", err.Error())
+		return err
+	}
+	for _, entity := range entities {
+		s.pumpState.SetFlowCalibration(entity.DeviceID, entity.Calibration)
+	}
+	log.Infof("[INFO] api.web.LoadFlowCalibrations | %d pump flow calibrations restored", len(entities))
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnFlowCalibration(deviceID string) (state.FlowCalibration, bool) {
+	return s.pumpState.GetFlowCalibration(deviceID)
+}
+
+func (s *ControlHandlerService) SetFlowCalibration(deviceID string, calibration state.FlowCalibration) error {
+	var log = logger.Logger()
+
+	entity := dao.FlowCalibrationEntity{DeviceID: deviceID, Calibration: calibration}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.SetFlowCalibration | failed to commit pump flow calibration entity: %s", err.Error())
+		return err
+	}
+
+	s.pumpState.SetFlowCalibration(deviceID, calibration)
+	log.Debugf("[DEBUG] api.web.SetFlowCalibration | %s flow calibration: %+v", deviceID, calibration)
+	return nil
+}
+
+// ReturnWaterUsage sums the delivered volume per pump run (bucket "event") or
+// per calendar day (bucket "day") of the display time zone.
+func (s *ControlHandlerService) ReturnWaterUsage(deviceID string, tr timeRange, bucket string, location *time.Location) ([]WaterUsageEntry, error) {
+	var log = logger.Logger()
+
+	var query string
+	args := []any{tr.From, tr.To, deviceID}
+	switch bucket {
+	case "event":
+		query = `
+		SELECT started_at, delivered_ml, requested_ml, duration_ms, metered
+		FROM pump_run
+		WHERE started_at >= $1 AND started_at < $2 AND ($3::text = '' OR device_id = $3::text)
+		ORDER BY started_at`
+	case "day":
+		query = `
+		SELECT date_trunc('day', started_at AT TIME ZONE $4::text) AT TIME ZONE $4::text,
+		       SUM(delivered_ml), SUM(requested_ml), SUM(duration_ms), BOOL_AND(metered)
+		FROM pump_run
+		WHERE started_at >= $1 AND started_at < $2 AND ($3::text = '' OR device_id = $3::text)
+		GROUP BY 1
+		ORDER BY 1`
+		args = append(args, location.String())
+	default:
+		return nil, fmt.Errorf("unknown bucket [%s]", bucket)
+	}
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.ReturnWaterUsage | failed to retrieve water usage (range: %s – %s): %s", tr.From, tr.To, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []WaterUsageEntry{}
+	for rows.Next() {
+		var entry WaterUsageEntry
+		var start time.Time
+		var durationMs int64
+		if err := rows.Scan(&start, &entry.DeliveredML, &entry.RequestedML, &durationMs, &entry.Metered); err != nil {
+			log.Errorf("[ERROR] api.web.ReturnWaterUsage | failed to scan row: %s", err.Error())
+			return nil, err
+		}
+		start = start.In(location)
+		entry.Timestamp, entry.TimestampMs = start.Format(time.RFC3339), start.UnixMilli()
+		entry.DurationSeconds = float64(durationMs) / 1000
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// LoadPumpRuns restores the runs of the last 24 h, so a restart does not reset
+// the daily runtime limit.
+func (s *ControlHandlerService) LoadPumpRuns() error {
+	var log = logger.Logger()
+
+	entities, err := dao.LoadPumpRuns(time.Now().Add(-state.PumpRuntimeWindow))
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadPumpRuns | failed to load pump runs: %s", err.Error())
+		return err
+	}
+	for _, entity := range entities {
+		s.pumpState.Record(entity.Run)
+	}
+	log.Infof("[INFO] api.web.LoadPumpRuns | %d pump runs restored", len(entities))
+	return nil
+}
@@ -0,0 +1,294 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+const (
+	recipePeriodDay   = "day"
+	recipePeriodNight = "night"
+)
+
+// RecipeStatus is the assignment of a device with the stage it runs. DueStage,
+// StageStart and StageEnd follow the start date even while a stage override
+// holds Stage; Stage is nil before the start date.
+type RecipeStatus struct {
+	state.RecipeAssignment
+	Stage      *state.GrowthStage `json:"stage"`
+	StageIndex int                `json:"stage_index"`
+	DueStage   string             `json:"due_stage,omitempty"`
+	StageStart string             `json:"stage_start,omitempty"`
+	StageEnd   string             `json:"stage_end"`
+	Period     string             `json:"period,omitempty"`
+	Finished   bool               `json:"finished"`
+}
+
+type RecipeStageOverrideRequestBody struct {
+	DeviceID string `json:"device_id"`
+	Stage    string `json:"stage"`
+}
+
+// ReturnCropRecipes returns the recipe of the name query parameter, or all
+// recipes without one.
+func ReturnCropRecipes(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnCropRecipes")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnCropRecipes | method not allowed: %s", r.Method)
+			return
+		}
+
+		var respBody any = service.ReturnCropRecipes()
+		if name := r.URL.Query().Get("name"); name != "" {
+			recipe, ok := service.ReturnCropRecipe(name)
+			if !ok {
+				http.Error(w, "Not Found – no crop recipe "+name, http.StatusNotFound)
+				log.Errorf("[ERROR] api.web.ReturnCropRecipes | no crop recipe %s", name)
+				return
+			}
+			respBody = recipe
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.ReturnCropRecipes")
+	}
+}
+
+func CreateCropRecipe(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.CreateCropRecipe")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.CreateCropRecipe | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody state.CropRecipe
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.CreateCropRecipe | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.CreateCropRecipe | request body: %+v\n", reqBody)
+
+		recipe, err := service.CreateCropRecipe(reqBody)
+		if err != nil {
+			writeCropRecipeError(w, err, "failed to commit crop recipe")
+			log.Errorf("[ERROR] api.web.CreateCropRecipe | failed to create crop recipe: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(recipe)
+
+		log.Info("[END] api.web.CreateCropRecipe")
+	}
+}
+
+func UpdateCropRecipe(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.UpdateCropRecipe")
+
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.UpdateCropRecipe | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody state.CropRecipe
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.UpdateCropRecipe | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.UpdateCropRecipe | request body: %+v\n", reqBody)
+
+		recipe, err := service.UpdateCropRecipe(reqBody)
+		if err != nil {
+			writeCropRecipeError(w, err, "failed to commit crop recipe")
+			log.Errorf("[ERROR] api.web.UpdateCropRecipe | failed to update crop recipe: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(recipe)
+
+		log.Info("[END] api.web.UpdateCropRecipe")
+	}
+}
+
+func DeleteCropRecipe(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.DeleteCropRecipe")
+
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.DeleteCropRecipe | method not allowed: %s", r.Method)
+			return
+		}
+
+		if err := service.DeleteCropRecipe(r.URL.Query().Get("name")); err != nil {
+			writeCropRecipeError(w, err, "failed to delete crop recipe")
+			log.Errorf("[ERROR] api.web.DeleteCropRecipe | failed to delete crop recipe: %s", err.Error())
+			return
+		}
+
+		log.Info("[END] api.web.DeleteCropRecipe")
+	}
+}
+
+// ReturnRecipeAssignments returns the status of the device_id query
+// parameter, or of every device running a recipe without one.
+func ReturnRecipeAssignments(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnRecipeAssignments")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnRecipeAssignments | method not allowed: %s", r.Method)
+			return
+		}
+
+		var respBody any
+		var err error
+		if deviceID := r.URL.Query().Get("device_id"); deviceID != "" {
+			respBody, err = service.ReturnRecipeStatus(deviceID)
+		} else {
+			respBody, err = service.ReturnRecipeStatuses()
+		}
+		if err != nil {
+			writeCropRecipeError(w, err, "failed to evaluate recipe")
+			log.Errorf("[ERROR] api.web.ReturnRecipeAssignments | failed to evaluate recipe: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.ReturnRecipeAssignments")
+	}
+}
+
+func AssignCropRecipe(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.AssignCropRecipe")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.AssignCropRecipe | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody state.RecipeAssignment
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.AssignCropRecipe | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.AssignCropRecipe | request body: %+v\n", reqBody)
+
+		status, err := service.AssignCropRecipe(reqBody)
+		if err != nil {
+			writeCropRecipeError(w, err, "failed to assign crop recipe")
+			log.Errorf("[ERROR] api.web.AssignCropRecipe | failed to assign crop recipe: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+
+		log.Info("[END] api.web.AssignCropRecipe")
+	}
+}
+
+func UnassignCropRecipe(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.UnassignCropRecipe")
+
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.UnassignCropRecipe | method not allowed: %s", r.Method)
+			return
+		}
+
+		deviceID := r.URL.Query().Get("device_id")
+		if deviceID == "" {
+			deviceID = state.DefaultDeviceID
+		}
+		if err := service.UnassignCropRecipe(deviceID); err != nil {
+			writeCropRecipeError(w, err, "failed to remove recipe assignment")
+			log.Errorf("[ERROR] api.web.UnassignCropRecipe | failed to remove recipe assignment: %s", err.Error())
+			return
+		}
+
+		log.Info("[END] api.web.UnassignCropRecipe")
+	}
+}
+
+// OverrideRecipeStage holds a device in the stage of the request body; an
+// empty stage clears the override.
+func OverrideRecipeStage(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.OverrideRecipeStage")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.OverrideRecipeStage | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody RecipeStageOverrideRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.OverrideRecipeStage | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.OverrideRecipeStage | request body: %+v\n", reqBody)
+
+		if reqBody.DeviceID == "" {
+			reqBody.DeviceID = state.DefaultDeviceID
+		}
+		status, err := service.OverrideRecipeStage(reqBody.DeviceID, reqBody.Stage)
+		if err != nil {
+			writeCropRecipeError(w, err, "failed to override recipe stage")
+			log.Errorf("[ERROR] api.web.OverrideRecipeStage | failed to override recipe stage: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+
+		log.Info("[END] api.web.OverrideRecipeStage")
+	}
+}
+
+func writeCropRecipeError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, errCropRecipeInvalid):
+		http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errCropRecipeNotFound), errors.Is(err, errRecipeAssignmentNotFound):
+		http.Error(w, "Not Found – "+err.Error(), http.StatusNotFound)
+	case errors.Is(err, errCropRecipeExists), errors.Is(err, errCropRecipeInUse):
+		http.Error(w, "Conflict – "+err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Internal Server Error – "+message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,370 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// recipeInterval is how often the recipe job checks for stage and day/night
+// changes.
+const recipeInterval = time.Minute
+
+var (
+	errCropRecipeNotFound       = errors.New("crop recipe not found")
+	errCropRecipeExists         = errors.New("crop recipe already exists")
+	errCropRecipeInvalid        = errors.New("crop recipe not valid")
+	errCropRecipeInUse          = errors.New("crop recipe in use")
+	errRecipeAssignmentNotFound = errors.New("recipe assignment not found")
+)
+
+// LoadCropRecipes restores the recipes and the device assignments; the
+// recipe job applies the targets of the assignments once it starts.
+func (s *ControlHandlerService) LoadCropRecipes() error {
+	var log = logger.Logger()
+
+	recipes, err := dao.LoadCropRecipes()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadCropRecipes | failed to load crop recipes: %s", err.Error())
+		return err
+	}
+	for _, entity := range recipes {
+		s.recipeState.Set(entity.Recipe)
+	}
+
+	assignments, err := dao.LoadRecipeAssignments()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadCropRecipes | failed to load recipe assignments: %s", err.Error())
+		return err
+	}
+	for _, entity := range assignments {
+		s.recipeState.SetAssignment(entity.Assignment)
+	}
+	log.Infof("[INFO] api.web.LoadCropRecipes | %d crop recipes and %d assignments restored", len(recipes), len(assignments))
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnCropRecipes() []state.CropRecipe {
+	return s.recipeState.GetAll()
+}
+
+func (s *ControlHandlerService) ReturnCropRecipe(name string) (state.CropRecipe, bool) {
+	return s.recipeState.Get(name)
+}
+
+func (s *ControlHandlerService) CreateCropRecipe(recipe state.CropRecipe) (state.CropRecipe, error) {
+	if _, ok := s.recipeState.Get(recipe.Name); ok {
+		return state.CropRecipe{}, fmt.Errorf("%w: %s", errCropRecipeExists, recipe.Name)
+	}
+	return s.commitCropRecipe(recipe)
+}
+
+// UpdateCropRecipe replaces a recipe; devices running it apply the changed
+// targets right away.
+func (s *ControlHandlerService) UpdateCropRecipe(recipe state.CropRecipe) (state.CropRecipe, error) {
+	if _, ok := s.recipeState.Get(recipe.Name); !ok {
+		return state.CropRecipe{}, fmt.Errorf("%w: %s", errCropRecipeNotFound, recipe.Name)
+	}
+	for _, assignment := range s.recipeState.GetAssignments() {
+		if assignment.Recipe != recipe.Name || assignment.StageOverride == "" {
+			continue
+		}
+		if _, ok := recipe.StageIndex(assignment.StageOverride); !ok {
+			return state.CropRecipe{}, fmt.Errorf("%w: device %s holds stage %s, which the recipe no longer has",
+				errCropRecipeInUse, assignment.DeviceID, assignment.StageOverride)
+		}
+	}
+
+	stored, err := s.commitCropRecipe(recipe)
+	if err != nil {
+		return stored, err
+	}
+	s.runRecipes()
+	return stored, nil
+}
+
+func (s *ControlHandlerService) DeleteCropRecipe(name string) error {
+	var log = logger.Logger()
+
+	if _, ok := s.recipeState.Get(name); !ok {
+		return fmt.Errorf("%w: %s", errCropRecipeNotFound, name)
+	}
+	for _, assignment := range s.recipeState.GetAssignments() {
+		if assignment.Recipe == name {
+			return fmt.Errorf("%w: %s is assigned to device %s", errCropRecipeInUse, name, assignment.DeviceID)
+		}
+	}
+	if err := dao.DeleteCropRecipe(name); err != nil {
+		log.Errorf("[ERROR] api.web.DeleteCropRecipe | failed to delete crop recipe %s: %s", name, err.Error())
+		return err
+	}
+
+	s.recipeState.Delete(name)
+	log.Infof("[INFO] api.web.DeleteCropRecipe | crop recipe %s deleted", name)
+	return nil
+}
+
+// ReturnRecipeStatus reports the stage a device is in and the targets it runs.
+func (s *ControlHandlerService) ReturnRecipeStatus(deviceID string) (RecipeStatus, error) {
+	assignment, ok := s.recipeState.GetAssignment(deviceID)
+	if !ok {
+		return RecipeStatus{}, fmt.Errorf("%w: device %s", errRecipeAssignmentNotFound, deviceID)
+	}
+	return s.evaluateRecipe(assignment, time.Now())
+}
+
+func (s *ControlHandlerService) ReturnRecipeStatuses() ([]RecipeStatus, error) {
+	assignments := s.recipeState.GetAssignments()
+	statuses := make([]RecipeStatus, 0, len(assignments))
+	for _, assignment := range assignments {
+		status, err := s.evaluateRecipe(assignment, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// AssignCropRecipe starts a recipe on a device from the start date. The
+// set-points are shared by all devices, so only one device can run a recipe
+// at a time.
+func (s *ControlHandlerService) AssignCropRecipe(assignment state.RecipeAssignment) (RecipeStatus, error) {
+	var log = logger.Logger()
+
+	if assignment.DeviceID == "" {
+		assignment.DeviceID = state.DefaultDeviceID
+	}
+	recipe, ok := s.recipeState.Get(assignment.Recipe)
+	if !ok {
+		return RecipeStatus{}, fmt.Errorf("%w: %s", errCropRecipeNotFound, assignment.Recipe)
+	}
+	if _, err := assignment.Start(); err != nil {
+		return RecipeStatus{}, fmt.Errorf("%w: %w", errCropRecipeInvalid, err)
+	}
+	if _, ok := recipe.StageIndex(assignment.StageOverride); assignment.StageOverride != "" && !ok {
+		return RecipeStatus{}, fmt.Errorf("%w: recipe %s has no stage %s", errCropRecipeInvalid, recipe.Name, assignment.StageOverride)
+	}
+	for _, other := range s.recipeState.GetAssignments() {
+		if other.DeviceID != assignment.DeviceID {
+			return RecipeStatus{}, fmt.Errorf("%w: device %s already runs recipe %s", errCropRecipeInUse, other.DeviceID, other.Recipe)
+		}
+	}
+
+	assignment.AssignedAt = time.Now()
+	if err := s.commitRecipeAssignment(assignment); err != nil {
+		return RecipeStatus{}, err
+	}
+	log.Infof("[INFO] api.web.AssignCropRecipe | recipe %s assigned to device %s from %s",
+		recipe.Name, assignment.DeviceID, assignment.StartDate)
+	return s.applyRecipe(assignment, time.Now())
+}
+
+// UnassignCropRecipe stops the recipe of a device. temp_sp and the light
+// schedule keep their last values; moisture and humidity return to the
+// configured automation.
+func (s *ControlHandlerService) UnassignCropRecipe(deviceID string) error {
+	var log = logger.Logger()
+
+	if _, ok := s.recipeState.GetAssignment(deviceID); !ok {
+		return fmt.Errorf("%w: device %s", errRecipeAssignmentNotFound, deviceID)
+	}
+	if err := dao.DeleteRecipeAssignment(deviceID); err != nil {
+		log.Errorf("[ERROR] api.web.UnassignCropRecipe | failed to delete recipe assignment of %s: %s", deviceID, err.Error())
+		return err
+	}
+
+	s.recipeState.DeleteAssignment(deviceID)
+	for _, variable := range []state.ConditionVariable{state.HumidityMin, state.HumidityMax, state.MoistureMin, state.MoistureMax} {
+		s.modelState.Delete(variable)
+	}
+	log.Infof("[INFO] api.web.UnassignCropRecipe | recipe of device %s removed", deviceID)
+	return nil
+}
+
+// OverrideRecipeStage holds a device in the named stage until the override
+// is cleared with an empty stage, which returns it to the stage that is due.
+func (s *ControlHandlerService) OverrideRecipeStage(deviceID string, stage string) (RecipeStatus, error) {
+	var log = logger.Logger()
+
+	assignment, ok := s.recipeState.GetAssignment(deviceID)
+	if !ok {
+		return RecipeStatus{}, fmt.Errorf("%w: device %s", errRecipeAssignmentNotFound, deviceID)
+	}
+	recipe, ok := s.recipeState.Get(assignment.Recipe)
+	if !ok {
+		return RecipeStatus{}, fmt.Errorf("%w: %s", errCropRecipeNotFound, assignment.Recipe)
+	}
+	if _, ok := recipe.StageIndex(stage); stage != "" && !ok {
+		return RecipeStatus{}, fmt.Errorf("%w: recipe %s has no stage %s", errCropRecipeInvalid, recipe.Name, stage)
+	}
+
+	assignment.StageOverride = stage
+	if err := s.commitRecipeAssignment(assignment); err != nil {
+		return RecipeStatus{}, err
+	}
+	if stage == "" {
+		log.Infof("[INFO] api.web.OverrideRecipeStage | stage override of device %s cleared", deviceID)
+	} else {
+		log.Infof("[INFO] api.web.OverrideRecipeStage | device %s held in stage %s", deviceID, stage)
+	}
+	return s.applyRecipe(assignment, time.Now())
+}
+
+// StartRecipeJob applies the recipe targets right away and then checks every
+// recipe interval whether a stage or the day/night period has changed.
+func (s *ControlHandlerService) StartRecipeJob() {
+	go func() {
+		s.runRecipes()
+		ticker := time.NewTicker(recipeInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.runRecipes()
+		}
+	}()
+}
+
+func (s *ControlHandlerService) runRecipes() {
+	var log = logger.Logger()
+
+	for _, assignment := range s.recipeState.GetAssignments() {
+		if _, err := s.applyRecipe(assignment, time.Now()); err != nil {
+			log.Errorf("[ERROR] api.web.runRecipes | failed to apply the recipe of device %s: %s", assignment.DeviceID, err.Error())
+		}
+	}
+}
+
+// applyRecipe pushes the targets of the current stage and period into the
+// model state, the moisture and humidity automation and the light schedule.
+// It only does so when they changed since the last successful call, so an
+// operator can still adjust a set-point until the next stage or period
+// begins, while a failed push is retried on the next run.
+func (s *ControlHandlerService) applyRecipe(assignment state.RecipeAssignment, now time.Time) (RecipeStatus, error) {
+	var log = logger.Logger()
+
+	status, err := s.evaluateRecipe(assignment, now)
+	if err != nil || status.Stage == nil {
+		return status, err
+	}
+	key := fmt.Sprintf("%s/%s/%s", assignment.Recipe, status.Stage.Name, status.Period)
+	if s.recipeState.IsApplied(assignment.DeviceID, key) {
+		return status, nil
+	}
+
+	stage := *status.Stage
+	if err := s.validateGrowthStage(stage); err != nil {
+		log.Errorf("[ERROR] api.web.applyRecipe | targets of stage %s not applied: %s", stage.Name, err.Error())
+		return status, err
+	}
+	setPoint := stage.TemperatureNightSP
+	if status.Period == recipePeriodDay {
+		setPoint = stage.TemperatureDaySP
+	}
+	s.modelState.Set(state.TemperatureSP, setPoint)
+	s.modelState.Set(state.HumidityMin, stage.HumidityMin)
+	s.modelState.Set(state.HumidityMax, stage.HumidityMax)
+	s.modelState.Set(state.MoistureMin, stage.MoistureMin)
+	s.modelState.Set(state.MoistureMax, stage.MoistureMax)
+
+	schedule := s.lightState.GetSchedule()
+	if photoperiod := schedule.WithPhotoperiod(stage.PhotoperiodHours); photoperiod != schedule {
+		if err := s.SetLightSchedule(photoperiod); err != nil {
+			return status, err
+		}
+	}
+	s.recipeState.MarkApplied(assignment.DeviceID, key)
+
+	log.Infof("[INFO] api.web.applyRecipe | device %s: recipe %s, stage %s (%s), temp_sp %g",
+		assignment.DeviceID, assignment.Recipe, stage.Name, status.Period, setPoint)
+	return status, nil
+}
+
+// evaluateRecipe works out the stage and the day/night period of an
+// assignment at now. The period follows the photoperiod of the stage.
+func (s *ControlHandlerService) evaluateRecipe(assignment state.RecipeAssignment, now time.Time) (RecipeStatus, error) {
+	status := RecipeStatus{RecipeAssignment: assignment, StageIndex: -1}
+	recipe, ok := s.recipeState.Get(assignment.Recipe)
+	if !ok {
+		return status, fmt.Errorf("%w: %s", errCropRecipeNotFound, assignment.Recipe)
+	}
+	start, err := assignment.Start()
+	if err != nil {
+		return status, fmt.Errorf("%w: %w", errCropRecipeInvalid, err)
+	}
+
+	index, from, to, finished := recipe.StageAt(start, now)
+	if index >= 0 {
+		status.DueStage = recipe.Stages[index].Name
+		status.StageStart = from.Format(time.RFC3339)
+	}
+	status.StageEnd = to.Format(time.RFC3339)
+	status.Finished = finished
+	if override, ok := recipe.StageIndex(assignment.StageOverride); assignment.StageOverride != "" && ok {
+		index = override
+	}
+	if index < 0 {
+		return status, nil
+	}
+
+	stage := recipe.Stages[index]
+	status.Stage, status.StageIndex = &stage, index
+	schedule := s.lightState.GetSchedule().WithPhotoperiod(stage.PhotoperiodHours)
+	local := now.In(s.controlConfig.ScheduleLocation())
+	dayStart, dayEnd := schedule.Window(local)
+	status.Period = recipePeriodNight
+	if !local.Before(dayStart) && local.Before(dayEnd) {
+		status.Period = recipePeriodDay
+	}
+	return status, nil
+}
+
+func (s *ControlHandlerService) commitCropRecipe(recipe state.CropRecipe) (state.CropRecipe, error) {
+	var log = logger.Logger()
+
+	if err := recipe.Validate(); err != nil {
+		return state.CropRecipe{}, fmt.Errorf("%w: %w", errCropRecipeInvalid, err)
+	}
+	for _, stage := range recipe.Stages {
+		if err := s.validateGrowthStage(stage); err != nil {
+			return state.CropRecipe{}, err
+		}
+	}
+
+	recipe.UpdatedAt = time.Now()
+	entity := dao.CropRecipeEntity{Recipe: recipe}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.commitCropRecipe | failed to commit crop recipe entity: %s", err.Error())
+		return state.CropRecipe{}, err
+	}
+
+	s.recipeState.Set(recipe)
+	log.Debugf("[DEBUG] api.web.commitCropRecipe | crop recipe: %+v", recipe)
+	return recipe, nil
+}
+
+func (s *ControlHandlerService) commitRecipeAssignment(assignment state.RecipeAssignment) error {
+	var log = logger.Logger()
+
+	entity := dao.RecipeAssignmentEntity{Assignment: assignment}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.commitRecipeAssignment | failed to commit recipe assignment entity: %s", err.Error())
+		return err
+	}
+	s.recipeState.SetAssignment(assignment)
+	return nil
+}
+
+// validateGrowthStage checks the temperature set-points of a stage against
+// the configured temp_sp range.
+func (s *ControlHandlerService) validateGrowthStage(stage state.GrowthStage) error {
+	for _, setPoint := range []float64{stage.TemperatureDaySP, stage.TemperatureNightSP} {
+		if setPoint < s.controlConfig.TemperatureSPMin || setPoint > s.controlConfig.TemperatureSPMax {
+			return fmt.Errorf("%w: stage %s: temp_sp %g is outside the allowed range [%g, %g]", errCropRecipeInvalid,
+				stage.Name, setPoint, s.controlConfig.TemperatureSPMin, s.controlConfig.TemperatureSPMax)
+		}
+	}
+	return nil
+}
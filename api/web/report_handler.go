@@ -0,0 +1,280 @@
+package web
+
+import (
+	"Solflora/logger"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+type ReportVariableSummary struct {
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Avg     float64 `json:"avg"`
+	Samples int64   `json:"samples"`
+}
+
+// ReportTargetBand is the time temp_pv stayed within Band of temp_sp;
+// Percent refers to the time covered by samples.
+type ReportTargetBand struct {
+	Band    float64 `json:"band"`
+	Seconds float64 `json:"seconds"`
+	Percent float64 `json:"percent"`
+}
+
+type ReportRunSummary struct {
+	Activations    int64   `json:"activations"`
+	RuntimeSeconds float64 `json:"runtime_seconds"`
+}
+
+type ReportPumpSummary struct {
+	ReportRunSummary
+	DeliveredML float64 `json:"delivered_ml"`
+}
+
+type ReportAlarmCount struct {
+	Source string `json:"source"`
+	Code   string `json:"code"`
+	Count  int64  `json:"count"`
+}
+
+type ReportSetPointChange struct {
+	Time string  `json:"time"`
+	From float64 `json:"from"`
+	To   float64 `json:"to"`
+}
+
+// DailyReport summarizes one device and calendar day. Complete is false for
+// a report generated before the day was over. The variable summaries are nil
+// when the day has no good samples.
+type DailyReport struct {
+	DeviceID          string                 `json:"device_id"`
+	Date              string                 `json:"date"`
+	TimeZone          string                 `json:"time_zone"`
+	GeneratedAt       string                 `json:"generated_at"`
+	Complete          bool                   `json:"complete"`
+	Temperature       *ReportVariableSummary `json:"temperature"`
+	Humidity          *ReportVariableSummary `json:"humidity"`
+	Moisture          *ReportVariableSummary `json:"moisture"`
+	TemperatureInBand *ReportTargetBand      `json:"temperature_in_band"`
+	Pump              ReportPumpSummary      `json:"pump"`
+	Fan               ReportRunSummary       `json:"fan"`
+	AlarmTotal        int64                  `json:"alarm_total"`
+	Alarms            []ReportAlarmCount     `json:"alarms"`
+	SetPointChanges   []ReportSetPointChange `json:"set_point_changes"`
+	TuneChanges       []TuneProfileRevision  `json:"tune_changes"`
+}
+
+type DailyReportIndexEntry struct {
+	DeviceID    string `json:"device_id"`
+	Date        string `json:"date"`
+	GeneratedAt string `json:"generated_at"`
+	Complete    bool   `json:"complete"`
+}
+
+type DailyReportRequestBody struct {
+	DeviceID string `json:"device_id"`
+	Date     string `json:"date"`
+}
+
+var dailyReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"hours": func(seconds float64) float64 { return seconds / 3600 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Daily report {{.Date}} – {{.DeviceID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+</style>
+</head>
+<body>
+<h1>Daily report {{.Date}}</h1>
+<p>Device {{.DeviceID}} · {{.TimeZone}} · generated {{.GeneratedAt}}{{if not .Complete}} (day not complete){{end}}</p>
+
+<h2>Climate</h2>
+<table>
+<tr><th>Variable</th><th>Min</th><th>Max</th><th>Avg</th><th>Samples</th></tr>
+{{with .Temperature}}<tr><td>Temperature (°C)</td><td>{{printf "%.1f" .Min}}</td><td>{{printf "%.1f" .Max}}</td><td>{{printf "%.1f" .Avg}}</td><td>{{.Samples}}</td></tr>{{end}}
+{{with .Humidity}}<tr><td>Humidity (%RH)</td><td>{{printf "%.1f" .Min}}</td><td>{{printf "%.1f" .Max}}</td><td>{{printf "%.1f" .Avg}}</td><td>{{.Samples}}</td></tr>{{end}}
+{{with .Moisture}}<tr><td>Moisture (%)</td><td>{{printf "%.1f" .Min}}</td><td>{{printf "%.1f" .Max}}</td><td>{{printf "%.1f" .Avg}}</td><td>{{.Samples}}</td></tr>{{end}}
+</table>
+{{with .TemperatureInBand}}<p>Temperature within ±{{.Band}} °C of the setpoint: {{printf "%.1f" .Percent}} % ({{printf "%.1f" (hours .Seconds)}} h)</p>{{end}}
+
+<h2>Actuators</h2>
+<table>
+<tr><th>Actuator</th><th>Activations</th><th>Runtime (h)</th></tr>
+<tr><td>Water pump ({{printf "%.0f" .Pump.DeliveredML}} ml)</td><td>{{.Pump.Activations}}</td><td>{{printf "%.2f" (hours .Pump.RuntimeSeconds)}}</td></tr>
+<tr><td>Fan</td><td>{{.Fan.Activations}}</td><td>{{printf "%.2f" (hours .Fan.RuntimeSeconds)}}</td></tr>
+</table>
+
+<h2>Alarms ({{.AlarmTotal}})</h2>
+{{if .Alarms}}<table>
+<tr><th>Source</th><th>Code</th><th>Count</th></tr>
+{{range .Alarms}}<tr><td>{{.Source}}</td><td>{{.Code}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+
+<h2>Setpoint changes</h2>
+{{if .SetPointChanges}}<table>
+<tr><th>Time</th><th>From</th><th>To</th></tr>
+{{range .SetPointChanges}}<tr><td>{{.Time}}</td><td>{{.From}}</td><td>{{.To}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+
+<h2>Tune changes</h2>
+{{if .TuneChanges}}<table>
+<tr><th>Time</th><th>Kp</th><th>Ki</th><th>Kd</th><th>Author</th></tr>
+{{range .TuneChanges}}<tr><td>{{.Timestamp}}</td><td>{{.ProportionalGain}}</td><td>{{.IntegralGain}}</td><td>{{.DerivativeGain}}</td><td>{{.Author}}{{with .Preset}} (preset {{.}}){{end}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+</body>
+</html>
+`))
+
+// ReturnDailyReport returns a stored report as JSON, or as an HTML page with
+// format=html.
+func ReturnDailyReport(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnDailyReport")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnDailyReport | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		deviceID := mapQueryParamToDeviceID(query.Get("device_id"))
+		date := query.Get("date")
+		if _, err := reportDay(date); err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnDailyReport | query parameter are not valid | error: %s", err)
+			return
+		}
+		format := query.Get("format")
+		if format != "" && format != "json" && format != "html" {
+			http.Error(w, "Invalid format query parameter (json or html)", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnDailyReport | unknown format: %s", format)
+			return
+		}
+
+		report, ok, err := service.ReturnDailyReport(deviceID, date)
+		if err != nil {
+			http.Error(w, "Internal Server Error – ReturnDailyReport failed", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.ReturnDailyReport | ReturnDailyReport failed | err: %s", err)
+			return
+		}
+		if !ok {
+			http.Error(w, "Not Found – no report of "+date+" for device", http.StatusNotFound)
+			log.Errorf("[ERROR] api.web.ReturnDailyReport | no %s report for device %s", date, deviceID)
+			return
+		}
+
+		if format == "html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if err := dailyReportTemplate.Execute(w, report); err != nil {
+				log.Errorf("[ERROR] api.web.ReturnDailyReport | failed to render report: %s", err)
+			}
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(report)
+		}
+
+		log.Info("[END] api.web.ReturnDailyReport")
+	}
+}
+
+// GenerateDailyReport (re)generates the report of a day on demand; today's
+// report is marked incomplete.
+func GenerateDailyReport(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.GenerateDailyReport")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.GenerateDailyReport | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody DailyReportRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.GenerateDailyReport | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.GenerateDailyReport | request body: %+v\n", reqBody)
+
+		day, err := reportDay(reqBody.Date)
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.GenerateDailyReport | request body not valid | error: %s", err)
+			return
+		}
+		if day.After(time.Now()) {
+			http.Error(w, "Bad Request – date "+reqBody.Date+" is in the future", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.GenerateDailyReport | date %s is in the future", reqBody.Date)
+			return
+		}
+
+		report, err := service.GenerateDailyReport(mapQueryParamToDeviceID(reqBody.DeviceID), reqBody.Date)
+		if err != nil {
+			http.Error(w, "Internal Server Error – failed to generate daily report", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.GenerateDailyReport | failed to generate daily report: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+
+		log.Info("[END] api.web.GenerateDailyReport")
+	}
+}
+
+// ReturnDailyReportIndex lists the stored reports between the dates from and
+// to (YYYY-MM-DD, both included); without them the last 30 days are listed.
+func ReturnDailyReportIndex(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnDailyReportIndex")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnDailyReportIndex | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		to, from := query.Get("to"), query.Get("from")
+		if to == "" {
+			to = time.Now().Format(reportDateLayout)
+		}
+		toDay, err := reportDay(to)
+		if err == nil && from == "" {
+			from = toDay.AddDate(0, 0, -30).Format(reportDateLayout)
+		}
+		if err == nil {
+			_, err = reportDay(from)
+		}
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnDailyReportIndex | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		entries, err := service.ReturnDailyReportIndex(query.Get("device_id"), from, to)
+		if err != nil {
+			http.Error(w, "Internal Server Error – ReturnDailyReportIndex failed", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.ReturnDailyReportIndex | ReturnDailyReportIndex failed | err: %s", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+
+		log.Info("[END] api.web.ReturnDailyReportIndex")
+	}
+}
@@ -0,0 +1,267 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	reportDateLayout = "2006-01-02"
+	// reportBackfillDays is how many completed days the report job looks
+	// back for missing reports, for example after the server was down.
+	reportBackfillDays = 7
+)
+
+// StartReportJob generates the missing reports of completed days right away
+// and then every report interval. A report generated on request before its
+// day ended is replaced by a complete one the same way.
+func (s *ControlHandlerService) StartReportJob() {
+	go func() {
+		s.runReports()
+		ticker := time.NewTicker(s.reportConfig.Interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.runReports()
+		}
+	}()
+}
+
+func (s *ControlHandlerService) runReports() {
+	var log = logger.Logger()
+	log.Debug("[START] api.web.runReports")
+
+	now := time.Now()
+	today := now.Format(reportDateLayout)
+	oldest, _ := reportDay(today)
+	oldest = oldest.AddDate(0, 0, -reportBackfillDays)
+	index, err := dao.LoadDailyReportIndex("", oldest.Format(reportDateLayout), today)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.runReports | failed to load report index: %s", err.Error())
+		return
+	}
+	complete := make(map[string]bool, len(index))
+	for _, entity := range index {
+		complete[entity.DeviceID+"/"+entity.Day] = entity.Complete
+	}
+
+	generated := 0
+	for day := oldest; day.Format(reportDateLayout) != today; day = day.AddDate(0, 0, 1) {
+		date := day.Format(reportDateLayout)
+		// the report is built from raw samples; once the raw retention has
+		// deleted the start of a day it would only cover the rest of it
+		if s.retentionConfig.Raw > 0 && day.Before(now.Add(-s.retentionConfig.Raw)) {
+			continue
+		}
+		devices, err := dao.ReportDevices(day, day.AddDate(0, 0, 1))
+		if err != nil {
+			log.Errorf("[ERROR] api.web.runReports | failed to load the devices of %s: %s", date, err.Error())
+			return
+		}
+		for _, deviceID := range devices {
+			if complete[deviceID+"/"+date] {
+				continue
+			}
+			if _, err := s.GenerateDailyReport(deviceID, date); err != nil {
+				log.Errorf("[ERROR] api.web.runReports | failed to generate the %s report of %s: %s", date, deviceID, err.Error())
+				continue
+			}
+			generated++
+		}
+	}
+
+	log.Debugf("[END] api.web.runReports | %d reports generated", generated)
+}
+
+// GenerateDailyReport summarizes one calendar day of the server time zone
+// and stores the report, replacing an earlier one of the same day. Alarms
+// are not tied to a device, so every report of a day lists all of them.
+func (s *ControlHandlerService) GenerateDailyReport(deviceID string, date string) (DailyReport, error) {
+	var log = logger.Logger()
+
+	from, err := reportDay(date)
+	if err != nil {
+		return DailyReport{}, err
+	}
+	to := from.AddDate(0, 0, 1)
+	now := time.Now()
+	if from.After(now) {
+		return DailyReport{}, fmt.Errorf("date %s is in the future", date)
+	}
+
+	report := DailyReport{
+		DeviceID:    deviceID,
+		Date:        date,
+		TimeZone:    time.Local.String(),
+		GeneratedAt: now.Format(time.RFC3339),
+		Complete:    !to.After(now),
+	}
+
+	variables := []struct {
+		table   string
+		summary **ReportVariableSummary
+	}{
+		{"temperature", &report.Temperature},
+		{"humidity", &report.Humidity},
+		{"moisture", &report.Moisture},
+	}
+	for _, variable := range variables {
+		entity, err := dao.SummarizeSamples(variable.table, deviceID, from, to)
+		if err != nil {
+			log.Errorf("[ERROR] api.web.GenerateDailyReport | failed to summarize %s: %s", variable.table, err.Error())
+			return DailyReport{}, err
+		}
+		if entity.Count > 0 {
+			*variable.summary = &ReportVariableSummary{Min: entity.Min, Max: entity.Max, Avg: entity.Avg, Samples: entity.Count}
+		}
+	}
+
+	samples, err := dao.LoadLoopSamples(deviceID, from, to)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.GenerateDailyReport | failed to load temperature rows: %s", err.Error())
+		return DailyReport{}, err
+	}
+	report.TemperatureInBand, report.SetPointChanges = s.summarizeTemperatureLoop(samples)
+
+	pumpRuns, err := dao.SummarizePumpRuns(deviceID, from, to)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.GenerateDailyReport | failed to summarize pump runs: %s", err.Error())
+		return DailyReport{}, err
+	}
+	report.Pump = ReportPumpSummary{
+		ReportRunSummary: ReportRunSummary{Activations: pumpRuns.Count, RuntimeSeconds: pumpRuns.Runtime.Seconds()},
+		DeliveredML:      pumpRuns.DeliveredML,
+	}
+
+	fanRuns, err := dao.SummarizeFanRuns(deviceID, from, to)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.GenerateDailyReport | failed to summarize fan runs: %s", err.Error())
+		return DailyReport{}, err
+	}
+	report.Fan = ReportRunSummary{Activations: fanRuns.Count, RuntimeSeconds: fanRuns.Runtime.Seconds()}
+	// a fan that is still on has no stored run yet; it belongs to the report
+	// of the device that switched it on
+	if onSince, ok := s.fanState.OnSince(deviceID); ok {
+		end := now
+		if to.Before(end) {
+			end = to
+		}
+		if onSince.Before(from) {
+			onSince = from
+		}
+		if end.After(onSince) {
+			report.Fan.Activations++
+			report.Fan.RuntimeSeconds += end.Sub(onSince).Seconds()
+		}
+	}
+
+	alarms, err := dao.CountAlarms(from, to)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.GenerateDailyReport | failed to count alarms: %s", err.Error())
+		return DailyReport{}, err
+	}
+	report.Alarms = make([]ReportAlarmCount, 0, len(alarms))
+	for _, alarm := range alarms {
+		report.Alarms = append(report.Alarms, ReportAlarmCount{Source: alarm.Source, Code: alarm.Code, Count: alarm.Count})
+		report.AlarmTotal += alarm.Count
+	}
+
+	tuneChanges, err := s.ReturnTuneProfileHistory(timeRange{From: from, To: to}, maxTuneHistoryLimit)
+	if err != nil {
+		return DailyReport{}, err
+	}
+	report.TuneChanges = mapTimeStampToSpecifiedFormatForTuneProfiles(tuneChanges, time.Local)
+
+	document, err := json.Marshal(report)
+	if err != nil {
+		return DailyReport{}, err
+	}
+	entity := dao.DailyReportEntity{DeviceID: deviceID, Day: date, Document: document, GeneratedAt: now, Complete: report.Complete}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.GenerateDailyReport | failed to commit daily report entity: %s", err.Error())
+		return DailyReport{}, err
+	}
+
+	log.Infof("[INFO] api.web.GenerateDailyReport | %s report of %s generated", date, deviceID)
+	return report, nil
+}
+
+func (s *ControlHandlerService) ReturnDailyReport(deviceID string, date string) (DailyReport, bool, error) {
+	var log = logger.Logger()
+
+	entity, ok, err := dao.LoadDailyReport(deviceID, date)
+	if err != nil || !ok {
+		return DailyReport{}, ok, err
+	}
+	var report DailyReport
+	if err := json.Unmarshal(entity.Document, &report); err != nil {
+		log.Errorf("[ERROR] api.web.ReturnDailyReport | stored %s report of %s is not valid: %s", date, deviceID, err.Error())
+		return DailyReport{}, false, err
+	}
+	return report, true, nil
+}
+
+func (s *ControlHandlerService) ReturnDailyReportIndex(deviceID string, from string, to string) ([]DailyReportIndexEntry, error) {
+	var log = logger.Logger()
+
+	entities, err := dao.LoadDailyReportIndex(deviceID, from, to)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.ReturnDailyReportIndex | failed to load report index: %s", err.Error())
+		return nil, err
+	}
+	entries := make([]DailyReportIndexEntry, 0, len(entities))
+	for _, entity := range entities {
+		entries = append(entries, DailyReportIndexEntry{
+			DeviceID:    entity.DeviceID,
+			Date:        entity.Day,
+			GeneratedAt: entity.GeneratedAt.In(time.Local).Format(time.RFC3339),
+			Complete:    entity.Complete,
+		})
+	}
+	return entries, nil
+}
+
+// summarizeTemperatureLoop returns the time temp_pv stayed within the report
+// band of temp_sp and every temp_sp change of the samples.
+func (s *ControlHandlerService) summarizeTemperatureLoop(samples []dao.LoopSampleEntity) (*ReportTargetBand, []ReportSetPointChange) {
+	changes := []ReportSetPointChange{}
+	if len(samples) == 0 {
+		return nil, changes
+	}
+
+	band := &ReportTargetBand{Band: s.reportConfig.TemperatureBand}
+	var covered float64
+	for i := 1; i < len(samples); i++ {
+		if samples[i].SetPoint != samples[i-1].SetPoint {
+			changes = append(changes, ReportSetPointChange{
+				Time: samples[i].CreatedAt.In(time.Local).Format(time.RFC3339),
+				From: samples[i-1].SetPoint,
+				To:   samples[i].SetPoint,
+			})
+		}
+		dt := samples[i].CreatedAt.Sub(samples[i-1].CreatedAt)
+		if dt <= 0 || dt > loopPerformanceMaxGap {
+			continue
+		}
+		covered += dt.Seconds()
+		if math.Abs(samples[i].SetPoint-samples[i].PresentValue) <= band.Band {
+			band.Seconds += dt.Seconds()
+		}
+	}
+	if covered > 0 {
+		band.Percent = band.Seconds / covered * 100
+	}
+	return band, changes
+}
+
+// reportDay returns the start of a calendar day of the server time zone.
+func reportDay(date string) (time.Time, error) {
+	day, err := time.ParseInLocation(reportDateLayout, date, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date %q is not a YYYY-MM-DD date", date)
+	}
+	return day, nil
+}
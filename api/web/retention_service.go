@@ -0,0 +1,209 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/db"
+	"Solflora/logger"
+	"Solflora/state"
+	"fmt"
+	"time"
+)
+
+type dataResolution string
+
+const (
+	resolutionRaw    dataResolution = "raw"
+	resolutionHourly dataResolution = "hourly"
+	resolutionDaily  dataResolution = "daily"
+)
+
+var rollupTables = map[dataResolution]string{
+	resolutionHourly: dao.RollupHourlyTable,
+	resolutionDaily:  dao.RollupDailyTable,
+}
+
+// StartRollupJob computes the hourly and daily rollups and deletes expired
+// data right away and then every rollup interval.
+func (s *ControlHandlerService) StartRollupJob() {
+	go func() {
+		s.runRollups()
+		ticker := time.NewTicker(s.retentionConfig.RollupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.runRollups()
+		}
+	}()
+}
+
+func (s *ControlHandlerService) runRollups() {
+	var log = logger.Logger()
+	log.Debug("[START] api.web.runRollups")
+	start := time.Now()
+
+	hourlySince, err := dao.LatestRollupBucket(dao.RollupHourlyTable)
+	if err == nil {
+		err = dao.RollUpHourly(hourlySince)
+	}
+	if err != nil {
+		log.Errorf("[ERROR] api.web.runRollups | hourly rollup failed, expired data is kept: %s", err.Error())
+		return
+	}
+	dailySince, err := dao.LatestRollupBucket(dao.RollupDailyTable)
+	if err == nil {
+		err = dao.RollUpDaily(dailySince)
+	}
+	if err != nil {
+		log.Errorf("[ERROR] api.web.runRollups | daily rollup failed, expired data is kept: %s", err.Error())
+		return
+	}
+
+	if s.retentionConfig.Raw > 0 {
+		for _, table := range dao.RawTables {
+			s.deleteExpired(table, "created_at", start.Add(-s.retentionConfig.Raw))
+		}
+	}
+	if s.retentionConfig.Hourly > 0 {
+		s.deleteExpired(dao.RollupHourlyTable, "bucket", start.Add(-s.retentionConfig.Hourly))
+	}
+	if s.retentionConfig.Daily > 0 {
+		s.deleteExpired(dao.RollupDailyTable, "bucket", start.Add(-s.retentionConfig.Daily))
+	}
+
+	log.Debugf("[END] api.web.runRollups | took %s", time.Since(start))
+}
+
+func (s *ControlHandlerService) deleteExpired(table string, column string, before time.Time) {
+	var log = logger.Logger()
+
+	deleted, err := dao.DeleteBefore(table, column, before)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.deleteExpired | failed to delete expired rows of %s: %s", table, err.Error())
+		return
+	}
+	if deleted > 0 {
+		log.Infof("[INFO] api.web.deleteExpired | %d rows of %s older than %s deleted", deleted, table, before.Format(time.RFC3339))
+	}
+}
+
+// dataResolution picks raw samples while they are kept and fine enough for
+// the sampling, else the finest rollup that still covers the range.
+func (s *ControlHandlerService) dataResolution(tr timeRange, sampling time.Duration) dataResolution {
+	age := time.Since(tr.From)
+	if sampling < time.Hour && (s.retentionConfig.Raw == 0 || age <= s.retentionConfig.Raw) {
+		return resolutionRaw
+	}
+	if sampling < 24*time.Hour && (s.retentionConfig.Hourly == 0 || age <= s.retentionConfig.Hourly) {
+		return resolutionHourly
+	}
+	return resolutionDaily
+}
+
+// queryRollupSeries reads the buckets of a variable; without a device the
+// devices' buckets are combined weighted by their sample count.
+func (s *ControlHandlerService) queryRollupSeries(
+	resolution dataResolution,
+	variable state.ConditionVariable,
+	deviceID string,
+	tr timeRange) ([]SeriesChartDataEntry, error) {
+
+	var log = logger.Logger()
+
+	table, ok := rollupTables[resolution]
+	if !ok {
+		return nil, fmt.Errorf("no rollup table for resolution [%s]", resolution)
+	}
+	query := `
+		SELECT bucket,
+		       SUM(avg_value * sample_count) / SUM(sample_count),
+		       SUM(filtered_avg * sample_count) / NULLIF(SUM(CASE WHEN filtered_avg IS NOT NULL THEN sample_count END), 0),
+		       MIN(min_value), MAX(max_value), SUM(sample_count)
+		FROM ` + table + `
+		WHERE variable = $1 AND bucket >= $2 AND bucket < $3`
+	args := []any{variable, tr.From, tr.To}
+	if deviceID != "" {
+		args = append(args, deviceID)
+		query += fmt.Sprintf(" AND device_id = $%d", len(args))
+	}
+	query += " GROUP BY bucket ORDER BY bucket"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.queryRollupSeries | failed to retrieve %s %s rollups (range: %s – %s): %s", resolution, variable, tr.From, tr.To, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []SeriesChartDataEntry
+	for rows.Next() {
+		var entry SeriesChartDataEntry
+		var minValue, maxValue float64
+		var count int64
+		if err := rows.Scan(&entry.Timestamp, &entry.Value, &entry.FilteredValue, &minValue, &maxValue, &count); err != nil {
+			log.Errorf("[ERROR] api.web.queryRollupSeries | failed to scan row: %s", err.Error())
+			return nil, err
+		}
+		entry.Min, entry.Max, entry.Count = &minValue, &maxValue, &count
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *ControlHandlerService) returnTemperatureRollupChartData(resolution dataResolution, tr timeRange) ([]TemperatureChartDataEntry, error) {
+	pv, err := s.queryRollupSeries(resolution, state.TemperaturePV, "", tr)
+	if err != nil {
+		return nil, err
+	}
+	co, err := s.queryRollupSeries(resolution, state.TemperatureCO, "", tr)
+	if err != nil {
+		return nil, err
+	}
+	sp, err := s.queryRollupSeries(resolution, state.TemperatureSP, "", tr)
+	if err != nil {
+		return nil, err
+	}
+
+	coByTime := make(map[string]float64, len(co))
+	for _, entry := range co {
+		coByTime[entry.Timestamp] = entry.Value
+	}
+	spByTime := make(map[string]float64, len(sp))
+	for _, entry := range sp {
+		spByTime[entry.Timestamp] = entry.Value
+	}
+
+	entries := make([]TemperatureChartDataEntry, 0, len(pv))
+	for _, entry := range pv {
+		entries = append(entries, TemperatureChartDataEntry{
+			TemperaturePV:         entry.Value,
+			TemperatureFilteredPV: entry.FilteredValue,
+			TemperatureCO:         coByTime[entry.Timestamp],
+			TemperatureSP:         spByTime[entry.Timestamp],
+			Timestamp:             entry.Timestamp,
+		})
+	}
+	return entries, nil
+}
+
+func (s *ControlHandlerService) returnHumidityRollupChartData(resolution dataResolution, tr timeRange) ([]HumidityChartDataEntry, error) {
+	series, err := s.queryRollupSeries(resolution, state.HumidityPV, "", tr)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]HumidityChartDataEntry, 0, len(series))
+	for _, entry := range series {
+		entries = append(entries, HumidityChartDataEntry{HumidityPV: entry.Value, HumidityFilteredPV: entry.FilteredValue, Timestamp: entry.Timestamp})
+	}
+	return entries, nil
+}
+
+func (s *ControlHandlerService) returnMoistureRollupChartData(resolution dataResolution, tr timeRange) ([]MoistureChartDataEntry, error) {
+	series, err := s.queryRollupSeries(resolution, state.MoisturePV, "", tr)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]MoistureChartDataEntry, 0, len(series))
+	for _, entry := range series {
+		entries = append(entries, MoistureChartDataEntry{MoisturePV: entry.Value, MoistureFilteredPV: entry.FilteredValue, Timestamp: entry.Timestamp})
+	}
+	return entries, nil
+}
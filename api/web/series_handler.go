@@ -0,0 +1,135 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// SeriesChartDataEntry carries min, max and count when it is read from a
+// rollup, where value is the bucket average.
+type SeriesChartDataEntry struct {
+	Value         float64  `json:"value"`
+	FilteredValue *float64 `json:"filtered"`
+	Min           *float64 `json:"min,omitempty"`
+	Max           *float64 `json:"max,omitempty"`
+	Count         *int64   `json:"count,omitempty"`
+	Timestamp     string   `json:"time"`
+	TimestampMs   int64    `json:"time_ms"`
+}
+
+// SeriesChartResponseBody carries the tune profile changes of the range as
+// chart markers when the variable is the temperature, and the pump or fan
+// transitions as an overlay for moisture and humidity.
+type SeriesChartResponseBody struct {
+	Variable       state.ConditionVariable `json:"variable"`
+	Unit           string                  `json:"unit"`
+	Resolution     dataResolution          `json:"resolution"`
+	Entries        []SeriesChartDataEntry  `json:"entries"`
+	TuneMarkers    []TuneProfileRevision   `json:"tune_markers,omitempty"`
+	ActuatorEvents []ActuatorHistoryEntry  `json:"actuator_events,omitempty"`
+}
+
+func ReturnVariables(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnVariables")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnVariables | method not allowed: %s", r.Method)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(service.variableRegistry.GetAll())
+
+		log.Info("[END] api.web.ReturnVariables")
+	}
+}
+
+func ReturnSeriesChartData(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnSeriesChartData")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnSeriesChartData | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		definition, ok := service.variableRegistry.Get(state.ConditionVariable(query.Get("variable")))
+		if !ok {
+			http.Error(w, "Invalid variable query parameter", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnSeriesChartData | unknown variable: %s", query.Get("variable"))
+			return
+		}
+		tr, err := mapQueryParamsToTimeRange(query)
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnSeriesChartData | query parameter are not valid | error: %s", err)
+			return
+		}
+		sampling, err := mapQueryParamToDuration(query.Get("sampling"))
+		if err != nil {
+			http.Error(w, "Invalid sampling query parameter", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnSeriesChartData | sampling parameter are not valid | error: %s", err)
+			return
+		}
+		location, err := mapQueryParamToLocation(query.Get("tz"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnSeriesChartData | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		entries, resolution, err := service.ReturnSeriesChartData(definition, query.Get("device_id"), tr, sampling)
+		if err != nil {
+			http.Error(w, "Internal Server Error – ReturnSeriesChartData failed", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.ReturnSeriesChartData | ReturnSeriesChartData failed | err: %s", err)
+			return
+		}
+
+		respBody := SeriesChartResponseBody{
+			Variable:   definition.Name,
+			Unit:       definition.Unit,
+			Resolution: resolution,
+			Entries:    mapTimeStampToSpecifiedFormatForSeries(entries, location),
+		}
+		if definition.Name == state.TemperaturePV {
+			markers, err := service.ReturnTuneProfileHistory(tr, maxTuneHistoryLimit)
+			if err != nil {
+				http.Error(w, "Internal Server Error – ReturnTuneProfileHistory failed", http.StatusInternalServerError)
+				log.Errorf("[ERROR] api.web.ReturnSeriesChartData | ReturnTuneProfileHistory failed | err: %s", err)
+				return
+			}
+			respBody.TuneMarkers = mapTimeStampToSpecifiedFormatForTuneProfiles(markers, location)
+		}
+		if actuator, ok := seriesActuators[definition.Name]; ok {
+			events, err := service.ReturnActuatorHistory(actuator, query.Get("device_id"), tr)
+			if err != nil {
+				http.Error(w, "Internal Server Error – ReturnActuatorHistory failed", http.StatusInternalServerError)
+				log.Errorf("[ERROR] api.web.ReturnSeriesChartData | ReturnActuatorHistory failed | err: %s", err)
+				return
+			}
+			respBody.ActuatorEvents = mapTimeStampToSpecifiedFormatForActuatorHistory(events, location)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.ReturnSeriesChartData")
+	}
+}
+
+func mapTimeStampToSpecifiedFormatForSeries(entries []SeriesChartDataEntry, location *time.Location) []SeriesChartDataEntry {
+	for i := 0; i < len(entries); i++ {
+		entries[i].Timestamp, entries[i].TimestampMs = formatTimestamp(entries[i].Timestamp, location)
+	}
+
+	return entries
+}
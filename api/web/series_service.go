@@ -0,0 +1,98 @@
+package web
+
+import (
+	"Solflora/db"
+	"Solflora/logger"
+	"Solflora/state"
+	"fmt"
+	"time"
+)
+
+// ReturnSeriesChartData reads any registered variable from its storage table,
+// or from a rollup table when raw samples are too fine or already expired.
+func (s *ControlHandlerService) ReturnSeriesChartData(
+	definition state.VariableDefinition,
+	deviceID string,
+	tr timeRange,
+	sampling time.Duration) ([]SeriesChartDataEntry, dataResolution, error) {
+
+	if sampling <= 0 {
+		return nil, "", fmt.Errorf("sampling is less than 0")
+	}
+
+	resolution := s.dataResolution(tr, sampling)
+	var entries []SeriesChartDataEntry
+	var err error
+	if resolution == resolutionRaw {
+		entries, err = s.queryRawSeries(definition, deviceID, tr)
+	} else {
+		entries, err = s.queryRollupSeries(resolution, definition.Name, deviceID, tr)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return downsample(entries, func(e SeriesChartDataEntry) string { return e.Timestamp }, sampling), resolution, nil
+}
+
+// queryRawSeries reads the good samples of a variable; the table name comes
+// from the registry, never from the request.
+func (s *ControlHandlerService) queryRawSeries(
+	definition state.VariableDefinition,
+	deviceID string,
+	tr timeRange) ([]SeriesChartDataEntry, error) {
+
+	var log = logger.Logger()
+
+	table := definition.StorageTable()
+	query := `
+		SELECT present_value, filtered_value, created_at
+		FROM ` + table + `
+		WHERE quality = 'good' AND created_at >= $1 AND created_at < $2`
+	args := []any{tr.From, tr.To}
+	if table == state.MeasurementTable {
+		args = append(args, definition.Name)
+		query += fmt.Sprintf(" AND variable = $%d", len(args))
+	}
+	if deviceID != "" {
+		args = append(args, deviceID)
+		query += fmt.Sprintf(" AND device_id = $%d", len(args))
+	}
+	query += " ORDER BY created_at"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.queryRawSeries | failed to retrieve %s chart data (range: %s – %s): %s", definition.Name, tr.From, tr.To, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fullIntervalRangeData []SeriesChartDataEntry
+	for rows.Next() {
+		var entry SeriesChartDataEntry
+		if err := rows.Scan(&entry.Value, &entry.FilteredValue, &entry.Timestamp); err != nil {
+			log.Errorf("[ERROR] api.web.queryRawSeries | failed to scan row: %s", err.Error())
+			return nil, err
+		}
+		fullIntervalRangeData = append(fullIntervalRangeData, entry)
+	}
+	return fullIntervalRangeData, rows.Err()
+}
+
+// downsample keeps the first entry of every sampling period.
+func downsample[T any](entries []T, timestamp func(T) string, sampling time.Duration) []T {
+	var lastTime time.Time
+	sampledData := make([]T, 0, len(entries))
+	for _, entry := range entries {
+		parsedTime, err := time.Parse(time.RFC3339, timestamp(entry))
+		if err != nil {
+			continue
+		}
+
+		if lastTime.IsZero() || parsedTime.Sub(lastTime) >= sampling {
+			sampledData = append(sampledData, entry)
+			lastTime = parsedTime
+		}
+	}
+	return sampledData
+}
@@ -1,70 +1,122 @@
 package web
 
 import (
+	"Solflora/config"
 	"Solflora/dao"
 	"Solflora/db"
 	"Solflora/logger"
 	"Solflora/state"
-	"context"
+	"Solflora/util"
 	"fmt"
-	"strings"
 	"time"
 )
 
 type ControlHandlerService struct {
-	deviceState *state.DeviceState
-	modelState  *state.ModelState
-	tuneState   *state.TuneState
+	deviceState       *state.DeviceState
+	modelState        *state.ModelState
+	tuneState         *state.TuneState
+	tunePresetState   *state.TunePresetState
+	calibrationState  *state.CalibrationState
+	filterState       *state.FilterState
+	variableRegistry  *state.VariableRegistry
+	lightState        *state.LightState
+	pumpState         *state.PumpState
+	fanState          *state.FanState
+	integralState     *state.TrackingIntegralState
+	loopState         *state.LoopState
+	pumpController    *util.PumpController
+	actuatorRecorder  *util.ActuatorRecorder
+	commandState      *state.CommandState
+	deviceConfigState *state.DeviceConfigState
+	firmwareState     *state.FirmwareState
+	recipeState       *state.RecipeState
+	controlConfig     config.ControlConfig
+	firmwareConfig    config.FirmwareConfig
+	retentionConfig   config.RetentionConfig
+	reportConfig      config.ReportConfig
 }
 
 func NewControlHandlerService(
 	deviceState *state.DeviceState,
 	modelState *state.ModelState,
-	tuneState *state.TuneState) *ControlHandlerService {
+	tuneState *state.TuneState,
+	tunePresetState *state.TunePresetState,
+	calibrationState *state.CalibrationState,
+	filterState *state.FilterState,
+	variableRegistry *state.VariableRegistry,
+	lightState *state.LightState,
+	pumpState *state.PumpState,
+	fanState *state.FanState,
+	integralState *state.TrackingIntegralState,
+	loopState *state.LoopState,
+	pumpController *util.PumpController,
+	actuatorRecorder *util.ActuatorRecorder,
+	commandState *state.CommandState,
+	deviceConfigState *state.DeviceConfigState,
+	firmwareState *state.FirmwareState,
+	recipeState *state.RecipeState,
+	controlConfig config.ControlConfig,
+	firmwareConfig config.FirmwareConfig,
+	retentionConfig config.RetentionConfig,
+	reportConfig config.ReportConfig) *ControlHandlerService {
 	return &ControlHandlerService{
-		deviceState: deviceState,
-		modelState:  modelState,
-		tuneState:   tuneState}
+		deviceState:       deviceState,
+		modelState:        modelState,
+		tuneState:         tuneState,
+		tunePresetState:   tunePresetState,
+		calibrationState:  calibrationState,
+		filterState:       filterState,
+		variableRegistry:  variableRegistry,
+		lightState:        lightState,
+		pumpState:         pumpState,
+		fanState:          fanState,
+		integralState:     integralState,
+		loopState:         loopState,
+		pumpController:    pumpController,
+		actuatorRecorder:  actuatorRecorder,
+		commandState:      commandState,
+		deviceConfigState: deviceConfigState,
+		firmwareState:     firmwareState,
+		recipeState:       recipeState,
+		controlConfig:     controlConfig,
+		firmwareConfig:    firmwareConfig,
+		retentionConfig:   retentionConfig,
+		reportConfig:      reportConfig}
 }
 
-func (s *ControlHandlerService) ActivateWaterPump(duration time.Duration) {
-	var log = logger.Logger()
-
-	s.deviceState.Mutex.Lock()
-	defer s.deviceState.Mutex.Unlock()
-
-	s.deviceState.ValueMap[state.WaterPumpControl] = true
-
-	if s.deviceState.CancelTimer != nil {
-		log.Debug("[DEBUG] api.web.ActivateWaterPump | overriding existing pump-timer")
-		s.deviceState.CancelTimer()
+// ActivateWaterPump runs the pump for the given duration (the configured
+// on-time when zero) once every interlock passes. A refusal is returned as
+// *util.PumpInterlockError and recorded as an alarm.
+func (s *ControlHandlerService) ActivateWaterPump(duration time.Duration) error {
+	if duration <= 0 {
+		duration = s.controlConfig.WaterPumpOnStateDuration
 	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	s.deviceState.CancelTimer = cancel
-
-	go func() {
-		select {
-		case <-time.After(duration):
-			s.deviceState.Mutex.Lock()
-			s.deviceState.ValueMap[state.WaterPumpControl] = false
-			s.deviceState.CancelTimer = nil
-			s.deviceState.Mutex.Unlock()
-		case <-ctx.Done():
-		}
-	}()
+	return s.pumpController.Start(state.PumpRun{DeviceID: state.DefaultDeviceID, Start: time.Now(), Duration: duration})
 }
 
-func (s *ControlHandlerService) UpdateAirFanState(updatedState bool) {
+// UpdateAirFanState keeps the on/off fan endpoint working: on runs the fan at
+// its maximum duty in manual mode, off stops it.
+func (s *ControlHandlerService) UpdateAirFanState(updatedState bool) error {
 	var log = logger.Logger()
-	s.deviceState.Set(state.FanControl, updatedState)
+	duty := 0.0
+	if updatedState {
+		duty = s.controlConfig.FanDutyMax
+	}
 	log.Debug("[DEBUG] api.web.UpdateAirFanState | updating air-fan to ", updatedState)
+	return s.UpdateFanSpeed(duty)
 }
 
-func (s *ControlHandlerService) UpdateTemperatureSetPoint(updatedSetPoint float64) {
+func (s *ControlHandlerService) UpdateTemperatureSetPoint(updatedSetPoint float64) error {
 	var log = logger.Logger()
+
+	if updatedSetPoint < s.controlConfig.TemperatureSPMin || updatedSetPoint > s.controlConfig.TemperatureSPMax {
+		return fmt.Errorf("temp_sp %g is outside the allowed range [%g, %g]",
+			updatedSetPoint, s.controlConfig.TemperatureSPMin, s.controlConfig.TemperatureSPMax)
+	}
+
 	s.modelState.Set(state.TemperatureSP, updatedSetPoint)
 	log.Debug("[DEBUG] api.web.UpdateTemperatureSetPoint | updating temp_sp to ", updatedSetPoint)
+	return nil
 }
 
 func (s *ControlHandlerService) ReturnTemperatureSetPoint() float64 {
@@ -87,46 +139,59 @@ func (s *ControlHandlerService) ReturnTemperatureControlTuneProfile() Temperatur
 	return tuneProfile
 }
 
-func (s *ControlHandlerService) SetTemperatureControlTuneProfile(profile TemperatureControlTuneProfileRequestBody) error {
+func (s *ControlHandlerService) SetTemperatureControlTuneProfile(profile TemperatureControlTuneProfileRequestBody) (TuneProfileRevision, error) {
 	var log = logger.Logger()
-	s.tuneState.Set(state.TemperatureKp, profile.ProportionalGain)
-	s.tuneState.Set(state.TemperatureKi, profile.IntegralGain)
-	s.tuneState.Set(state.TemperatureKd, profile.DerivativeGain)
-
-	updatedTuneState := s.tuneState.GetAll()
-	log.Debugf("[DEBUG] api.web.SetTemperatureControlTuneProfile | new temp-tune-profile: %+v\n", updatedTuneState)
 
+	outputMin, outputMax := s.tuneState.GetOutputLimits()
 	newTuneProfileEntry := dao.TuneProfileEntity{
-		ProportionalGain: updatedTuneState[state.TemperatureKp],
-		IntegralGain:     updatedTuneState[state.TemperatureKi],
-		DerivativeGain:   updatedTuneState[state.TemperatureKd],
+		ProportionalGain: profile.ProportionalGain,
+		IntegralGain:     profile.IntegralGain,
+		DerivativeGain:   profile.DerivativeGain,
+		OutputMin:        &outputMin,
+		OutputMax:        &outputMax,
+		Author:           profile.Author,
 	}
 	err := newTuneProfileEntry.Commit()
 	if err != nil {
 		log.Errorf("[ERROR] api.web.SetTemperatureControlTuneProfile | failed to commit new profile entity: %s", err.Error())
-		return err
+		return TuneProfileRevision{}, err
 	}
 	log.Debugf("[DEBUG] api.web.SetTemperatureControlTuneProfile | new temp-tune-profile-entry: %+v\n", newTuneProfileEntry)
 
-	return nil
+	s.applyTuneProfile(newTuneProfileEntry)
+	log.Debugf("[DEBUG] api.web.SetTemperatureControlTuneProfile | new temp-tune-profile: %+v\n", s.tuneState.GetAll())
+
+	return mapTuneProfileEntityToRevision(newTuneProfileEntry), nil
 }
 
-func (s *ControlHandlerService) ReturnMoistureChartData(interval time.Duration, sampling time.Duration) ([]MoistureChartDataEntry, error) {
+func (s *ControlHandlerService) ReturnMoistureChartData(tr timeRange, sampling time.Duration) ([]MoistureChartDataEntry, error) {
 	var log = logger.Logger()
 
 	if sampling <= 0 {
 		return nil, fmt.Errorf("sampling is less than 0")
 	}
+	if tr.Length() < sampling {
+		log.Errorf("[ERROR] api.web.ReturnMoistureChartData | sampling wider than range (range: %s, samp: %s)", tr.Length(), sampling)
+		return nil, fmt.Errorf("sampling %s is wider than the range %s", sampling, tr.Length())
+	}
 
-	pgInterval := toPostgresIntervalString(interval)
-	log.Debugf("[DEBUG] api.web.ReturnMoistureChartData | pgInterval: %s", pgInterval)
+	if resolution := s.dataResolution(tr, sampling); resolution != resolutionRaw {
+		entries, err := s.returnMoistureRollupChartData(resolution, tr)
+		if err != nil {
+			return nil, err
+		}
+		return downsample(entries, func(e MoistureChartDataEntry) string { return e.Timestamp }, sampling), nil
+	}
+
+	log.Debugf("[DEBUG] api.web.ReturnMoistureChartData | range: %s – %s", tr.From, tr.To)
 	rows, err := db.DB.Query(`
-		SELECT present_value, created_at
+		SELECT present_value, filtered_value, created_at
 		FROM moisture
-		WHERE created_at >= NOW() - INTERVAL '` + pgInterval + `'`)
+		WHERE quality = 'good' AND created_at >= $1 AND created_at < $2
+		ORDER BY created_at`, tr.From, tr.To)
 
 	if err != nil {
-		log.Errorf("[ERROR] api.web.ReturnMoistureChartData | failed to retrieve humidity chart data (int: %s): %s", interval, err.Error())
+		log.Errorf("[ERROR] api.web.ReturnMoistureChartData | failed to retrieve humidity chart data (range: %s – %s): %s", tr.From, tr.To, err.Error())
 		return nil, err
 	}
 	defer rows.Close()
@@ -134,7 +199,7 @@ func (s *ControlHandlerService) ReturnMoistureChartData(interval time.Duration,
 	var fullIntervalRangeData []MoistureChartDataEntry
 	for rows.Next() {
 		var entry MoistureChartDataEntry
-		if err := rows.Scan(&entry.MoisturePV, &entry.Timestamp); err != nil {
+		if err := rows.Scan(&entry.MoisturePV, &entry.MoistureFilteredPV, &entry.Timestamp); err != nil {
 			log.Errorf("[ERROR] api.web.ReturnMoistureChartData | failed to scan row: %s", err.Error())
 			return nil, err
 		}
@@ -142,50 +207,41 @@ func (s *ControlHandlerService) ReturnMoistureChartData(interval time.Duration,
 	}
 
 	if len(fullIntervalRangeData) == 0 {
-		log.Errorf("[ERROR] api.web.ReturnMoistureChartData | failed to retrieve temperature chart data or chart data is empty (int: %s)", interval)
+		log.Errorf("[ERROR] api.web.ReturnMoistureChartData | failed to retrieve temperature chart data or chart data is empty (range: %s – %s)", tr.From, tr.To)
 		return nil, fmt.Errorf("no temperature chart could be fetched")
 	}
 
-	targetLength := int(interval.Milliseconds() / sampling.Milliseconds())
-
-	if targetLength <= 0 {
-		log.Errorf("[ERROR] api.web.ReturnMoistureChartData | targetCount <= 0 (int: %s, samp: %s)", interval, sampling)
-		return nil, fmt.Errorf("targetCount is less than 0")
-	}
-
-	var lastTime time.Time
-	sampledData := make([]MoistureChartDataEntry, targetLength)
-	for _, entry := range fullIntervalRangeData {
-		parsedTime, err := time.Parse(time.RFC3339, entry.Timestamp)
-		if err != nil {
-			continue
-		}
-
-		if lastTime.IsZero() || parsedTime.Sub(lastTime) >= sampling {
-			sampledData = append(sampledData, entry)
-			lastTime = parsedTime
-		}
-	}
-
-	return sampledData, nil
+	return downsample(fullIntervalRangeData, func(e MoistureChartDataEntry) string { return e.Timestamp }, sampling), nil
 }
 
-func (s *ControlHandlerService) ReturnHumidityChartData(interval time.Duration, sampling time.Duration) ([]HumidityChartDataEntry, error) {
+func (s *ControlHandlerService) ReturnHumidityChartData(tr timeRange, sampling time.Duration) ([]HumidityChartDataEntry, error) {
 	var log = logger.Logger()
 
 	if sampling <= 0 {
 		return nil, fmt.Errorf("sampling is less than 0")
 	}
+	if tr.Length() < sampling {
+		log.Errorf("[ERROR] api.web.ReturnHumidityChartData | sampling wider than range (range: %s, samp: %s)", tr.Length(), sampling)
+		return nil, fmt.Errorf("sampling %s is wider than the range %s", sampling, tr.Length())
+	}
+
+	if resolution := s.dataResolution(tr, sampling); resolution != resolutionRaw {
+		entries, err := s.returnHumidityRollupChartData(resolution, tr)
+		if err != nil {
+			return nil, err
+		}
+		return downsample(entries, func(e HumidityChartDataEntry) string { return e.Timestamp }, sampling), nil
+	}
 
-	pgInterval := toPostgresIntervalString(interval)
-	log.Debugf("[DEBUG] api.web.ReturnHumidityChartData | pgInterval: %s", pgInterval)
+	log.Debugf("[DEBUG] api.web.ReturnHumidityChartData | range: %s – %s", tr.From, tr.To)
 	rows, err := db.DB.Query(`
-		SELECT present_value, created_at
+		SELECT present_value, filtered_value, created_at
 		FROM humidity
-		WHERE created_at >= NOW() - INTERVAL '` + pgInterval + `'`)
+		WHERE quality = 'good' AND created_at >= $1 AND created_at < $2
+		ORDER BY created_at`, tr.From, tr.To)
 
 	if err != nil {
-		log.Errorf("[ERROR] api.web.ReturnHumidityChartData | failed to retrieve humidity chart data (int: %s): %s", interval, err.Error())
+		log.Errorf("[ERROR] api.web.ReturnHumidityChartData | failed to retrieve humidity chart data (range: %s – %s): %s", tr.From, tr.To, err.Error())
 		return nil, err
 	}
 	defer rows.Close()
@@ -193,7 +249,7 @@ func (s *ControlHandlerService) ReturnHumidityChartData(interval time.Duration,
 	var fullIntervalRangeData []HumidityChartDataEntry
 	for rows.Next() {
 		var entry HumidityChartDataEntry
-		if err := rows.Scan(&entry.HumidityPV, &entry.Timestamp); err != nil {
+		if err := rows.Scan(&entry.HumidityPV, &entry.HumidityFilteredPV, &entry.Timestamp); err != nil {
 			log.Errorf("[ERROR] api.web.ReturnHumidityChartData | failed to scan row: %s", err.Error())
 			return nil, err
 		}
@@ -201,50 +257,41 @@ func (s *ControlHandlerService) ReturnHumidityChartData(interval time.Duration,
 	}
 
 	if len(fullIntervalRangeData) == 0 {
-		log.Errorf("[ERROR] api.web.ReturnHumidityChartData | failed to retrieve temperature chart data or chart data is empty (int: %s)", interval)
+		log.Errorf("[ERROR] api.web.ReturnHumidityChartData | failed to retrieve temperature chart data or chart data is empty (range: %s – %s)", tr.From, tr.To)
 		return nil, fmt.Errorf("no temperature chart could be fetched")
 	}
 
-	targetLength := int(interval.Milliseconds() / sampling.Milliseconds())
-
-	if targetLength <= 0 {
-		log.Errorf("[ERROR] api.web.ReturnHumidityChartData | targetCount <= 0 (int: %s, samp: %s)", interval, sampling)
-		return nil, fmt.Errorf("targetCount is less than 0")
-	}
-
-	var lastTime time.Time
-	sampledData := make([]HumidityChartDataEntry, targetLength)
-	for _, entry := range fullIntervalRangeData {
-		parsedTime, err := time.Parse(time.RFC3339, entry.Timestamp)
-		if err != nil {
-			continue
-		}
-
-		if lastTime.IsZero() || parsedTime.Sub(lastTime) >= sampling {
-			sampledData = append(sampledData, entry)
-			lastTime = parsedTime
-		}
-	}
-
-	return sampledData, nil
+	return downsample(fullIntervalRangeData, func(e HumidityChartDataEntry) string { return e.Timestamp }, sampling), nil
 }
 
-func (s *ControlHandlerService) ReturnTemperatureChartData(interval time.Duration, sampling time.Duration) ([]TemperatureChartDataEntry, error) {
+func (s *ControlHandlerService) ReturnTemperatureChartData(tr timeRange, sampling time.Duration) ([]TemperatureChartDataEntry, error) {
 	var log = logger.Logger()
 
 	if sampling <= 0 {
 		return nil, fmt.Errorf("sampling is less than 0")
 	}
+	if tr.Length() < sampling {
+		log.Errorf("[ERROR] api.web.ReturnTemperatureChartData | sampling wider than range (range: %s, samp: %s)", tr.Length(), sampling)
+		return nil, fmt.Errorf("sampling %s is wider than the range %s", sampling, tr.Length())
+	}
 
-	pgInterval := toPostgresIntervalString(interval)
-	log.Debugf("[DEBUG] api.web.ReturnTemperatureChartData | pgInterval: %s", pgInterval)
+	if resolution := s.dataResolution(tr, sampling); resolution != resolutionRaw {
+		entries, err := s.returnTemperatureRollupChartData(resolution, tr)
+		if err != nil {
+			return nil, err
+		}
+		return downsample(entries, func(e TemperatureChartDataEntry) string { return e.Timestamp }, sampling), nil
+	}
+
+	log.Debugf("[DEBUG] api.web.ReturnTemperatureChartData | range: %s – %s", tr.From, tr.To)
 	rows, err := db.DB.Query(`
-		SELECT present_value, controller_output, set_point, created_at
+		SELECT present_value, filtered_value, controller_output, set_point, created_at
 		FROM temperature
-		WHERE created_at >= NOW() - INTERVAL '` + pgInterval + `'`)
+		WHERE quality = 'good' AND created_at >= $1 AND created_at < $2
+		ORDER BY created_at`, tr.From, tr.To)
 
 	if err != nil {
-		log.Errorf("[ERROR] api.web.ReturnTemperatureChartData | failed to retrieve temperature chart data (int: %s): %s", interval, err.Error())
+		log.Errorf("[ERROR] api.web.ReturnTemperatureChartData | failed to retrieve temperature chart data (range: %s – %s): %s", tr.From, tr.To, err.Error())
 		return nil, err
 	}
 	defer rows.Close()
@@ -252,7 +299,7 @@ func (s *ControlHandlerService) ReturnTemperatureChartData(interval time.Duratio
 	var fullIntervalRangeData []TemperatureChartDataEntry
 	for rows.Next() {
 		var entry TemperatureChartDataEntry
-		if err := rows.Scan(&entry.TemperaturePV, &entry.TemperatureCO, &entry.TemperatureSP, &entry.Timestamp); err != nil {
+		if err := rows.Scan(&entry.TemperaturePV, &entry.TemperatureFilteredPV, &entry.TemperatureCO, &entry.TemperatureSP, &entry.Timestamp); err != nil {
 			log.Errorf("[ERROR] api.web.ReturnTemperatureChartData | failed to scan row: %s", err.Error())
 			return nil, err
 		}
@@ -260,62 +307,9 @@ func (s *ControlHandlerService) ReturnTemperatureChartData(interval time.Duratio
 	}
 
 	if len(fullIntervalRangeData) == 0 {
-		log.Errorf("[ERROR] api.web.ReturnTemperatureChartData | failed to retrieve temperature chart data or chart data is empty (int: %s)", interval)
+		log.Errorf("[ERROR] api.web.ReturnTemperatureChartData | failed to retrieve temperature chart data or chart data is empty (range: %s – %s)", tr.From, tr.To)
 		return nil, fmt.Errorf("no temperature chart could be fetched")
 	}
 
-	targetLength := int(interval.Milliseconds() / sampling.Milliseconds())
-
-	if targetLength <= 0 {
-		log.Errorf("[ERROR] api.web.ReturnTemperatureChartData | targetCount <= 0 (int: %s, samp: %s)", interval, sampling)
-		return nil, fmt.Errorf("targetCount is less than 0")
-	}
-
-	var lastTime time.Time
-	sampledData := make([]TemperatureChartDataEntry, targetLength)
-	for _, entry := range fullIntervalRangeData {
-		parsedTime, err := time.Parse(time.RFC3339, entry.Timestamp)
-		if err != nil {
-			continue
-		}
-
-		if lastTime.IsZero() || parsedTime.Sub(lastTime) >= sampling {
-			sampledData = append(sampledData, entry)
-			lastTime = parsedTime
-		}
-	}
-
-	return sampledData, nil
-}
-
-func toPostgresIntervalString(d time.Duration) string {
-	d = d.Truncate(time.Millisecond)
-
-	hours := int64(d / time.Hour)
-	d -= time.Duration(hours) * time.Hour
-	minutes := int64(d / time.Minute)
-	d -= time.Duration(minutes) * time.Minute
-	seconds := int64(d / time.Second)
-	d -= time.Duration(seconds) * time.Second
-	milliseconds := int64(d / time.Millisecond)
-
-	var parts []string
-	if hours > 0 {
-		parts = append(parts, fmt.Sprintf("%d hours", hours))
-	}
-	if minutes > 0 {
-		parts = append(parts, fmt.Sprintf("%d minutes", minutes))
-	}
-	if seconds > 0 {
-		parts = append(parts, fmt.Sprintf("%d seconds", seconds))
-	}
-	if milliseconds > 0 {
-		parts = append(parts, fmt.Sprintf("%d milliseconds", milliseconds))
-	}
-
-	if len(parts) == 0 {
-		return "0 seconds"
-	}
-
-	return strings.Join(parts, " ")
+	return downsample(fullIntervalRangeData, func(e TemperatureChartDataEntry) string { return e.Timestamp }, sampling), nil
 }
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// timeRange is the half-open range [From, To) a series query covers.
+type timeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+func (r timeRange) Length() time.Duration {
+	return r.To.Sub(r.From)
+}
+
+// mapQueryParamsToTimeRange reads the absolute from/to (RFC3339) parameters.
+// A missing to is now and a missing from is interval before to, so the
+// relative "last interval" queries keep working.
+func mapQueryParamsToTimeRange(query url.Values) (timeRange, error) {
+	var r timeRange
+
+	r.To = time.Now()
+	if to := query.Get("to"); to != "" {
+		parsed, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return r, fmt.Errorf("to %q is not an RFC3339 timestamp", to)
+		}
+		r.To = parsed
+	}
+
+	if from := query.Get("from"); from != "" {
+		parsed, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return r, fmt.Errorf("from %q is not an RFC3339 timestamp", from)
+		}
+		r.From = parsed
+	} else {
+		interval, err := mapQueryParamToDuration(query.Get("interval"))
+		if err != nil {
+			return r, fmt.Errorf("either from or a valid interval is required")
+		}
+		r.From = r.To.Add(-interval)
+	}
+
+	if !r.From.Before(r.To) {
+		return r, fmt.Errorf("from (%s) must be before to (%s)", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339))
+	}
+	return r, nil
+}
+
+// mapQueryParamToLocation reads the display time zone (IANA name) of a
+// request; without one timestamps are shown in the server time zone.
+func mapQueryParamToLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("tz %q is not a known time zone", tz)
+	}
+	return location, nil
+}
+
+// formatTimestamp renders a database timestamp as RFC3339 with the offset of
+// the display time zone and as Unix epoch milliseconds.
+func formatTimestamp(timestamp string, location *time.Location) (string, int64) {
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return timestamp, 0
+	}
+	t = t.In(location)
+	return t.Format(time.RFC3339), t.UnixMilli()
+}
@@ -3,13 +3,27 @@ package web
 import (
 	"Solflora/logger"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+const (
+	defaultTuneHistoryLimit = 100
+	maxTuneHistoryLimit     = 1000
+)
+
+// TemperatureControlTuneProfileRequestBody sets the temperature PID gains.
+// temp_ki acts on the sum of the errors of all samples; gains stored before
+// the integral was accumulated acted on the previous error only and must be
+// re-tuned.
 type TemperatureControlTuneProfileRequestBody struct {
 	ProportionalGain float64 `json:"temp_kp"`
 	IntegralGain     float64 `json:"temp_ki"`
 	DerivativeGain   float64 `json:"temp_kd"`
+	Author           string  `json:"author"`
 }
 
 type TemperatureControlTuneProfileResponseBody struct {
@@ -18,6 +32,45 @@ type TemperatureControlTuneProfileResponseBody struct {
 	DerivativeGain   float64 `json:"temp_kd"`
 }
 
+// TuneProfileRevision is one stored gain set. RolledBackFrom is set when the
+// revision was created by rolling back to an earlier one, Preset when it was
+// created by applying a preset.
+type TuneProfileRevision struct {
+	ID               int64    `json:"id"`
+	ProportionalGain float64  `json:"temp_kp"`
+	IntegralGain     float64  `json:"temp_ki"`
+	DerivativeGain   float64  `json:"temp_kd"`
+	OutputMin        *float64 `json:"temp_co_min,omitempty"`
+	OutputMax        *float64 `json:"temp_co_max,omitempty"`
+	Author           string   `json:"author"`
+	Preset           string   `json:"preset,omitempty"`
+	RolledBackFrom   *int64   `json:"rolled_back_from,omitempty"`
+	Timestamp        string   `json:"time"`
+	TimestampMs      int64    `json:"time_ms"`
+
+	createdAt time.Time
+}
+
+type TuneProfileChange struct {
+	Field string  `json:"field"`
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Delta float64 `json:"delta"`
+}
+
+// TuneProfileDiffResponseBody lists only the fields that differ; the output
+// limits are compared when both revisions recorded them.
+type TuneProfileDiffResponseBody struct {
+	From    TuneProfileRevision `json:"from"`
+	To      TuneProfileRevision `json:"to"`
+	Changes []TuneProfileChange `json:"changes"`
+}
+
+type TuneProfileRollbackRequestBody struct {
+	ID     int64  `json:"id"`
+	Author string `json:"author"`
+}
+
 func ReturnTemperatureControlTuneProfile(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var log = logger.Logger()
@@ -52,15 +105,15 @@ func SetTemperatureControlTuneProfile(service *ControlHandlerService) func(http.
 		var reqBody TemperatureControlTuneProfileRequestBody
 		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			log.Error("[ERROR] api.web.SetTemperatureControlTuneProfile | invalid request body: %s", err.Error())
+			log.Errorf("[ERROR] api.web.SetTemperatureControlTuneProfile | invalid request body: %s", err.Error())
 			return
 		}
 		log.Debugf("[DEBUG] api.web.SetTemperatureControlTuneProfile | request body: %+v\n", reqBody)
 
-		err := service.SetTemperatureControlTuneProfile(reqBody)
-		if err != nil {
+		if _, err := service.SetTemperatureControlTuneProfile(reqBody); err != nil {
 			http.Error(w, "Internal Server Error – failed to commit new tune-profile", http.StatusInternalServerError)
 			log.Errorf("[ERROR] api.web.SetTemperatureControlTuneProfile | failed to commit new tune-profile: %s\n", err.Error())
+			return
 		}
 
 		respBody := TemperatureControlTuneProfileResponseBody{
@@ -74,3 +127,163 @@ func SetTemperatureControlTuneProfile(service *ControlHandlerService) func(http.
 		log.Info("[END] api.SetTemperatureControlTuneProfile")
 	}
 }
+
+// ReturnTuneProfileHistory lists past gain sets, newest first. Without from
+// or interval the whole history is searched.
+func ReturnTuneProfileHistory(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnTuneProfileHistory")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnTuneProfileHistory | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		tr := timeRange{To: time.Now()}
+		if query.Get("from") != "" || query.Get("interval") != "" {
+			var err error
+			if tr, err = mapQueryParamsToTimeRange(query); err != nil {
+				http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+				log.Errorf("[ERROR] api.web.ReturnTuneProfileHistory | query parameter are not valid | error: %s", err)
+				return
+			}
+		}
+		limit, err := mapQueryParamToTuneHistoryLimit(query.Get("limit"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnTuneProfileHistory | query parameter are not valid | error: %s", err)
+			return
+		}
+		location, err := mapQueryParamToLocation(query.Get("tz"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ReturnTuneProfileHistory | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		revisions, err := service.ReturnTuneProfileHistory(tr, limit)
+		if err != nil {
+			http.Error(w, "Internal Server Error – ReturnTuneProfileHistory failed", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.ReturnTuneProfileHistory | ReturnTuneProfileHistory failed | err: %s", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mapTimeStampToSpecifiedFormatForTuneProfiles(revisions, location))
+
+		log.Info("[END] api.web.ReturnTuneProfileHistory")
+	}
+}
+
+func DiffTuneProfiles(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.DiffTuneProfiles")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.DiffTuneProfiles | method not allowed: %s", r.Method)
+			return
+		}
+
+		query := r.URL.Query()
+		fromID, fromErr := strconv.ParseInt(query.Get("from"), 10, 64)
+		toID, toErr := strconv.ParseInt(query.Get("to"), 10, 64)
+		if err := errors.Join(fromErr, toErr); err != nil {
+			http.Error(w, "Bad Request – from and to must be tune profile ids", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.DiffTuneProfiles | query parameter are not valid | error: %s", err)
+			return
+		}
+		location, err := mapQueryParamToLocation(query.Get("tz"))
+		if err != nil {
+			http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.DiffTuneProfiles | query parameter are not valid | error: %s", err)
+			return
+		}
+
+		diff, err := service.DiffTuneProfiles(fromID, toID)
+		if errors.Is(err, errTuneProfileNotFound) {
+			http.Error(w, "Not Found – "+err.Error(), http.StatusNotFound)
+			log.Errorf("[ERROR] api.web.DiffTuneProfiles | %s", err)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error – DiffTuneProfiles failed", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.DiffTuneProfiles | DiffTuneProfiles failed | err: %s", err)
+			return
+		}
+		diff.From = formatTuneProfileRevision(diff.From, location)
+		diff.To = formatTuneProfileRevision(diff.To, location)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(diff)
+
+		log.Info("[END] api.web.DiffTuneProfiles")
+	}
+}
+
+func RollbackTuneProfile(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.RollbackTuneProfile")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.RollbackTuneProfile | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody TuneProfileRollbackRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.RollbackTuneProfile | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.RollbackTuneProfile | request body: %+v\n", reqBody)
+
+		revision, err := service.RollbackTuneProfile(reqBody.ID, reqBody.Author)
+		if errors.Is(err, errTuneProfileNotFound) {
+			http.Error(w, "Not Found – "+err.Error(), http.StatusNotFound)
+			log.Errorf("[ERROR] api.web.RollbackTuneProfile | %s", err)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error – failed to roll back tune-profile", http.StatusInternalServerError)
+			log.Errorf("[ERROR] api.web.RollbackTuneProfile | failed to roll back tune-profile: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(formatTuneProfileRevision(revision, time.Local))
+
+		log.Info("[END] api.web.RollbackTuneProfile")
+	}
+}
+
+func mapQueryParamToTuneHistoryLimit(limitS string) (int, error) {
+	if limitS == "" {
+		return defaultTuneHistoryLimit, nil
+	}
+	limit, err := strconv.Atoi(limitS)
+	if err != nil || limit < 1 || limit > maxTuneHistoryLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxTuneHistoryLimit)
+	}
+	return limit, nil
+}
+
+func mapTimeStampToSpecifiedFormatForTuneProfiles(revisions []TuneProfileRevision, location *time.Location) []TuneProfileRevision {
+	for i := 0; i < len(revisions); i++ {
+		revisions[i] = formatTuneProfileRevision(revisions[i], location)
+	}
+
+	return revisions
+}
+
+func formatTuneProfileRevision(revision TuneProfileRevision, location *time.Location) TuneProfileRevision {
+	createdAt := revision.createdAt.In(location)
+	revision.Timestamp, revision.TimestampMs = createdAt.Format(time.RFC3339), createdAt.UnixMilli()
+	return revision
+}
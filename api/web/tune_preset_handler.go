@@ -0,0 +1,239 @@
+package web
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+type TunePresetApplyRequestBody struct {
+	Name   string         `json:"name"`
+	Loop   state.LoopName `json:"loop"`
+	Author string         `json:"author"`
+}
+
+// ReturnTunePresets returns the preset of the name query parameter, or all
+// presets without one.
+func ReturnTunePresets(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ReturnTunePresets")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ReturnTunePresets | method not allowed: %s", r.Method)
+			return
+		}
+
+		var respBody any = service.ReturnTunePresets()
+		if name := r.URL.Query().Get("name"); name != "" {
+			preset, ok := service.ReturnTunePreset(name)
+			if !ok {
+				http.Error(w, "Not Found – no tune preset "+name, http.StatusNotFound)
+				log.Errorf("[ERROR] api.web.ReturnTunePresets | no tune preset %s", name)
+				return
+			}
+			respBody = preset
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respBody)
+
+		log.Info("[END] api.web.ReturnTunePresets")
+	}
+}
+
+func CreateTunePreset(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.CreateTunePreset")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.CreateTunePreset | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody state.TunePreset
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.CreateTunePreset | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.CreateTunePreset | request body: %+v\n", reqBody)
+
+		preset, err := service.CreateTunePreset(reqBody)
+		if err != nil {
+			writeTunePresetError(w, err, "failed to commit tune preset")
+			log.Errorf("[ERROR] api.web.CreateTunePreset | failed to create tune preset: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(preset)
+
+		log.Info("[END] api.web.CreateTunePreset")
+	}
+}
+
+func UpdateTunePreset(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.UpdateTunePreset")
+
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.UpdateTunePreset | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody state.TunePreset
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.UpdateTunePreset | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.UpdateTunePreset | request body: %+v\n", reqBody)
+
+		preset, err := service.UpdateTunePreset(reqBody)
+		if err != nil {
+			writeTunePresetError(w, err, "failed to commit tune preset")
+			log.Errorf("[ERROR] api.web.UpdateTunePreset | failed to update tune preset: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(preset)
+
+		log.Info("[END] api.web.UpdateTunePreset")
+	}
+}
+
+func DeleteTunePreset(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.DeleteTunePreset")
+
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.DeleteTunePreset | method not allowed: %s", r.Method)
+			return
+		}
+
+		if err := service.DeleteTunePreset(r.URL.Query().Get("name")); err != nil {
+			writeTunePresetError(w, err, "failed to delete tune preset")
+			log.Errorf("[ERROR] api.web.DeleteTunePreset | failed to delete tune preset: %s", err.Error())
+			return
+		}
+
+		log.Info("[END] api.web.DeleteTunePreset")
+	}
+}
+
+func ApplyTunePreset(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ApplyTunePreset")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ApplyTunePreset | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody TunePresetApplyRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ApplyTunePreset | invalid request body: %s", err.Error())
+			return
+		}
+		log.Debugf("[DEBUG] api.web.ApplyTunePreset | request body: %+v\n", reqBody)
+
+		if reqBody.Loop == "" {
+			reqBody.Loop = state.LoopTemperature
+		}
+		revision, err := service.ApplyTunePreset(reqBody.Name, reqBody.Loop, reqBody.Author)
+		if err != nil {
+			writeTunePresetError(w, err, "failed to apply tune preset")
+			log.Errorf("[ERROR] api.web.ApplyTunePreset | failed to apply tune preset: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(formatTuneProfileRevision(revision, time.Local))
+
+		log.Info("[END] api.web.ApplyTunePreset")
+	}
+}
+
+// ExportTunePresets returns all presets as a JSON file that
+// ImportTunePresets accepts unchanged.
+func ExportTunePresets(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ExportTunePresets")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ExportTunePresets | method not allowed: %s", r.Method)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="tune-presets.json"`)
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(service.ReturnTunePresets())
+
+		log.Info("[END] api.web.ExportTunePresets")
+	}
+}
+
+func ImportTunePresets(service *ControlHandlerService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var log = logger.Logger()
+		log.Info("[START] api.web.ImportTunePresets")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Errorf("[ERROR] api.web.ImportTunePresets | method not allowed: %s", r.Method)
+			return
+		}
+
+		var reqBody []state.TunePreset
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Errorf("[ERROR] api.web.ImportTunePresets | invalid request body: %s", err.Error())
+			return
+		}
+
+		presets, err := service.ImportTunePresets(reqBody)
+		if err != nil {
+			writeTunePresetError(w, err, "failed to import tune presets")
+			log.Errorf("[ERROR] api.web.ImportTunePresets | failed to import tune presets: %s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(presets)
+
+		log.Info("[END] api.web.ImportTunePresets")
+	}
+}
+
+func writeTunePresetError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, errTunePresetInvalid):
+		http.Error(w, "Bad Request – "+err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errTunePresetNotFound):
+		http.Error(w, "Not Found – "+err.Error(), http.StatusNotFound)
+	case errors.Is(err, errTunePresetExists):
+		http.Error(w, "Conflict – "+err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Internal Server Error – "+message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,171 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	errTunePresetNotFound = errors.New("tune preset not found")
+	errTunePresetExists   = errors.New("tune preset already exists")
+	errTunePresetInvalid  = errors.New("tune preset not valid")
+)
+
+func (s *ControlHandlerService) LoadTunePresets() error {
+	var log = logger.Logger()
+
+	entities, err := dao.LoadTunePresets()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadTunePresets | failed to load tune presets: %s", err.Error())
+		return err
+	}
+	for _, entity := range entities {
+		s.tunePresetState.Set(entity.Preset)
+	}
+	log.Infof("[INFO] api.web.LoadTunePresets | %d tune presets restored", len(entities))
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnTunePresets() []state.TunePreset {
+	return s.tunePresetState.GetAll()
+}
+
+func (s *ControlHandlerService) ReturnTunePreset(name string) (state.TunePreset, bool) {
+	return s.tunePresetState.Get(name)
+}
+
+func (s *ControlHandlerService) CreateTunePreset(preset state.TunePreset) (state.TunePreset, error) {
+	if _, ok := s.tunePresetState.Get(preset.Name); ok {
+		return state.TunePreset{}, fmt.Errorf("%w: %s", errTunePresetExists, preset.Name)
+	}
+	return s.commitTunePreset(preset)
+}
+
+func (s *ControlHandlerService) UpdateTunePreset(preset state.TunePreset) (state.TunePreset, error) {
+	if _, ok := s.tunePresetState.Get(preset.Name); !ok {
+		return state.TunePreset{}, fmt.Errorf("%w: %s", errTunePresetNotFound, preset.Name)
+	}
+	return s.commitTunePreset(preset)
+}
+
+func (s *ControlHandlerService) DeleteTunePreset(name string) error {
+	var log = logger.Logger()
+
+	if _, ok := s.tunePresetState.Get(name); !ok {
+		return fmt.Errorf("%w: %s", errTunePresetNotFound, name)
+	}
+	if err := dao.DeleteTunePreset(name); err != nil {
+		log.Errorf("[ERROR] api.web.DeleteTunePreset | failed to delete tune preset %s: %s", name, err.Error())
+		return err
+	}
+
+	s.tunePresetState.Delete(name)
+	log.Infof("[INFO] api.web.DeleteTunePreset | tune preset %s deleted", name)
+	return nil
+}
+
+// ImportTunePresets creates or replaces the given presets. All of them are
+// validated before the first one is stored.
+func (s *ControlHandlerService) ImportTunePresets(presets []state.TunePreset) ([]state.TunePreset, error) {
+	var log = logger.Logger()
+
+	seen := make(map[string]bool, len(presets))
+	for _, preset := range presets {
+		if seen[preset.Name] {
+			return nil, fmt.Errorf("%w: %s is listed more than once", errTunePresetInvalid, preset.Name)
+		}
+		seen[preset.Name] = true
+		if err := s.validateTunePreset(preset); err != nil {
+			return nil, err
+		}
+	}
+
+	imported := make([]state.TunePreset, 0, len(presets))
+	for _, preset := range presets {
+		stored, err := s.commitTunePreset(preset)
+		if err != nil {
+			return imported, err
+		}
+		imported = append(imported, stored)
+	}
+	log.Infof("[INFO] api.web.ImportTunePresets | %d tune presets imported", len(imported))
+	return imported, nil
+}
+
+// ApplyTunePreset sets the gains, the temp_co limits and temp_sp of a preset
+// in one step and records the change in the tune profile history.
+func (s *ControlHandlerService) ApplyTunePreset(name string, loop state.LoopName, author string) (TuneProfileRevision, error) {
+	var log = logger.Logger()
+
+	if loop != state.LoopTemperature {
+		return TuneProfileRevision{}, fmt.Errorf("%w: loop %s has no PID gains", errTunePresetInvalid, loop)
+	}
+	preset, ok := s.tunePresetState.Get(name)
+	if !ok {
+		return TuneProfileRevision{}, fmt.Errorf("%w: %s", errTunePresetNotFound, name)
+	}
+	// the configured ranges may have changed since the preset was stored
+	if err := s.validateTunePreset(preset); err != nil {
+		return TuneProfileRevision{}, err
+	}
+
+	entity := dao.TuneProfileEntity{
+		ProportionalGain: preset.ProportionalGain,
+		IntegralGain:     preset.IntegralGain,
+		DerivativeGain:   preset.DerivativeGain,
+		OutputMin:        &preset.OutputMin,
+		OutputMax:        &preset.OutputMax,
+		Author:           author,
+		Preset:           preset.Name,
+	}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.ApplyTunePreset | failed to commit tune profile entity: %s", err.Error())
+		return TuneProfileRevision{}, err
+	}
+
+	s.applyTuneProfile(entity)
+	s.modelState.Set(state.TemperatureSP, preset.SetPoint)
+	s.reseedTemperatureLoop()
+	log.Infof("[INFO] api.web.ApplyTunePreset | tune preset %s applied to the %s loop by %q (tune profile #%d)", preset.Name, loop, author, entity.ID)
+	return mapTuneProfileEntityToRevision(entity), nil
+}
+
+func (s *ControlHandlerService) commitTunePreset(preset state.TunePreset) (state.TunePreset, error) {
+	var log = logger.Logger()
+
+	if err := s.validateTunePreset(preset); err != nil {
+		return state.TunePreset{}, err
+	}
+
+	preset.UpdatedAt = time.Now()
+	entity := dao.TunePresetEntity{Preset: preset}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.commitTunePreset | failed to commit tune preset entity: %s", err.Error())
+		return state.TunePreset{}, err
+	}
+
+	s.tunePresetState.Set(preset)
+	log.Debugf("[DEBUG] api.web.commitTunePreset | tune preset: %+v", preset)
+	return preset, nil
+}
+
+// validateTunePreset checks a preset against the configured temp_sp and
+// temp_co ranges, which stay the hard limits a preset can only narrow.
+func (s *ControlHandlerService) validateTunePreset(preset state.TunePreset) error {
+	if err := preset.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", errTunePresetInvalid, err)
+	}
+	if preset.SetPoint < s.controlConfig.TemperatureSPMin || preset.SetPoint > s.controlConfig.TemperatureSPMax {
+		return fmt.Errorf("%w: temp_sp %g is outside the allowed range [%g, %g]", errTunePresetInvalid,
+			preset.SetPoint, s.controlConfig.TemperatureSPMin, s.controlConfig.TemperatureSPMax)
+	}
+	if preset.OutputMin < s.controlConfig.TemperatureCOMin || preset.OutputMax > s.controlConfig.TemperatureCOMax {
+		return fmt.Errorf("%w: temp_co limits [%g, %g] exceed the allowed range [%g, %g]", errTunePresetInvalid,
+			preset.OutputMin, preset.OutputMax, s.controlConfig.TemperatureCOMin, s.controlConfig.TemperatureCOMax)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package web
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+	"Solflora/util"
+	"errors"
+	"fmt"
+)
+
+var errTuneProfileNotFound = errors.New("tune profile revision not found")
+
+// LoadTuneProfile re-applies the newest stored gains, so a restart keeps the
+// last tuning instead of starting from zero gains.
+func (s *ControlHandlerService) LoadTuneProfile() error {
+	var log = logger.Logger()
+
+	entity, ok, err := dao.LoadLatestTuneProfile()
+	if err != nil {
+		log.Errorf("[ERROR] api.web.LoadTuneProfile | failed to load tune profile: %s", err.Error())
+		return err
+	}
+	if !ok {
+		log.Info("[INFO] api.web.LoadTuneProfile | no tune profile stored")
+		return nil
+	}
+
+	s.applyTuneProfile(entity)
+	log.Infof("[INFO] api.web.LoadTuneProfile | tune profile #%d restored", entity.ID)
+	return nil
+}
+
+func (s *ControlHandlerService) ReturnTuneProfileHistory(tr timeRange, limit int) ([]TuneProfileRevision, error) {
+	var log = logger.Logger()
+
+	entities, err := dao.LoadTuneProfiles(tr.From, tr.To, limit)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.ReturnTuneProfileHistory | failed to load tune profiles: %s", err.Error())
+		return nil, err
+	}
+
+	revisions := make([]TuneProfileRevision, 0, len(entities))
+	for _, entity := range entities {
+		revisions = append(revisions, mapTuneProfileEntityToRevision(entity))
+	}
+	return revisions, nil
+}
+
+// DiffTuneProfiles compares two revisions field by field; Delta is to minus from.
+func (s *ControlHandlerService) DiffTuneProfiles(fromID int64, toID int64) (TuneProfileDiffResponseBody, error) {
+	from, err := s.loadTuneProfileRevision(fromID)
+	if err != nil {
+		return TuneProfileDiffResponseBody{}, err
+	}
+	to, err := s.loadTuneProfileRevision(toID)
+	if err != nil {
+		return TuneProfileDiffResponseBody{}, err
+	}
+
+	diff := TuneProfileDiffResponseBody{From: from, To: to, Changes: []TuneProfileChange{}}
+	type field struct {
+		name     string
+		from, to float64
+	}
+	fields := []field{
+		{string(state.TemperatureKp), from.ProportionalGain, to.ProportionalGain},
+		{string(state.TemperatureKi), from.IntegralGain, to.IntegralGain},
+		{string(state.TemperatureKd), from.DerivativeGain, to.DerivativeGain},
+	}
+	if from.OutputMin != nil && to.OutputMin != nil {
+		fields = append(fields,
+			field{"temp_co_min", *from.OutputMin, *to.OutputMin},
+			field{"temp_co_max", *from.OutputMax, *to.OutputMax})
+	}
+	for _, f := range fields {
+		if f.from != f.to {
+			diff.Changes = append(diff.Changes, TuneProfileChange{Field: f.name, From: f.from, To: f.to, Delta: f.to - f.from})
+		}
+	}
+	return diff, nil
+}
+
+// RollbackTuneProfile re-applies the gains (and output limits, when recorded)
+// of an earlier revision. The old row is left untouched; the rollback is
+// recorded as a new revision.
+func (s *ControlHandlerService) RollbackTuneProfile(id int64, author string) (TuneProfileRevision, error) {
+	var log = logger.Logger()
+
+	target, err := s.loadTuneProfileRevision(id)
+	if err != nil {
+		return TuneProfileRevision{}, err
+	}
+
+	outputMin, outputMax := s.tuneState.GetOutputLimits()
+	if target.OutputMin != nil && target.OutputMax != nil {
+		outputMin, outputMax = *target.OutputMin, *target.OutputMax
+	}
+	entity := dao.TuneProfileEntity{
+		ProportionalGain: target.ProportionalGain,
+		IntegralGain:     target.IntegralGain,
+		DerivativeGain:   target.DerivativeGain,
+		OutputMin:        &outputMin,
+		OutputMax:        &outputMax,
+		Author:           author,
+		RolledBackFrom:   &target.ID,
+	}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] api.web.RollbackTuneProfile | failed to commit tune profile entity: %s", err.Error())
+		return TuneProfileRevision{}, err
+	}
+
+	s.applyTuneProfile(entity)
+	s.reseedTemperatureLoop()
+	log.Infof("[INFO] api.web.RollbackTuneProfile | tune profile #%d rolled back to #%d by %q", entity.ID, target.ID, author)
+	return mapTuneProfileEntityToRevision(entity), nil
+}
+
+func (s *ControlHandlerService) loadTuneProfileRevision(id int64) (TuneProfileRevision, error) {
+	var log = logger.Logger()
+
+	entity, ok, err := dao.LoadTuneProfile(id)
+	if err != nil {
+		log.Errorf("[ERROR] api.web.loadTuneProfileRevision | failed to load tune profile #%d: %s", id, err.Error())
+		return TuneProfileRevision{}, err
+	}
+	if !ok {
+		return TuneProfileRevision{}, fmt.Errorf("%w: #%d", errTuneProfileNotFound, id)
+	}
+	return mapTuneProfileEntityToRevision(entity), nil
+}
+
+// applyTuneProfile sets the gains of a revision and its output limits when
+// the revision recorded them.
+func (s *ControlHandlerService) applyTuneProfile(entity dao.TuneProfileEntity) {
+	s.tuneState.Set(state.TemperatureKp, entity.ProportionalGain)
+	s.tuneState.Set(state.TemperatureKi, entity.IntegralGain)
+	s.tuneState.Set(state.TemperatureKd, entity.DerivativeGain)
+	if entity.OutputMin != nil && entity.OutputMax != nil {
+		s.tuneState.SetOutputLimits(*entity.OutputMin, *entity.OutputMax)
+	}
+}
+
+// reseedTemperatureLoop seeds the integral from the current temp_co after the
+// gains or the set point changed, so a temperature loop in auto continues
+// from its present output instead of jumping to what the new gains compute.
+func (s *ControlHandlerService) reseedTemperatureLoop() {
+	var log = logger.Logger()
+
+	if s.loopState.Get(state.LoopTemperature).Mode != state.LoopModeAuto {
+		return
+	}
+	modelStateMap := s.modelState.GetAll()
+	pidErr := modelStateMap[state.TemperatureSP] - modelStateMap[state.TemperaturePV]
+	util.InitializeBumpless(modelStateMap[state.TemperatureCO], pidErr, s.integralState, s.tuneState)
+	log.Debugf("[DEBUG] api.web.reseedTemperatureLoop | bumpless from temp_co %.2f", modelStateMap[state.TemperatureCO])
+}
+
+func mapTuneProfileEntityToRevision(entity dao.TuneProfileEntity) TuneProfileRevision {
+	return TuneProfileRevision{
+		ID:               entity.ID,
+		ProportionalGain: entity.ProportionalGain,
+		IntegralGain:     entity.IntegralGain,
+		DerivativeGain:   entity.DerivativeGain,
+		OutputMin:        entity.OutputMin,
+		OutputMax:        entity.OutputMax,
+		Author:           entity.Author,
+		Preset:           entity.Preset,
+		RolledBackFrom:   entity.RolledBackFrom,
+		createdAt:        entity.CreatedAt,
+	}
+}
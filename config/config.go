@@ -0,0 +1,408 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type ServerConfig struct {
+	ListenAddress string
+	CorsOrigins   []string
+	TimeZone      string
+}
+
+type DatabaseConfig struct {
+	Host            string
+	Port            int
+	User            string
+	Password        string
+	Name            string
+	SSLMode         string
+	TimeZone        string
+	MaxIdleConns    int
+	MaxOpenConns    int
+	ConnMaxLifetime time.Duration
+}
+
+type LogConfig struct {
+	Level string
+}
+
+type ControlConfig struct {
+	WaterPumpOnStateDuration time.Duration
+	WaterPumpMaxRun          time.Duration
+	WaterPumpMaxDailyRuntime time.Duration
+	WaterPumpMinOffTime      time.Duration
+	WaterPumpMoistureCeiling float64
+	MoistureAutoThreshold    float64
+	TemperatureSPMin         float64
+	TemperatureSPMax         float64
+	TemperatureCOMin         float64
+	TemperatureCOMax         float64
+	ScheduleTimeZone         string
+	LightSensorUnit          string
+	LightLuxToPPFD           float64
+	LightLampPPFD            float64
+	CO2SPDefault             float64
+	CO2SPMin                 float64
+	CO2SPMax                 float64
+	CO2Hysteresis            float64
+	FanDutyMin               float64
+	FanDutyMax               float64
+	FanRampRate              float64
+	HeaterDutyMax            float64
+	CoolerDutyMax            float64
+	SplitRangeCooling        bool
+	OutputCyclePeriod        time.Duration
+	CommandAckTimeout        time.Duration
+}
+
+type ValidationConfig struct {
+	TemperaturePVMin     float64
+	TemperaturePVMax     float64
+	TemperaturePVMaxStep float64
+	HumidityPVMin        float64
+	HumidityPVMax        float64
+	HumidityPVMaxStep    float64
+	MoisturePVMin        float64
+	MoisturePVMax        float64
+	MoisturePVMaxStep    float64
+	LightPVMax           float64
+	CO2PVMin             float64
+	CO2PVMax             float64
+	CO2PVMaxStep         float64
+	SpikeHistorySize     int
+	VariablesFile        string
+}
+
+type FirmwareConfig struct {
+	Dir     string
+	MaxSize int
+}
+
+// RetentionConfig limits how long raw samples and their hourly and daily
+// rollups are kept; zero keeps them forever.
+type RetentionConfig struct {
+	Raw            time.Duration
+	Hourly         time.Duration
+	Daily          time.Duration
+	RollupInterval time.Duration
+}
+
+// ReportConfig controls the daily summary reports: the temperature band
+// around temp_sp that counts as on target and how often missing reports of
+// completed days are generated.
+type ReportConfig struct {
+	TemperatureBand float64
+	Interval        time.Duration
+}
+
+type Config struct {
+	Server     ServerConfig
+	Database   DatabaseConfig
+	Log        LogConfig
+	Control    ControlConfig
+	Validation ValidationConfig
+	Firmware   FirmwareConfig
+	Retention  RetentionConfig
+	Report     ReportConfig
+}
+
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ListenAddress: ":8080",
+			CorsOrigins:   []string{"*"},
+			TimeZone:      "Asia/Baku",
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5432,
+			SSLMode:         "disable",
+			MaxIdleConns:    10,
+			MaxOpenConns:    100,
+			ConnMaxLifetime: time.Hour,
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Control: ControlConfig{
+			WaterPumpOnStateDuration: 4 * time.Second,
+			WaterPumpMaxRun:          30 * time.Second,
+			WaterPumpMaxDailyRuntime: 10 * time.Minute,
+			WaterPumpMinOffTime:      time.Minute,
+			WaterPumpMoistureCeiling: 80,
+			MoistureAutoThreshold:    30,
+			TemperatureSPMin:         0,
+			TemperatureSPMax:         50,
+			TemperatureCOMin:         -100,
+			TemperatureCOMax:         100,
+			LightSensorUnit:          "lux",
+			LightLuxToPPFD:           0.0185,
+			LightLampPPFD:            0,
+			CO2SPDefault:             800,
+			CO2SPMin:                 400,
+			CO2SPMax:                 1500,
+			CO2Hysteresis:            100,
+			FanDutyMin:               20,
+			FanDutyMax:               100,
+			FanRampRate:              10,
+			HeaterDutyMax:            100,
+			CoolerDutyMax:            100,
+			SplitRangeCooling:        false,
+			OutputCyclePeriod:        time.Minute,
+			CommandAckTimeout:        30 * time.Second,
+		},
+		Validation: ValidationConfig{
+			TemperaturePVMin:     -40,
+			TemperaturePVMax:     85,
+			TemperaturePVMaxStep: 10,
+			HumidityPVMin:        0,
+			HumidityPVMax:        100,
+			HumidityPVMaxStep:    25,
+			MoisturePVMin:        0,
+			MoisturePVMax:        100,
+			MoisturePVMaxStep:    25,
+			LightPVMax:           3000,
+			CO2PVMin:             0,
+			CO2PVMax:             10000,
+			CO2PVMaxStep:         1000,
+			SpikeHistorySize:     5,
+		},
+		Firmware: FirmwareConfig{
+			Dir:     "firmware",
+			MaxSize: 4 << 20,
+		},
+		Retention: RetentionConfig{
+			Raw:            30 * 24 * time.Hour,
+			Hourly:         365 * 24 * time.Hour,
+			Daily:          0,
+			RollupInterval: 10 * time.Minute,
+		},
+		Report: ReportConfig{
+			TemperatureBand: 1,
+			Interval:        time.Hour,
+		},
+	}
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.Server.ListenAddress); err != nil {
+		errs = append(errs, fmt.Errorf("listen-addr %q is not a valid host:port: %w", c.Server.ListenAddress, err))
+	}
+	if len(c.Server.CorsOrigins) == 0 {
+		errs = append(errs, errors.New("cors-origins must contain at least one origin (use * to allow all)"))
+	}
+
+	if _, err := time.LoadLocation(c.Server.TimeZone); err != nil {
+		errs = append(errs, fmt.Errorf("server-timezone %q is not a known time zone: %w", c.Server.TimeZone, err))
+	}
+	if c.Database.Host == "" {
+		errs = append(errs, errors.New("db-host is required"))
+	}
+	if c.Database.Port <= 0 || c.Database.Port > 65535 {
+		errs = append(errs, fmt.Errorf("db-port %d is out of range 1-65535", c.Database.Port))
+	}
+	if c.Database.User == "" {
+		errs = append(errs, errors.New("db-user is required"))
+	}
+	if c.Database.Name == "" {
+		errs = append(errs, errors.New("db-name is required"))
+	}
+	if _, err := time.LoadLocation(c.Database.TimeZone); err != nil {
+		errs = append(errs, fmt.Errorf("db-timezone %q is not a known time zone: %w", c.Database.TimeZone, err))
+	}
+	if c.Database.MaxOpenConns <= 0 {
+		errs = append(errs, fmt.Errorf("db-max-open-conns must be positive, got %d", c.Database.MaxOpenConns))
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("db-max-idle-conns must be between 0 and db-max-open-conns (%d), got %d",
+			c.Database.MaxOpenConns, c.Database.MaxIdleConns))
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		errs = append(errs, fmt.Errorf("db-conn-max-lifetime must not be negative, got %s", c.Database.ConnMaxLifetime))
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error", "fatal", "panic":
+	default:
+		errs = append(errs, fmt.Errorf("log-level %q must be one of debug, info, warn, error, fatal, panic", c.Log.Level))
+	}
+
+	if c.Control.WaterPumpOnStateDuration <= 0 {
+		errs = append(errs, fmt.Errorf("water-pump-on-duration must be positive, got %s", c.Control.WaterPumpOnStateDuration))
+	}
+	if c.Control.WaterPumpMaxRun < c.Control.WaterPumpOnStateDuration {
+		errs = append(errs, fmt.Errorf("water-pump-max-run (%s) must not be shorter than water-pump-on-duration (%s)",
+			c.Control.WaterPumpMaxRun, c.Control.WaterPumpOnStateDuration))
+	}
+	if c.Control.WaterPumpMaxDailyRuntime < c.Control.WaterPumpMaxRun {
+		errs = append(errs, fmt.Errorf("water-pump-max-daily-runtime (%s) must not be shorter than water-pump-max-run (%s)",
+			c.Control.WaterPumpMaxDailyRuntime, c.Control.WaterPumpMaxRun))
+	}
+	if c.Control.WaterPumpMinOffTime < 0 {
+		errs = append(errs, fmt.Errorf("water-pump-min-off-time must not be negative, got %s", c.Control.WaterPumpMinOffTime))
+	}
+	if c.Control.MoistureAutoThreshold >= c.Control.WaterPumpMoistureCeiling {
+		errs = append(errs, fmt.Errorf("moist-auto-threshold (%g) must be below water-pump-moisture-ceiling (%g)",
+			c.Control.MoistureAutoThreshold, c.Control.WaterPumpMoistureCeiling))
+	}
+	if c.Control.TemperatureSPMin >= c.Control.TemperatureSPMax {
+		errs = append(errs, fmt.Errorf("temp-sp-min (%g) must be less than temp-sp-max (%g)",
+			c.Control.TemperatureSPMin, c.Control.TemperatureSPMax))
+	}
+	if c.Control.TemperatureCOMin >= c.Control.TemperatureCOMax {
+		errs = append(errs, fmt.Errorf("temp-co-min (%g) must be less than temp-co-max (%g)",
+			c.Control.TemperatureCOMin, c.Control.TemperatureCOMax))
+	}
+
+	if _, err := time.LoadLocation(c.Control.ScheduleTimeZone); err != nil {
+		errs = append(errs, fmt.Errorf("schedule-timezone %q is not a known time zone: %w", c.Control.ScheduleTimeZone, err))
+	}
+	switch c.Control.LightSensorUnit {
+	case "lux", "ppfd":
+	default:
+		errs = append(errs, fmt.Errorf("light-sensor-unit %q must be lux or ppfd", c.Control.LightSensorUnit))
+	}
+	if c.Control.LightLuxToPPFD <= 0 {
+		errs = append(errs, fmt.Errorf("light-lux-to-ppfd must be positive, got %g", c.Control.LightLuxToPPFD))
+	}
+	if c.Control.LightLampPPFD < 0 {
+		errs = append(errs, fmt.Errorf("light-lamp-ppfd must not be negative, got %g", c.Control.LightLampPPFD))
+	}
+	if c.Control.CO2SPMin >= c.Control.CO2SPMax {
+		errs = append(errs, fmt.Errorf("co2-sp-min (%g) must be less than co2-sp-max (%g)",
+			c.Control.CO2SPMin, c.Control.CO2SPMax))
+	}
+	if c.Control.CO2SPDefault < c.Control.CO2SPMin || c.Control.CO2SPDefault > c.Control.CO2SPMax {
+		errs = append(errs, fmt.Errorf("co2-sp (%g) must be between co2-sp-min (%g) and co2-sp-max (%g)",
+			c.Control.CO2SPDefault, c.Control.CO2SPMin, c.Control.CO2SPMax))
+	}
+	if c.Control.CO2Hysteresis < 0 {
+		errs = append(errs, fmt.Errorf("co2-hysteresis must not be negative, got %g", c.Control.CO2Hysteresis))
+	}
+	if c.Control.FanDutyMin < 0 || c.Control.FanDutyMin >= c.Control.FanDutyMax || c.Control.FanDutyMax > 100 {
+		errs = append(errs, fmt.Errorf("fan-duty-min (%g) and fan-duty-max (%g) must satisfy 0 <= min < max <= 100",
+			c.Control.FanDutyMin, c.Control.FanDutyMax))
+	}
+	if c.Control.FanRampRate < 0 {
+		errs = append(errs, fmt.Errorf("fan-ramp-rate must not be negative, got %g", c.Control.FanRampRate))
+	}
+	if c.Control.HeaterDutyMax <= 0 || c.Control.HeaterDutyMax > 100 {
+		errs = append(errs, fmt.Errorf("heater-duty-max must be in (0, 100], got %g", c.Control.HeaterDutyMax))
+	}
+	if c.Control.CoolerDutyMax <= 0 || c.Control.CoolerDutyMax > 100 {
+		errs = append(errs, fmt.Errorf("cooler-duty-max must be in (0, 100], got %g", c.Control.CoolerDutyMax))
+	}
+	if c.Control.OutputCyclePeriod < time.Second {
+		errs = append(errs, fmt.Errorf("output-cycle-period must be at least 1s, got %s", c.Control.OutputCyclePeriod))
+	}
+	if c.Control.CommandAckTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("command-ack-timeout must be positive, got %s", c.Control.CommandAckTimeout))
+	}
+	if c.Validation.LightPVMax <= 0 {
+		errs = append(errs, fmt.Errorf("light-pv-max must be positive, got %g", c.Validation.LightPVMax))
+	}
+
+	ranges := []struct {
+		name           string
+		min, max, step float64
+	}{
+		{"temp-pv", c.Validation.TemperaturePVMin, c.Validation.TemperaturePVMax, c.Validation.TemperaturePVMaxStep},
+		{"humidity-pv", c.Validation.HumidityPVMin, c.Validation.HumidityPVMax, c.Validation.HumidityPVMaxStep},
+		{"moist-pv", c.Validation.MoisturePVMin, c.Validation.MoisturePVMax, c.Validation.MoisturePVMaxStep},
+		{"co2-pv", c.Validation.CO2PVMin, c.Validation.CO2PVMax, c.Validation.CO2PVMaxStep},
+	}
+	for _, r := range ranges {
+		if r.min >= r.max {
+			errs = append(errs, fmt.Errorf("%s-min (%g) must be less than %s-max (%g)", r.name, r.min, r.name, r.max))
+		}
+		if r.step <= 0 {
+			errs = append(errs, fmt.Errorf("%s-max-step must be positive, got %g", r.name, r.step))
+		}
+	}
+	if c.Validation.SpikeHistorySize < 1 {
+		errs = append(errs, fmt.Errorf("spike-history-size must be at least 1, got %d", c.Validation.SpikeHistorySize))
+	}
+
+	if c.Firmware.Dir == "" {
+		errs = append(errs, fmt.Errorf("firmware-dir must not be empty"))
+	}
+	if c.Firmware.MaxSize <= 0 {
+		errs = append(errs, fmt.Errorf("firmware-max-size must be positive, got %d", c.Firmware.MaxSize))
+	}
+
+	if c.Retention.Raw != 0 && c.Retention.Raw < 48*time.Hour {
+		errs = append(errs, fmt.Errorf("raw-retention must be 0 (keep forever) or at least 48h, got %s", c.Retention.Raw))
+	}
+	if c.Retention.Hourly != 0 && c.Retention.Hourly < 48*time.Hour {
+		errs = append(errs, fmt.Errorf("hourly-retention must be 0 (keep forever) or at least 48h, got %s", c.Retention.Hourly))
+	}
+	if c.Retention.Daily < 0 {
+		errs = append(errs, fmt.Errorf("daily-retention must not be negative, got %s", c.Retention.Daily))
+	}
+	if c.Retention.RollupInterval < time.Minute {
+		errs = append(errs, fmt.Errorf("rollup-interval must be at least 1m, got %s", c.Retention.RollupInterval))
+	}
+	if c.Report.TemperatureBand <= 0 {
+		errs = append(errs, fmt.Errorf("report-temp-band must be positive, got %g", c.Report.TemperatureBand))
+	}
+	if c.Report.Interval < time.Minute {
+		errs = append(errs, fmt.Errorf("report-interval must be at least 1m, got %s", c.Report.Interval))
+	}
+
+	return errors.Join(errs...)
+}
+
+// inheritTimeZones lets the database session and the schedules follow the
+// server time zone unless they are configured separately.
+func (c *Config) inheritTimeZones() {
+	if c.Database.TimeZone == "" {
+		c.Database.TimeZone = c.Server.TimeZone
+	}
+	if c.Control.ScheduleTimeZone == "" {
+		c.Control.ScheduleTimeZone = c.Server.TimeZone
+	}
+}
+
+// Location is the server time zone; timestamps are displayed in it unless a
+// request asks for another one.
+func (c ServerConfig) Location() *time.Location {
+	location, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// ScheduleLocation is the time zone in which schedule clock times are read.
+func (c ControlConfig) ScheduleLocation() *time.Location {
+	location, err := time.LoadLocation(c.ScheduleTimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// ImagePath is where the image of a firmware version is stored.
+func (c FirmwareConfig) ImagePath(version string) string {
+	return filepath.Join(c.Dir, version+".bin")
+}
+
+func (c *Config) Redacted() string {
+	var sb strings.Builder
+	for _, f := range c.fields() {
+		value := f.get()
+		if f.secret && value != "" {
+			value = "******"
+		}
+		fmt.Fprintf(&sb, "  %-26s = %s\n", f.flag, value)
+	}
+	return sb.String()
+}
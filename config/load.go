@@ -0,0 +1,299 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Sources are applied in increasing order of precedence:
+// defaults < config file (-config) < env files (-env-file) < process environment < flags.
+
+const defaultEnvFiles = ".env.local,.env.cloud"
+
+var current = Default()
+
+func Get() *Config {
+	return current
+}
+
+type field struct {
+	flag   string
+	env    string
+	usage  string
+	secret bool
+	ptr    any
+}
+
+func (c *Config) fields() []field {
+	return []field{
+		{flag: "listen-addr", env: "LISTEN_ADDR", usage: "HTTP listen address", ptr: &c.Server.ListenAddress},
+		{flag: "cors-origins", env: "CORS_ORIGINS", usage: "comma-separated list of allowed CORS origins", ptr: &c.Server.CorsOrigins},
+		{flag: "server-timezone", env: "SERVER_TIMEZONE", usage: "server time zone, used for displayed timestamps and as default of db-timezone and schedule-timezone", ptr: &c.Server.TimeZone},
+		{flag: "db-host", env: "DB_HOST", usage: "database host", ptr: &c.Database.Host},
+		{flag: "db-port", env: "DB_PORT", usage: "database port", ptr: &c.Database.Port},
+		{flag: "db-user", env: "DB_USER", usage: "database user", ptr: &c.Database.User},
+		{flag: "db-pass", env: "DB_PASS", usage: "database password", secret: true, ptr: &c.Database.Password},
+		{flag: "db-name", env: "DB_NAME", usage: "database name", ptr: &c.Database.Name},
+		{flag: "db-sslmode", env: "DB_SSLMODE", usage: "database sslmode", ptr: &c.Database.SSLMode},
+		{flag: "db-timezone", env: "DB_TIMEZONE", usage: "database session time zone (defaults to server-timezone)", ptr: &c.Database.TimeZone},
+		{flag: "db-max-idle-conns", env: "DB_MAX_IDLE_CONNS", usage: "maximum idle database connections", ptr: &c.Database.MaxIdleConns},
+		{flag: "db-max-open-conns", env: "DB_MAX_OPEN_CONNS", usage: "maximum open database connections", ptr: &c.Database.MaxOpenConns},
+		{flag: "db-conn-max-lifetime", env: "DB_CONN_MAX_LIFETIME", usage: "maximum database connection lifetime", ptr: &c.Database.ConnMaxLifetime},
+		{flag: "log-level", env: "LOG_LEVEL", usage: "log level (debug, info, warn, error, fatal, panic)", ptr: &c.Log.Level},
+		{flag: "water-pump-on-duration", env: "WATER_PUMP_ON_STATE_DURATION", usage: "water pump on-time per activation", ptr: &c.Control.WaterPumpOnStateDuration},
+		{flag: "water-pump-max-run", env: "WATER_PUMP_MAX_RUN", usage: "longest accepted single water pump run", ptr: &c.Control.WaterPumpMaxRun},
+		{flag: "water-pump-max-daily-runtime", env: "WATER_PUMP_MAX_DAILY_RUNTIME", usage: "water pump runtime allowed per rolling 24 h", ptr: &c.Control.WaterPumpMaxDailyRuntime},
+		{flag: "water-pump-min-off-time", env: "WATER_PUMP_MIN_OFF_TIME", usage: "minimum pause between two water pump runs", ptr: &c.Control.WaterPumpMinOffTime},
+		{flag: "water-pump-moisture-ceiling", env: "WATER_PUMP_MOISTURE_CEILING", usage: "moist_pv above which the water pump is locked out", ptr: &c.Control.WaterPumpMoistureCeiling},
+		{flag: "moist-auto-threshold", env: "MOIST_AUTO_THRESHOLD", usage: "moist_pv below which the moisture loop waters in auto mode", ptr: &c.Control.MoistureAutoThreshold},
+		{flag: "temp-sp-min", env: "TEMP_SP_MIN", usage: "lowest accepted temperature set-point", ptr: &c.Control.TemperatureSPMin},
+		{flag: "temp-sp-max", env: "TEMP_SP_MAX", usage: "highest accepted temperature set-point", ptr: &c.Control.TemperatureSPMax},
+		{flag: "temp-co-min", env: "TEMP_CO_MIN", usage: "lower clamp of the temperature controller output", ptr: &c.Control.TemperatureCOMin},
+		{flag: "temp-co-max", env: "TEMP_CO_MAX", usage: "upper clamp of the temperature controller output", ptr: &c.Control.TemperatureCOMax},
+		{flag: "schedule-timezone", env: "SCHEDULE_TIMEZONE", usage: "time zone of schedule clock times (defaults to server-timezone)", ptr: &c.Control.ScheduleTimeZone},
+		{flag: "light-sensor-unit", env: "LIGHT_SENSOR_UNIT", usage: "unit reported as light_pv (lux or ppfd)", ptr: &c.Control.LightSensorUnit},
+		{flag: "light-lux-to-ppfd", env: "LIGHT_LUX_TO_PPFD", usage: "PPFD per lux used to convert light_pv", ptr: &c.Control.LightLuxToPPFD},
+		{flag: "light-lamp-ppfd", env: "LIGHT_LAMP_PPFD", usage: "PPFD added by the grow lights at canopy level", ptr: &c.Control.LightLampPPFD},
+		{flag: "co2-sp", env: "CO2_SP", usage: "initial CO2 set-point in ppm", ptr: &c.Control.CO2SPDefault},
+		{flag: "co2-sp-min", env: "CO2_SP_MIN", usage: "lowest accepted CO2 set-point in ppm", ptr: &c.Control.CO2SPMin},
+		{flag: "co2-sp-max", env: "CO2_SP_MAX", usage: "highest accepted CO2 set-point in ppm", ptr: &c.Control.CO2SPMax},
+		{flag: "co2-hysteresis", env: "CO2_HYSTERESIS", usage: "switching band of the CO2 valve around the set-point in ppm", ptr: &c.Control.CO2Hysteresis},
+		{flag: "fan-duty-min", env: "FAN_DUTY_MIN", usage: "lowest duty in % a running fan is driven with", ptr: &c.Control.FanDutyMin},
+		{flag: "fan-duty-max", env: "FAN_DUTY_MAX", usage: "highest fan duty in %", ptr: &c.Control.FanDutyMax},
+		{flag: "fan-ramp-rate", env: "FAN_RAMP_RATE", usage: "fan duty change per second in % (0 disables ramping)", ptr: &c.Control.FanRampRate},
+		{flag: "heater-duty-max", env: "HEATER_DUTY_MAX", usage: "highest heater duty in %", ptr: &c.Control.HeaterDutyMax},
+		{flag: "cooler-duty-max", env: "COOLER_DUTY_MAX", usage: "highest cooling fan duty in % in split-range mode", ptr: &c.Control.CoolerDutyMax},
+		{flag: "split-range-cooling", env: "SPLIT_RANGE_COOLING", usage: "use the fan for negative temperature controller output", ptr: &c.Control.SplitRangeCooling},
+		{flag: "output-cycle-period", env: "OUTPUT_CYCLE_PERIOD", usage: "cycle period of time-proportioned heater output", ptr: &c.Control.OutputCyclePeriod},
+		{flag: "command-ack-timeout", env: "COMMAND_ACK_TIMEOUT", usage: "time a delivered ESP command may stay unacknowledged", ptr: &c.Control.CommandAckTimeout},
+		{flag: "temp-pv-min", env: "TEMP_PV_MIN", usage: "lowest plausible temp_pv", ptr: &c.Validation.TemperaturePVMin},
+		{flag: "temp-pv-max", env: "TEMP_PV_MAX", usage: "highest plausible temp_pv", ptr: &c.Validation.TemperaturePVMax},
+		{flag: "temp-pv-max-step", env: "TEMP_PV_MAX_STEP", usage: "largest temp_pv deviation from recent history before it is a spike", ptr: &c.Validation.TemperaturePVMaxStep},
+		{flag: "humidity-pv-min", env: "HUMIDITY_PV_MIN", usage: "lowest plausible humidity_pv", ptr: &c.Validation.HumidityPVMin},
+		{flag: "humidity-pv-max", env: "HUMIDITY_PV_MAX", usage: "highest plausible humidity_pv", ptr: &c.Validation.HumidityPVMax},
+		{flag: "humidity-pv-max-step", env: "HUMIDITY_PV_MAX_STEP", usage: "largest humidity_pv deviation from recent history before it is a spike", ptr: &c.Validation.HumidityPVMaxStep},
+		{flag: "moist-pv-min", env: "MOIST_PV_MIN", usage: "lowest plausible moist_pv", ptr: &c.Validation.MoisturePVMin},
+		{flag: "moist-pv-max", env: "MOIST_PV_MAX", usage: "highest plausible moist_pv", ptr: &c.Validation.MoisturePVMax},
+		{flag: "moist-pv-max-step", env: "MOIST_PV_MAX_STEP", usage: "largest moist_pv deviation from recent history before it is a spike", ptr: &c.Validation.MoisturePVMaxStep},
+		{flag: "light-pv-max", env: "LIGHT_PV_MAX", usage: "highest plausible light_pv in µmol/m²/s", ptr: &c.Validation.LightPVMax},
+		{flag: "co2-pv-min", env: "CO2_PV_MIN", usage: "lowest plausible co2_pv in ppm", ptr: &c.Validation.CO2PVMin},
+		{flag: "co2-pv-max", env: "CO2_PV_MAX", usage: "highest plausible co2_pv in ppm", ptr: &c.Validation.CO2PVMax},
+		{flag: "co2-pv-max-step", env: "CO2_PV_MAX_STEP", usage: "largest plausible co2_pv change from the recent median", ptr: &c.Validation.CO2PVMaxStep},
+		{flag: "variables-file", env: "VARIABLES_FILE", usage: "JSON file with additional measured variables", ptr: &c.Validation.VariablesFile},
+		{flag: "spike-history-size", env: "SPIKE_HISTORY_SIZE", usage: "number of accepted samples used for spike detection", ptr: &c.Validation.SpikeHistorySize},
+		{flag: "firmware-dir", env: "FIRMWARE_DIR", usage: "directory firmware images are stored in", ptr: &c.Firmware.Dir},
+		{flag: "firmware-max-size", env: "FIRMWARE_MAX_SIZE", usage: "largest accepted firmware image in bytes", ptr: &c.Firmware.MaxSize},
+		{flag: "raw-retention", env: "RAW_RETENTION", usage: "how long raw samples are kept (0 keeps them forever)", ptr: &c.Retention.Raw},
+		{flag: "hourly-retention", env: "HOURLY_RETENTION", usage: "how long hourly rollups are kept (0 keeps them forever)", ptr: &c.Retention.Hourly},
+		{flag: "daily-retention", env: "DAILY_RETENTION", usage: "how long daily rollups are kept (0 keeps them forever)", ptr: &c.Retention.Daily},
+		{flag: "rollup-interval", env: "ROLLUP_INTERVAL", usage: "how often rollups are computed and expired data is deleted", ptr: &c.Retention.RollupInterval},
+		{flag: "report-temp-band", env: "REPORT_TEMP_BAND", usage: "largest |temp_sp - temp_pv| a daily report counts as on target", ptr: &c.Report.TemperatureBand},
+		{flag: "report-interval", env: "REPORT_INTERVAL", usage: "how often missing daily reports of completed days are generated", ptr: &c.Report.Interval},
+	}
+}
+
+func (f field) get() string {
+	switch p := f.ptr.(type) {
+	case *string:
+		return *p
+	case *int:
+		return strconv.Itoa(*p)
+	case *float64:
+		return strconv.FormatFloat(*p, 'g', -1, 64)
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *time.Duration:
+		return p.String()
+	case *[]string:
+		return strings.Join(*p, ",")
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %T", f.ptr))
+	}
+}
+
+func (f field) set(value string) error {
+	value = strings.TrimSpace(value)
+	switch p := f.ptr.(type) {
+	case *string:
+		*p = value
+	case *int:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", f.flag, value)
+		}
+		*p = v
+	case *float64:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", f.flag, value)
+		}
+		*p = v
+	case *bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", f.flag, value)
+		}
+		*p = v
+	case *time.Duration:
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration (e.g. 4s, 1h)", f.flag, value)
+		}
+		*p = v
+	case *[]string:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*p = items
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %T", f.ptr))
+	}
+	return nil
+}
+
+// Load builds the effective configuration from all sources and validates it.
+// The returned config is never nil so callers can still initialise logging
+// from it before reporting the error.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	fields := cfg.fields()
+
+	fs := flag.NewFlagSet("solflora", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	configFile := fs.String("config", os.Getenv("SOLFLORA_CONFIG"), "path to a JSON config file")
+	envFiles := fs.String("env-file", defaultEnvFiles, "comma-separated list of env files")
+	flagValues := make(map[string]*string, len(fields))
+	for _, f := range fields {
+		flagValues[f.flag] = fs.String(f.flag, "", f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, fmt.Errorf("config: invalid command line: %w", err)
+	}
+
+	var errs []error
+
+	if *configFile != "" {
+		if err := applyFile(fields, *configFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	envValues, err := readEnvFiles(*envFiles, *envFiles != defaultEnvFiles)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, f := range fields {
+		value, ok := os.LookupEnv(f.env)
+		if !ok {
+			value, ok = envValues[f.env]
+		}
+		if ok {
+			if err := f.set(value); err != nil {
+				errs = append(errs, fmt.Errorf("config: env %s: %w", f.env, err))
+			}
+		}
+	}
+
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if f.flag == fl.Name {
+				if err := f.set(*flagValues[f.flag]); err != nil {
+					errs = append(errs, fmt.Errorf("config: flag -%w", err))
+				}
+			}
+		}
+	})
+
+	cfg.inheritTimeZones()
+	if len(errs) == 0 {
+		if err := cfg.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("config: invalid configuration:\n%w", err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return cfg, err
+	}
+
+	current = cfg
+	return cfg, nil
+}
+
+func applyFile(fields []field, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: cannot read config file: %w", err)
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(content, &values); err != nil {
+		return fmt.Errorf("config: %s is not a valid JSON object: %w", path, err)
+	}
+
+	var errs []error
+	known := make(map[string]field, len(fields))
+	for _, f := range fields {
+		known[f.flag] = f
+	}
+	for key, raw := range values {
+		f, ok := known[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("config: %s: unknown key %q", path, key))
+			continue
+		}
+		if err := f.set(jsonValueToString(raw)); err != nil {
+			errs = append(errs, fmt.Errorf("config: %s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func jsonValueToString(raw any) string {
+	switch v := raw.(type) {
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ",")
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// readEnvFiles merges the given env files, later files overriding earlier ones.
+// Missing files are only an error when the list was given explicitly.
+func readEnvFiles(list string, required bool) (map[string]string, error) {
+	merged := make(map[string]string)
+	for _, path := range strings.Split(list, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) && !required {
+			continue
+		}
+
+		values, err := godotenv.Read(path)
+		if err != nil {
+			return merged, fmt.Errorf("config: cannot read env file %s: %w", path, err)
+		}
+		for k, v := range values {
+			merged[k] = v
+		}
+	}
+	return merged, nil
+}
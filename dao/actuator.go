@@ -0,0 +1,79 @@
+package dao
+
+import (
+	"Solflora/db"
+	"Solflora/state"
+	"time"
+)
+
+// ActuatorEventEntity is one actuator transition. Duration is how long the
+// actuator kept the value; it is nil while the value is still in effect.
+type ActuatorEventEntity struct {
+	Transition state.ActuatorTransition
+	Duration   *time.Duration
+}
+
+func (actuatorEventEntity *ActuatorEventEntity) Commit() error {
+	transition := actuatorEventEntity.Transition
+	return insert("actuator_event", `
+		INSERT INTO actuator_event (device_id, actuator, value, source, started_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, transition.DeviceID, transition.Actuator, transition.Value, transition.Source, transition.Time)
+}
+
+// Close stores the duration of the transition once the next one ends it.
+func (actuatorEventEntity *ActuatorEventEntity) Close(end time.Time) error {
+	transition := actuatorEventEntity.Transition
+	return insert("actuator_event", `
+		UPDATE actuator_event SET duration_ms = $4
+		WHERE device_id = $1 AND actuator = $2 AND started_at = $3 AND duration_ms IS NULL
+	`, transition.DeviceID, transition.Actuator, transition.Time, end.Sub(transition.Time).Milliseconds())
+}
+
+// CloseOpenActuatorEvents ends every transition still in effect at the given
+// time. The actuators start switched off after a restart, so the values
+// recorded before it do not carry over.
+func CloseOpenActuatorEvents(at time.Time) (int64, error) {
+	result, err := db.DB.Exec(`
+		UPDATE actuator_event
+		SET duration_ms = GREATEST(0, (EXTRACT(EPOCH FROM ($1::timestamptz - started_at)) * 1000)::BIGINT)
+		WHERE duration_ms IS NULL`, at)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// LoadActuatorEvents returns the transitions in effect during [from, to),
+// including the one that was active at from, ordered by time. An empty
+// deviceID or actuator selects all of them.
+func LoadActuatorEvents(deviceID string, actuator state.DeviceControlVariable, from time.Time, to time.Time) ([]ActuatorEventEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT device_id, actuator, value, source, started_at, duration_ms
+		FROM actuator_event
+		WHERE started_at < $2
+		  AND (duration_ms IS NULL OR started_at + duration_ms * INTERVAL '1 millisecond' > $1)
+		  AND ($3::text = '' OR device_id = $3::text)
+		  AND ($4::text = '' OR actuator = $4::text)
+		ORDER BY started_at, id`, from, to, deviceID, string(actuator))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := []ActuatorEventEntity{}
+	for rows.Next() {
+		var entity ActuatorEventEntity
+		var durationMs *int64
+		if err := rows.Scan(&entity.Transition.DeviceID, &entity.Transition.Actuator, &entity.Transition.Value,
+			&entity.Transition.Source, &entity.Transition.Time, &durationMs); err != nil {
+			return nil, err
+		}
+		if durationMs != nil {
+			duration := time.Duration(*durationMs) * time.Millisecond
+			entity.Duration = &duration
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
@@ -0,0 +1,15 @@
+package dao
+
+// AlarmEntity is an audit entry for refused commands and safety trips.
+type AlarmEntity struct {
+	Source  string
+	Code    string
+	Message string
+}
+
+func (alarmEntity *AlarmEntity) Commit() error {
+	return insert("alarm", `
+		INSERT INTO alarm (source, code, message)
+		VALUES ($1, $2, $3)
+	`, alarmEntity.Source, alarmEntity.Code, alarmEntity.Message)
+}
@@ -0,0 +1,132 @@
+package dao
+
+import (
+	"Solflora/db"
+	"Solflora/state"
+	"encoding/json"
+)
+
+type SensorCalibrationEntity struct {
+	DeviceID    string
+	Variable    state.ConditionVariable
+	Calibration state.Calibration
+}
+
+type CalibrationPointEntity struct {
+	DeviceID string
+	Variable state.ConditionVariable
+	Point    state.CalibrationPoint
+}
+
+func (calEntity *SensorCalibrationEntity) Commit() error {
+	return calEntity.commit(db.DB)
+}
+
+func (calEntity *SensorCalibrationEntity) commit(ex executor) error {
+	points, err := json.Marshal(calEntity.Calibration.Points)
+	if err != nil {
+		return err
+	}
+
+	return insertWith(ex, "sensor_calibration", `
+		INSERT INTO sensor_calibration (device_id, variable, offset_value, gain, points, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (device_id, variable) DO UPDATE
+		SET offset_value = EXCLUDED.offset_value, gain = EXCLUDED.gain,
+		    points = EXCLUDED.points, updated_at = EXCLUDED.updated_at
+	`, calEntity.DeviceID, calEntity.Variable, calEntity.Calibration.Offset, calEntity.Calibration.Gain, string(points))
+}
+
+// DeleteSensorCalibration removes the calibration together with its recorded
+// points, so the next point starts a new curve.
+func DeleteSensorCalibration(deviceID string, variable state.ConditionVariable) error {
+	_, err := db.DB.Exec(`
+		WITH points AS (
+			DELETE FROM calibration_point
+			WHERE device_id = $1 AND variable = $2
+		)
+		DELETE FROM sensor_calibration
+		WHERE device_id = $1 AND variable = $2
+	`, deviceID, variable)
+	return err
+}
+
+func LoadSensorCalibrations() ([]SensorCalibrationEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT device_id, variable, offset_value, gain, points
+		FROM sensor_calibration`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []SensorCalibrationEntity
+	for rows.Next() {
+		var entity SensorCalibrationEntity
+		var points []byte
+		if err := rows.Scan(&entity.DeviceID, &entity.Variable, &entity.Calibration.Offset,
+			&entity.Calibration.Gain, &points); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(points, &entity.Calibration.Points); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
+
+func (pointEntity *CalibrationPointEntity) Commit() error {
+	return pointEntity.commit(db.DB)
+}
+
+func (pointEntity *CalibrationPointEntity) commit(ex executor) error {
+	return insertWith(ex, "calibration_point", `
+		INSERT INTO calibration_point (device_id, variable, label, raw_value, reference_value)
+		VALUES ($1, $2, $3, $4, $5)
+	`, pointEntity.DeviceID, pointEntity.Variable, pointEntity.Point.Label,
+		pointEntity.Point.RawValue, pointEntity.Point.ReferenceValue)
+}
+
+// CommitCalibrationPoint stores a point together with the calibration rebuilt
+// from it in one transaction, so neither is stored without the other.
+func CommitCalibrationPoint(pointEntity *CalibrationPointEntity, calEntity *SensorCalibrationEntity) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if err := pointEntity.commit(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := calEntity.commit(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// LoadLatestCalibrationPoints returns the most recent point for every label,
+// so re-recording "dry" replaces the previous dry reading.
+func LoadLatestCalibrationPoints(deviceID string, variable state.ConditionVariable) ([]state.CalibrationPoint, error) {
+	rows, err := db.DB.Query(`
+		SELECT DISTINCT ON (label) label, raw_value, reference_value
+		FROM calibration_point
+		WHERE device_id = $1 AND variable = $2
+		ORDER BY label, created_at DESC
+	`, deviceID, variable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []state.CalibrationPoint
+	for rows.Next() {
+		var point state.CalibrationPoint
+		if err := rows.Scan(&point.Label, &point.RawValue, &point.ReferenceValue); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
@@ -2,71 +2,104 @@ package dao
 
 import (
 	"Solflora/db"
+	"Solflora/metrics"
 	"Solflora/state"
+	"database/sql"
+	"time"
 )
 
 type TemperatureEntity struct {
+	DeviceID         string
 	PresentValue     float64
+	RawValue         float64
+	FilteredValue    *float64
 	ControllerOutput float64
 	SetPoint         float64
+	Quality          state.SampleQuality
 }
 
 type HumidityEntity struct {
-	PresentValue float64
+	DeviceID      string
+	PresentValue  float64
+	RawValue      float64
+	FilteredValue *float64
+	Quality       state.SampleQuality
 }
 
 type MoistureEntity struct {
-	PresentValue float64
+	DeviceID      string
+	PresentValue  float64
+	RawValue      float64
+	FilteredValue *float64
+	Quality       state.SampleQuality
 }
 
+// TuneProfileEntity is one row of the gain history; ID and CreatedAt are set
+// by Commit. RolledBackFrom names the revision a rollback re-applied and
+// Preset the preset an apply came from. The output limits are nil on rows
+// written before they were recorded.
 type TuneProfileEntity struct {
+	ID               int64
 	ProportionalGain float64
 	IntegralGain     float64
 	DerivativeGain   float64
+	OutputMin        *float64
+	OutputMax        *float64
+	Author           string
+	Preset           string
+	RolledBackFrom   *int64
+	CreatedAt        time.Time
 }
 
 func BuildTemperature(modelStateMap map[state.ConditionVariable]float64) TemperatureEntity {
 	return TemperatureEntity{
+		DeviceID:         state.DefaultDeviceID,
 		PresentValue:     modelStateMap[state.TemperaturePV],
+		RawValue:         modelStateMap[state.TemperaturePV],
 		ControllerOutput: modelStateMap[state.TemperatureCO],
 		SetPoint:         modelStateMap[state.TemperatureSP],
+		Quality:          state.QualityGood,
 	}
 }
 
 func (tempEntity *TemperatureEntity) Commit() error {
-	_, err := db.DB.Exec(`
-		INSERT INTO temperature (present_value, controller_output, set_point)
-		VALUES ($1, $2, $3)
-	`, tempEntity.PresentValue, tempEntity.ControllerOutput, tempEntity.SetPoint)
-	return err
+	return insert("temperature", `
+		INSERT INTO temperature (device_id, present_value, raw_value, filtered_value, controller_output, set_point, quality)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, tempEntity.DeviceID, tempEntity.PresentValue, tempEntity.RawValue, tempEntity.FilteredValue,
+		tempEntity.ControllerOutput, tempEntity.SetPoint, tempEntity.Quality)
 }
 
 func BuildHumidity(modelStateMap map[state.ConditionVariable]float64) HumidityEntity {
 	return HumidityEntity{
+		DeviceID:     state.DefaultDeviceID,
 		PresentValue: modelStateMap[state.HumidityPV],
+		RawValue:     modelStateMap[state.HumidityPV],
+		Quality:      state.QualityGood,
 	}
 }
 
 func (humEntity *HumidityEntity) Commit() error {
-	_, err := db.DB.Exec(`
-		INSERT INTO humidity (present_value)
-		VALUES ($1)
-	`, humEntity.PresentValue)
-	return err
+	return insert("humidity", `
+		INSERT INTO humidity (device_id, present_value, raw_value, filtered_value, quality)
+		VALUES ($1, $2, $3, $4, $5)
+	`, humEntity.DeviceID, humEntity.PresentValue, humEntity.RawValue, humEntity.FilteredValue, humEntity.Quality)
 }
 
 func BuildMoisture(modelStateMap map[state.ConditionVariable]float64) MoistureEntity {
 	return MoistureEntity{
+		DeviceID:     state.DefaultDeviceID,
 		PresentValue: modelStateMap[state.MoisturePV],
+		RawValue:     modelStateMap[state.MoisturePV],
+		Quality:      state.QualityGood,
 	}
 }
 
 func (moistEntity *MoistureEntity) Commit() error {
-	_, err := db.DB.Exec(`
-		INSERT INTO moisture (present_value)
-		VALUES ($1)
-	`, moistEntity.PresentValue)
-	return err
+	return insert("moisture", `
+		INSERT INTO moisture (device_id, present_value, raw_value, filtered_value, quality)
+		VALUES ($1, $2, $3, $4, $5)
+	`, moistEntity.DeviceID, moistEntity.PresentValue, moistEntity.RawValue, moistEntity.FilteredValue, moistEntity.Quality)
 }
 
 func BuildTuneProfile(tuneStateMap map[state.TuneVariable]float64) TuneProfileEntity {
@@ -78,9 +111,29 @@ func BuildTuneProfile(tuneStateMap map[state.TuneVariable]float64) TuneProfileEn
 }
 
 func (tuneEntity *TuneProfileEntity) Commit() error {
-	_, err := db.DB.Exec(`
-		INSERT INTO tune_profile (proportional_gain, integral_gain, derivative_gain)
-		VALUES ($1, $2, $3)
-	`, tuneEntity.ProportionalGain, tuneEntity.IntegralGain, tuneEntity.DerivativeGain)
+	start := time.Now()
+	err := db.DB.QueryRow(`
+		INSERT INTO tune_profile (proportional_gain, integral_gain, derivative_gain, output_min, output_max, author, preset, rolled_back_from)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, tuneEntity.ProportionalGain, tuneEntity.IntegralGain, tuneEntity.DerivativeGain, tuneEntity.OutputMin, tuneEntity.OutputMax,
+		tuneEntity.Author, tuneEntity.Preset, tuneEntity.RolledBackFrom).Scan(&tuneEntity.ID, &tuneEntity.CreatedAt)
+	metrics.ObserveDbInsert("tune_profile", start, err)
+	return err
+}
+
+// executor is what insertWith runs a statement on: the pool or a transaction.
+type executor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insert(table string, query string, args ...any) error {
+	return insertWith(db.DB, table, query, args...)
+}
+
+func insertWith(ex executor, table string, query string, args ...any) error {
+	start := time.Now()
+	_, err := ex.Exec(query, args...)
+	metrics.ObserveDbInsert(table, start, err)
 	return err
 }
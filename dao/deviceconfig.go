@@ -0,0 +1,51 @@
+package dao
+
+import (
+	"Solflora/db"
+	"Solflora/state"
+	"encoding/json"
+)
+
+// DeviceConfigEntity is one version of a device configuration; versions are
+// kept, so earlier documents stay available.
+type DeviceConfigEntity struct {
+	DeviceID string
+	Config   state.VersionedDeviceConfig
+}
+
+func (deviceConfigEntity *DeviceConfigEntity) Commit() error {
+	document, err := json.Marshal(deviceConfigEntity.Config.DeviceConfig)
+	if err != nil {
+		return err
+	}
+	return insert("device_config", `
+		INSERT INTO device_config (device_id, version, document, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, deviceConfigEntity.DeviceID, deviceConfigEntity.Config.Version, document, deviceConfigEntity.Config.UpdatedAt)
+}
+
+// LoadDeviceConfigs returns the newest version per device.
+func LoadDeviceConfigs() ([]DeviceConfigEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT DISTINCT ON (device_id) device_id, version, document, created_at
+		FROM device_config
+		ORDER BY device_id, version DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []DeviceConfigEntity
+	for rows.Next() {
+		var entity DeviceConfigEntity
+		var document []byte
+		if err := rows.Scan(&entity.DeviceID, &entity.Config.Version, &document, &entity.Config.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(document, &entity.Config.DeviceConfig); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
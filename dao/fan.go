@@ -0,0 +1,56 @@
+package dao
+
+import (
+	"Solflora/db"
+	"Solflora/state"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// FanSettingsEntity is the single persisted fan configuration.
+type FanSettingsEntity struct {
+	Settings state.FanSettings
+}
+
+func (fanSettingsEntity *FanSettingsEntity) Commit() error {
+	return insert("fan_settings", `
+		INSERT INTO fan_settings (id, mode, manual_duty, start_value, full_value, updated_at)
+		VALUES (1, $1, $2, $3, $4, NOW())
+		ON CONFLICT (id) DO UPDATE
+		SET mode = EXCLUDED.mode, manual_duty = EXCLUDED.manual_duty, start_value = EXCLUDED.start_value,
+		    full_value = EXCLUDED.full_value, updated_at = EXCLUDED.updated_at
+	`, fanSettingsEntity.Settings.Mode, fanSettingsEntity.Settings.ManualDuty,
+		fanSettingsEntity.Settings.StartValue, fanSettingsEntity.Settings.FullValue)
+}
+
+// LoadFanSettings returns ok=false when no settings have been stored yet.
+func LoadFanSettings() (FanSettingsEntity, bool, error) {
+	var entity FanSettingsEntity
+	err := db.DB.QueryRow(`
+		SELECT mode, manual_duty, start_value, full_value
+		FROM fan_settings
+		WHERE id = 1`).Scan(&entity.Settings.Mode, &entity.Settings.ManualDuty,
+		&entity.Settings.StartValue, &entity.Settings.FullValue)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity, false, nil
+	}
+	if err != nil {
+		return entity, false, err
+	}
+	return entity, true, nil
+}
+
+// FanRunEntity is one period the fan was on, stored when it switches off.
+type FanRunEntity struct {
+	DeviceID string
+	Start    time.Time
+	Duration time.Duration
+}
+
+func (fanRunEntity *FanRunEntity) Commit() error {
+	return insert("fan_run", `
+		INSERT INTO fan_run (device_id, started_at, duration_ms)
+		VALUES ($1, $2, $3)
+	`, fanRunEntity.DeviceID, fanRunEntity.Start, fanRunEntity.Duration.Milliseconds())
+}
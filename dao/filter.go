@@ -0,0 +1,44 @@
+package dao
+
+import (
+	"Solflora/db"
+	"Solflora/state"
+)
+
+type SignalFilterEntity struct {
+	Variable state.ConditionVariable
+	Config   state.FilterConfig
+}
+
+func (filterEntity *SignalFilterEntity) Commit() error {
+	return insert("signal_filter", `
+		INSERT INTO signal_filter (variable, kind, window_size, alpha, process_noise, measurement_noise, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (variable) DO UPDATE
+		SET kind = EXCLUDED.kind, window_size = EXCLUDED.window_size, alpha = EXCLUDED.alpha,
+		    process_noise = EXCLUDED.process_noise, measurement_noise = EXCLUDED.measurement_noise,
+		    updated_at = EXCLUDED.updated_at
+	`, filterEntity.Variable, filterEntity.Config.Kind, filterEntity.Config.Window, filterEntity.Config.Alpha,
+		filterEntity.Config.ProcessNoise, filterEntity.Config.MeasurementNoise)
+}
+
+func LoadSignalFilters() ([]SignalFilterEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT variable, kind, window_size, alpha, process_noise, measurement_noise
+		FROM signal_filter`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []SignalFilterEntity
+	for rows.Next() {
+		var entity SignalFilterEntity
+		if err := rows.Scan(&entity.Variable, &entity.Config.Kind, &entity.Config.Window, &entity.Config.Alpha,
+			&entity.Config.ProcessNoise, &entity.Config.MeasurementNoise); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
@@ -0,0 +1,160 @@
+package dao
+
+import (
+	"Solflora/db"
+	"Solflora/state"
+)
+
+type FirmwareImageEntity struct {
+	Image state.FirmwareImage
+}
+
+func (firmwareImageEntity *FirmwareImageEntity) Commit() error {
+	return insert("firmware_image", `
+		INSERT INTO firmware_image (version, sha256, size, uploaded_at)
+		VALUES ($1, $2, $3, $4)
+	`, firmwareImageEntity.Image.Version, firmwareImageEntity.Image.SHA256, firmwareImageEntity.Image.Size,
+		firmwareImageEntity.Image.UploadedAt)
+}
+
+func LoadFirmwareImages() ([]FirmwareImageEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT version, sha256, size, uploaded_at
+		FROM firmware_image
+		ORDER BY uploaded_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []FirmwareImageEntity
+	for rows.Next() {
+		var entity FirmwareImageEntity
+		if err := rows.Scan(&entity.Image.Version, &entity.Image.SHA256, &entity.Image.Size, &entity.Image.UploadedAt); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
+
+// FirmwareTargetEntity assigns a version to a device or group; an empty
+// version removes the assignment.
+type FirmwareTargetEntity struct {
+	Scope   state.FirmwareTargetScope
+	Name    string
+	Version string
+}
+
+func (firmwareTargetEntity *FirmwareTargetEntity) Commit() error {
+	if firmwareTargetEntity.Version == "" {
+		return insert("firmware_target", `
+			DELETE FROM firmware_target
+			WHERE scope = $1 AND name = $2
+		`, firmwareTargetEntity.Scope, firmwareTargetEntity.Name)
+	}
+	return insert("firmware_target", `
+		INSERT INTO firmware_target (scope, name, version, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (scope, name) DO UPDATE
+		SET version = EXCLUDED.version, updated_at = EXCLUDED.updated_at
+	`, firmwareTargetEntity.Scope, firmwareTargetEntity.Name, firmwareTargetEntity.Version)
+}
+
+func LoadFirmwareTargets() ([]FirmwareTargetEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT scope, name, version
+		FROM firmware_target`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []FirmwareTargetEntity
+	for rows.Next() {
+		var entity FirmwareTargetEntity
+		if err := rows.Scan(&entity.Scope, &entity.Name, &entity.Version); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
+
+// DeviceGroupEntity puts a device into a group; an empty group removes it.
+type DeviceGroupEntity struct {
+	DeviceID string
+	Group    string
+}
+
+func (deviceGroupEntity *DeviceGroupEntity) Commit() error {
+	if deviceGroupEntity.Group == "" {
+		return insert("device_group", `
+			DELETE FROM device_group
+			WHERE device_id = $1
+		`, deviceGroupEntity.DeviceID)
+	}
+	return insert("device_group", `
+		INSERT INTO device_group (device_id, group_name, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (device_id) DO UPDATE
+		SET group_name = EXCLUDED.group_name, updated_at = EXCLUDED.updated_at
+	`, deviceGroupEntity.DeviceID, deviceGroupEntity.Group)
+}
+
+func LoadDeviceGroups() ([]DeviceGroupEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT device_id, group_name
+		FROM device_group`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []DeviceGroupEntity
+	for rows.Next() {
+		var entity DeviceGroupEntity
+		if err := rows.Scan(&entity.DeviceID, &entity.Group); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
+
+type FirmwareUpdateEntity struct {
+	Update state.FirmwareUpdate
+}
+
+func (firmwareUpdateEntity *FirmwareUpdateEntity) Commit() error {
+	return insert("firmware_update", `
+		INSERT INTO firmware_update (device_id, target_version, reported_version, status, message, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (device_id) DO UPDATE
+		SET target_version = EXCLUDED.target_version, reported_version = EXCLUDED.reported_version,
+		    status = EXCLUDED.status, message = EXCLUDED.message, updated_at = EXCLUDED.updated_at
+	`, firmwareUpdateEntity.Update.DeviceID, firmwareUpdateEntity.Update.TargetVersion,
+		firmwareUpdateEntity.Update.ReportedVersion, firmwareUpdateEntity.Update.Status,
+		firmwareUpdateEntity.Update.Message, firmwareUpdateEntity.Update.UpdatedAt)
+}
+
+func LoadFirmwareUpdates() ([]FirmwareUpdateEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT device_id, target_version, reported_version, status, message, updated_at
+		FROM firmware_update`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []FirmwareUpdateEntity
+	for rows.Next() {
+		var entity FirmwareUpdateEntity
+		if err := rows.Scan(&entity.Update.DeviceID, &entity.Update.TargetVersion, &entity.Update.ReportedVersion,
+			&entity.Update.Status, &entity.Update.Message, &entity.Update.UpdatedAt); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
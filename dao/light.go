@@ -0,0 +1,60 @@
+package dao
+
+import (
+	"Solflora/db"
+	"Solflora/state"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LightScheduleEntity is the single persisted light schedule.
+type LightScheduleEntity struct {
+	Schedule state.LightSchedule
+}
+
+func (lightScheduleEntity *LightScheduleEntity) Commit() error {
+	return insert("light_schedule", `
+		INSERT INTO light_schedule (id, mode, on_at, off_at, dli_target, updated_at)
+		VALUES (1, $1, $2, $3, $4, NOW())
+		ON CONFLICT (id) DO UPDATE
+		SET mode = EXCLUDED.mode, on_at = EXCLUDED.on_at, off_at = EXCLUDED.off_at,
+		    dli_target = EXCLUDED.dli_target, updated_at = EXCLUDED.updated_at
+	`, lightScheduleEntity.Schedule.Mode, lightScheduleEntity.Schedule.OnAt, lightScheduleEntity.Schedule.OffAt,
+		lightScheduleEntity.Schedule.DLITarget)
+}
+
+// LoadLightSchedule returns ok=false when no schedule has been stored yet.
+func LoadLightSchedule() (LightScheduleEntity, bool, error) {
+	var entity LightScheduleEntity
+	err := db.DB.QueryRow(`
+		SELECT mode, on_at, off_at, dli_target
+		FROM light_schedule
+		WHERE id = 1`).Scan(&entity.Schedule.Mode, &entity.Schedule.OnAt, &entity.Schedule.OffAt, &entity.Schedule.DLITarget)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity, false, nil
+	}
+	if err != nil {
+		return entity, false, err
+	}
+	return entity, true, nil
+}
+
+// LoadLatestMeasurement returns the newest good value of a variable stored in
+// the measurement table since the given time.
+func LoadLatestMeasurement(variable state.ConditionVariable, since time.Time) (float64, bool, error) {
+	var value float64
+	err := db.DB.QueryRow(`
+		SELECT present_value
+		FROM measurement
+		WHERE variable = $1 AND quality = 'good' AND created_at >= $2
+		ORDER BY created_at DESC
+		LIMIT 1`, variable, since).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return value, true, nil
+}
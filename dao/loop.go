@@ -0,0 +1,73 @@
+package dao
+
+import (
+	"Solflora/db"
+	"Solflora/state"
+	"time"
+)
+
+type LoopSettingsEntity struct {
+	Loop     state.LoopName
+	Settings state.LoopSettings
+}
+
+func (loopSettingsEntity *LoopSettingsEntity) Commit() error {
+	return insert("control_loop", `
+		INSERT INTO control_loop (loop_name, mode, manual_output, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (loop_name) DO UPDATE
+		SET mode = EXCLUDED.mode, manual_output = EXCLUDED.manual_output, updated_at = EXCLUDED.updated_at
+	`, loopSettingsEntity.Loop, loopSettingsEntity.Settings.Mode, loopSettingsEntity.Settings.ManualOutput)
+}
+
+func LoadLoopSettings() ([]LoopSettingsEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT loop_name, mode, manual_output
+		FROM control_loop`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []LoopSettingsEntity
+	for rows.Next() {
+		var entity LoopSettingsEntity
+		if err := rows.Scan(&entity.Loop, &entity.Settings.Mode, &entity.Settings.ManualOutput); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
+
+// LoopSampleEntity is the part of a temperature row the loop analysis reads.
+type LoopSampleEntity struct {
+	CreatedAt        time.Time
+	PresentValue     float64
+	SetPoint         float64
+	ControllerOutput float64
+}
+
+// LoadLoopSamples returns the good temperature rows of [from, to) ordered by
+// time; an empty deviceID selects every device.
+func LoadLoopSamples(deviceID string, from time.Time, to time.Time) ([]LoopSampleEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT created_at, present_value, set_point, controller_output
+		FROM temperature
+		WHERE created_at >= $1 AND created_at < $2 AND quality = 'good' AND ($3::text = '' OR device_id = $3::text)
+		ORDER BY created_at`, from, to, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []LoopSampleEntity
+	for rows.Next() {
+		var entity LoopSampleEntity
+		if err := rows.Scan(&entity.CreatedAt, &entity.PresentValue, &entity.SetPoint, &entity.ControllerOutput); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
@@ -0,0 +1,20 @@
+package dao
+
+import "Solflora/state"
+
+type MeasurementEntity struct {
+	DeviceID      string
+	Variable      state.ConditionVariable
+	PresentValue  float64
+	RawValue      float64
+	FilteredValue *float64
+	Quality       state.SampleQuality
+}
+
+func (measurementEntity *MeasurementEntity) Commit() error {
+	return insert(state.MeasurementTable, `
+		INSERT INTO measurement (device_id, variable, present_value, raw_value, filtered_value, quality)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, measurementEntity.DeviceID, measurementEntity.Variable, measurementEntity.PresentValue,
+		measurementEntity.RawValue, measurementEntity.FilteredValue, measurementEntity.Quality)
+}
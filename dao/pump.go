@@ -0,0 +1,89 @@
+package dao
+
+import (
+	"Solflora/db"
+	"Solflora/state"
+	"time"
+)
+
+type PumpRunEntity struct {
+	Run state.PumpRun
+}
+
+func (pumpRunEntity *PumpRunEntity) Commit() error {
+	run := pumpRunEntity.Run
+	return insert("pump_run", `
+		INSERT INTO pump_run (device_id, started_at, duration_ms, requested_ml, delivered_ml, metered)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, run.DeviceID, run.Start, run.Duration.Milliseconds(), run.RequestedML, run.DeliveredML, run.Metered)
+}
+
+// Update stores the final duration and delivered volume of a run.
+func (pumpRunEntity *PumpRunEntity) Update() error {
+	run := pumpRunEntity.Run
+	return insert("pump_run", `
+		UPDATE pump_run SET duration_ms = $3, delivered_ml = $4, metered = $5
+		WHERE device_id = $1 AND started_at = $2
+	`, run.DeviceID, run.Start, run.Duration.Milliseconds(), run.DeliveredML, run.Metered)
+}
+
+func LoadPumpRuns(since time.Time) ([]PumpRunEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT device_id, started_at, duration_ms, requested_ml, delivered_ml, metered
+		FROM pump_run
+		WHERE started_at >= $1
+		ORDER BY started_at`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []PumpRunEntity
+	for rows.Next() {
+		var entity PumpRunEntity
+		var durationMs int64
+		if err := rows.Scan(&entity.Run.DeviceID, &entity.Run.Start, &durationMs,
+			&entity.Run.RequestedML, &entity.Run.DeliveredML, &entity.Run.Metered); err != nil {
+			return nil, err
+		}
+		entity.Run.Duration = time.Duration(durationMs) * time.Millisecond
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
+
+type FlowCalibrationEntity struct {
+	DeviceID    string
+	Calibration state.FlowCalibration
+}
+
+func (flowCalibrationEntity *FlowCalibrationEntity) Commit() error {
+	return insert("pump_flow_calibration", `
+		INSERT INTO pump_flow_calibration (device_id, ml_per_second, ml_per_pulse, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (device_id) DO UPDATE
+		SET ml_per_second = EXCLUDED.ml_per_second, ml_per_pulse = EXCLUDED.ml_per_pulse,
+		    updated_at = EXCLUDED.updated_at
+	`, flowCalibrationEntity.DeviceID, flowCalibrationEntity.Calibration.MLPerSecond,
+		flowCalibrationEntity.Calibration.MLPerPulse)
+}
+
+func LoadFlowCalibrations() ([]FlowCalibrationEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT device_id, ml_per_second, ml_per_pulse
+		FROM pump_flow_calibration`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []FlowCalibrationEntity
+	for rows.Next() {
+		var entity FlowCalibrationEntity
+		if err := rows.Scan(&entity.DeviceID, &entity.Calibration.MLPerSecond, &entity.Calibration.MLPerPulse); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
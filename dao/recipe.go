@@ -0,0 +1,106 @@
+package dao
+
+import (
+	"Solflora/db"
+	"Solflora/state"
+	"encoding/json"
+)
+
+type CropRecipeEntity struct {
+	Recipe state.CropRecipe
+}
+
+// Commit inserts the recipe or replaces the one with the same name; the
+// stages are stored as JSON.
+func (cropRecipeEntity *CropRecipeEntity) Commit() error {
+	recipe := cropRecipeEntity.Recipe
+	stages, err := json.Marshal(recipe.Stages)
+	if err != nil {
+		return err
+	}
+	return insert("crop_recipe", `
+		INSERT INTO crop_recipe (name, description, stages, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE
+		SET description = EXCLUDED.description, stages = EXCLUDED.stages, updated_at = EXCLUDED.updated_at
+	`, recipe.Name, recipe.Description, stages, recipe.UpdatedAt)
+}
+
+func DeleteCropRecipe(name string) error {
+	_, err := db.DB.Exec(`
+		DELETE FROM crop_recipe
+		WHERE name = $1
+	`, name)
+	return err
+}
+
+func LoadCropRecipes() ([]CropRecipeEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT name, description, stages, updated_at
+		FROM crop_recipe`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []CropRecipeEntity
+	for rows.Next() {
+		var entity CropRecipeEntity
+		var stages []byte
+		recipe := &entity.Recipe
+		if err := rows.Scan(&recipe.Name, &recipe.Description, &stages, &recipe.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(stages, &recipe.Stages); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
+
+type RecipeAssignmentEntity struct {
+	Assignment state.RecipeAssignment
+}
+
+// Commit stores the assignment of a device, replacing an earlier one.
+func (recipeAssignmentEntity *RecipeAssignmentEntity) Commit() error {
+	assignment := recipeAssignmentEntity.Assignment
+	return insert("recipe_assignment", `
+		INSERT INTO recipe_assignment (device_id, recipe, start_date, stage_override, assigned_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (device_id) DO UPDATE
+		SET recipe = EXCLUDED.recipe, start_date = EXCLUDED.start_date,
+		    stage_override = EXCLUDED.stage_override, assigned_at = EXCLUDED.assigned_at
+	`, assignment.DeviceID, assignment.Recipe, assignment.StartDate, assignment.StageOverride, assignment.AssignedAt)
+}
+
+func DeleteRecipeAssignment(deviceID string) error {
+	_, err := db.DB.Exec(`
+		DELETE FROM recipe_assignment
+		WHERE device_id = $1
+	`, deviceID)
+	return err
+}
+
+func LoadRecipeAssignments() ([]RecipeAssignmentEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT device_id, recipe, to_char(start_date, 'YYYY-MM-DD'), stage_override, assigned_at
+		FROM recipe_assignment`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []RecipeAssignmentEntity
+	for rows.Next() {
+		var entity RecipeAssignmentEntity
+		assignment := &entity.Assignment
+		if err := rows.Scan(&assignment.DeviceID, &assignment.Recipe, &assignment.StartDate,
+			&assignment.StageOverride, &assignment.AssignedAt); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
@@ -0,0 +1,181 @@
+package dao
+
+import (
+	"Solflora/db"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// DailyReportEntity is the stored summary of one device and calendar day
+// (YYYY-MM-DD); Document is the report as JSON. Complete is false when it was
+// generated before the day ended.
+type DailyReportEntity struct {
+	DeviceID    string
+	Day         string
+	Document    []byte
+	GeneratedAt time.Time
+	Complete    bool
+}
+
+// Commit stores the report, replacing an earlier one of the same day.
+func (dailyReportEntity *DailyReportEntity) Commit() error {
+	return insert("daily_report", `
+		INSERT INTO daily_report (device_id, day, document, generated_at, complete)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (device_id, day) DO UPDATE
+		SET document = EXCLUDED.document, generated_at = EXCLUDED.generated_at, complete = EXCLUDED.complete
+	`, dailyReportEntity.DeviceID, dailyReportEntity.Day, dailyReportEntity.Document, dailyReportEntity.GeneratedAt,
+		dailyReportEntity.Complete)
+}
+
+// LoadDailyReport returns ok=false when no report of the day is stored.
+func LoadDailyReport(deviceID string, day string) (DailyReportEntity, bool, error) {
+	entity := DailyReportEntity{DeviceID: deviceID, Day: day}
+	err := db.DB.QueryRow(`
+		SELECT document, generated_at, complete
+		FROM daily_report
+		WHERE device_id = $1 AND day = $2`, deviceID, day).Scan(&entity.Document, &entity.GeneratedAt, &entity.Complete)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity, false, nil
+	}
+	if err != nil {
+		return entity, false, err
+	}
+	return entity, true, nil
+}
+
+// LoadDailyReportIndex lists the stored reports of the days [from, to] without
+// their documents, newest first; an empty deviceID selects every device.
+func LoadDailyReportIndex(deviceID string, from string, to string) ([]DailyReportEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT device_id, to_char(day, 'YYYY-MM-DD'), generated_at, complete
+		FROM daily_report
+		WHERE day >= $1 AND day <= $2 AND ($3::text = '' OR device_id = $3::text)
+		ORDER BY day DESC, device_id`, from, to, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := []DailyReportEntity{}
+	for rows.Next() {
+		var entity DailyReportEntity
+		if err := rows.Scan(&entity.DeviceID, &entity.Day, &entity.GeneratedAt, &entity.Complete); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
+
+// ReportDevices returns the devices that stored temperature rows in [from, to).
+func ReportDevices(from time.Time, to time.Time) ([]string, error) {
+	rows, err := db.DB.Query(`
+		SELECT DISTINCT device_id
+		FROM temperature
+		WHERE created_at >= $1 AND created_at < $2
+		ORDER BY device_id`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []string
+	for rows.Next() {
+		var device string
+		if err := rows.Scan(&device); err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+// SampleSummaryEntity holds the statistics of the good samples of a table;
+// Count is zero (and the rest unset) when there were none.
+type SampleSummaryEntity struct {
+	Min   float64
+	Max   float64
+	Avg   float64
+	Count int64
+}
+
+// SummarizeSamples reads min, max and average of present_value of one of the
+// legacy tables (temperature, humidity or moisture).
+func SummarizeSamples(table string, deviceID string, from time.Time, to time.Time) (SampleSummaryEntity, error) {
+	var entity SampleSummaryEntity
+	var min, max, avg sql.NullFloat64
+	err := db.DB.QueryRow(`
+		SELECT MIN(present_value), MAX(present_value), AVG(present_value), COUNT(*)
+		FROM `+table+`
+		WHERE created_at >= $1 AND created_at < $2 AND quality = 'good' AND device_id = $3`, from, to, deviceID).
+		Scan(&min, &max, &avg, &entity.Count)
+	entity.Min, entity.Max, entity.Avg = min.Float64, max.Float64, avg.Float64
+	return entity, err
+}
+
+// RunSummaryEntity sums the pump or fan runs of a day.
+type RunSummaryEntity struct {
+	Count       int64
+	Runtime     time.Duration
+	DeliveredML float64
+}
+
+// SummarizePumpRuns counts the pump runs started in [from, to).
+func SummarizePumpRuns(deviceID string, from time.Time, to time.Time) (RunSummaryEntity, error) {
+	var entity RunSummaryEntity
+	var durationMs int64
+	err := db.DB.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(duration_ms), 0), COALESCE(SUM(delivered_ml), 0)
+		FROM pump_run
+		WHERE started_at >= $1 AND started_at < $2 AND device_id = $3`, from, to, deviceID).
+		Scan(&entity.Count, &durationMs, &entity.DeliveredML)
+	entity.Runtime = time.Duration(durationMs) * time.Millisecond
+	return entity, err
+}
+
+// SummarizeFanRuns sums the part of every finished fan run that falls into
+// [from, to), so runs across midnight are split between the days.
+func SummarizeFanRuns(deviceID string, from time.Time, to time.Time) (RunSummaryEntity, error) {
+	var entity RunSummaryEntity
+	var seconds float64
+	err := db.DB.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(EXTRACT(EPOCH FROM
+		       LEAST(started_at + duration_ms * INTERVAL '1 millisecond', $2) - GREATEST(started_at, $1))), 0)
+		FROM fan_run
+		WHERE started_at < $2 AND started_at + duration_ms * INTERVAL '1 millisecond' > $1 AND device_id = $3`, from, to, deviceID).
+		Scan(&entity.Count, &seconds)
+	entity.Runtime = time.Duration(seconds * float64(time.Second))
+	return entity, err
+}
+
+type AlarmCountEntity struct {
+	Source string
+	Code   string
+	Count  int64
+}
+
+// CountAlarms groups the alarms raised in [from, to) by source and code.
+func CountAlarms(from time.Time, to time.Time) ([]AlarmCountEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT source, code, COUNT(*)
+		FROM alarm
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY source, code
+		ORDER BY source, code`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := []AlarmCountEntity{}
+	for rows.Next() {
+		var entity AlarmCountEntity
+		if err := rows.Scan(&entity.Source, &entity.Code, &entity.Count); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
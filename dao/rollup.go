@@ -0,0 +1,91 @@
+package dao
+
+import (
+	"Solflora/db"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	RollupHourlyTable = "rollup_hourly"
+	RollupDailyTable  = "rollup_daily"
+)
+
+// RawTables are the tables the ESP samples are stored in.
+var RawTables = []string{"temperature", "humidity", "moisture", "measurement"}
+
+// rollupSource maps one raw table column to the variable it is rolled up as;
+// only the measurement table groups by its variable column.
+type rollupSource struct {
+	table    string
+	variable string
+	value    string
+	filtered string
+	groupBy  string
+}
+
+var rollupSources = []rollupSource{
+	{table: "temperature", variable: "'temp_pv'", value: "present_value", filtered: "filtered_value"},
+	{table: "temperature", variable: "'temp_co'", value: "controller_output", filtered: "NULL::DOUBLE PRECISION"},
+	{table: "temperature", variable: "'temp_sp'", value: "set_point", filtered: "NULL::DOUBLE PRECISION"},
+	{table: "humidity", variable: "'humidity_pv'", value: "present_value", filtered: "filtered_value"},
+	{table: "moisture", variable: "'moist_pv'", value: "present_value", filtered: "filtered_value"},
+	{table: "measurement", variable: "variable", value: "present_value", filtered: "filtered_value", groupBy: "variable, "},
+}
+
+const rollupUpsert = `
+	ON CONFLICT (variable, device_id, bucket) DO UPDATE
+	SET avg_value = EXCLUDED.avg_value, min_value = EXCLUDED.min_value, max_value = EXCLUDED.max_value,
+	    filtered_avg = EXCLUDED.filtered_avg, sample_count = EXCLUDED.sample_count`
+
+// RollUpHourly (re)computes the hourly buckets of good samples from since on;
+// the newest, still open hour is completed by the next run.
+func RollUpHourly(since time.Time) error {
+	for _, source := range rollupSources {
+		query := fmt.Sprintf(`
+			INSERT INTO rollup_hourly (variable, device_id, bucket, avg_value, min_value, max_value, filtered_avg, sample_count)
+			SELECT %[1]s, device_id, date_trunc('hour', created_at), AVG(%[2]s), MIN(%[2]s), MAX(%[2]s), AVG(%[3]s), COUNT(*)
+			FROM %[4]s
+			WHERE quality = 'good' AND created_at >= $1
+			GROUP BY %[5]sdevice_id, date_trunc('hour', created_at)`,
+			source.variable, source.value, source.filtered, source.table, source.groupBy) + rollupUpsert
+		if err := insert(RollupHourlyTable, query, since); err != nil {
+			return fmt.Errorf("%s rollup of %s failed: %w", source.table, source.variable, err)
+		}
+	}
+	return nil
+}
+
+// RollUpDaily combines the hourly buckets from since on into days of the
+// database session time zone, so it still works once raw samples are deleted.
+func RollUpDaily(since time.Time) error {
+	return insert(RollupDailyTable, `
+		INSERT INTO rollup_daily (variable, device_id, bucket, avg_value, min_value, max_value, filtered_avg, sample_count)
+		SELECT variable, device_id, date_trunc('day', bucket),
+		       SUM(avg_value * sample_count) / SUM(sample_count), MIN(min_value), MAX(max_value),
+		       SUM(filtered_avg * sample_count) / NULLIF(SUM(CASE WHEN filtered_avg IS NOT NULL THEN sample_count END), 0),
+		       SUM(sample_count)
+		FROM rollup_hourly
+		WHERE bucket >= $1
+		GROUP BY variable, device_id, date_trunc('day', bucket)`+rollupUpsert, since)
+}
+
+// LatestRollupBucket returns the zero time when the table is still empty.
+func LatestRollupBucket(table string) (time.Time, error) {
+	var bucket sql.NullTime
+	if err := db.DB.QueryRow(`SELECT MAX(bucket) FROM ` + table).Scan(&bucket); err != nil {
+		return time.Time{}, err
+	}
+	return bucket.Time, nil
+}
+
+// DeleteBefore removes the rows of a raw (created_at) or rollup (bucket) table
+// older than before and returns how many were deleted.
+func DeleteBefore(table string, column string, before time.Time) (int64, error) {
+	result, err := db.DB.Exec(`DELETE FROM `+table+` WHERE `+column+` < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,148 @@
+package dao
+
+import (
+	"Solflora/db"
+	"Solflora/state"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const tuneProfileColumns = `id, proportional_gain, integral_gain, derivative_gain, output_min, output_max, author, preset, rolled_back_from, created_at`
+
+// LoadTuneProfiles returns the revisions created in [from, to), newest first,
+// at most limit rows.
+func LoadTuneProfiles(from time.Time, to time.Time, limit int) ([]TuneProfileEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT `+tuneProfileColumns+`
+		FROM tune_profile
+		WHERE created_at >= $1 AND created_at < $2
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3`, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := []TuneProfileEntity{}
+	for rows.Next() {
+		entity, err := scanTuneProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
+
+// LoadTuneProfile returns one revision; ok is false when the id is unknown.
+func LoadTuneProfile(id int64) (TuneProfileEntity, bool, error) {
+	entity, err := scanTuneProfile(db.DB.QueryRow(`
+		SELECT `+tuneProfileColumns+`
+		FROM tune_profile
+		WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity, false, nil
+	}
+	if err != nil {
+		return entity, false, err
+	}
+	return entity, true, nil
+}
+
+// LoadLatestTuneProfile returns the revision that is currently in effect.
+func LoadLatestTuneProfile() (TuneProfileEntity, bool, error) {
+	entity, err := scanTuneProfile(db.DB.QueryRow(`
+		SELECT ` + tuneProfileColumns + `
+		FROM tune_profile
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1`))
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity, false, nil
+	}
+	if err != nil {
+		return entity, false, err
+	}
+	return entity, true, nil
+}
+
+// LoadTuneProfileAt returns the revision that was in effect at the given time.
+func LoadTuneProfileAt(at time.Time) (TuneProfileEntity, bool, error) {
+	entity, err := scanTuneProfile(db.DB.QueryRow(`
+		SELECT `+tuneProfileColumns+`
+		FROM tune_profile
+		WHERE created_at <= $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1`, at))
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity, false, nil
+	}
+	if err != nil {
+		return entity, false, err
+	}
+	return entity, true, nil
+}
+
+func scanTuneProfile(row interface{ Scan(...any) error }) (TuneProfileEntity, error) {
+	var entity TuneProfileEntity
+	var outputMin, outputMax sql.NullFloat64
+	var rolledBackFrom sql.NullInt64
+	err := row.Scan(&entity.ID, &entity.ProportionalGain, &entity.IntegralGain, &entity.DerivativeGain,
+		&outputMin, &outputMax, &entity.Author, &entity.Preset, &rolledBackFrom, &entity.CreatedAt)
+	if outputMin.Valid && outputMax.Valid {
+		entity.OutputMin, entity.OutputMax = &outputMin.Float64, &outputMax.Float64
+	}
+	if rolledBackFrom.Valid {
+		entity.RolledBackFrom = &rolledBackFrom.Int64
+	}
+	return entity, err
+}
+
+type TunePresetEntity struct {
+	Preset state.TunePreset
+}
+
+// Commit inserts the preset or replaces the one with the same name.
+func (tunePresetEntity *TunePresetEntity) Commit() error {
+	preset := tunePresetEntity.Preset
+	return insert("tune_preset", `
+		INSERT INTO tune_preset (name, description, proportional_gain, integral_gain, derivative_gain, output_min, output_max, set_point, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (name) DO UPDATE
+		SET description = EXCLUDED.description, proportional_gain = EXCLUDED.proportional_gain,
+		    integral_gain = EXCLUDED.integral_gain, derivative_gain = EXCLUDED.derivative_gain,
+		    output_min = EXCLUDED.output_min, output_max = EXCLUDED.output_max,
+		    set_point = EXCLUDED.set_point, updated_at = EXCLUDED.updated_at
+	`, preset.Name, preset.Description, preset.ProportionalGain, preset.IntegralGain, preset.DerivativeGain,
+		preset.OutputMin, preset.OutputMax, preset.SetPoint, preset.UpdatedAt)
+}
+
+func DeleteTunePreset(name string) error {
+	_, err := db.DB.Exec(`
+		DELETE FROM tune_preset
+		WHERE name = $1
+	`, name)
+	return err
+}
+
+func LoadTunePresets() ([]TunePresetEntity, error) {
+	rows, err := db.DB.Query(`
+		SELECT name, description, proportional_gain, integral_gain, derivative_gain, output_min, output_max, set_point, updated_at
+		FROM tune_preset`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []TunePresetEntity
+	for rows.Next() {
+		var entity TunePresetEntity
+		preset := &entity.Preset
+		if err := rows.Scan(&preset.Name, &preset.Description, &preset.ProportionalGain, &preset.IntegralGain, &preset.DerivativeGain,
+			&preset.OutputMin, &preset.OutputMax, &preset.SetPoint, &preset.UpdatedAt); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
@@ -1,39 +1,24 @@
 package db
 
 import (
+	"Solflora/config"
 	"Solflora/logger"
 	"database/sql"
 	"fmt"
 	_ "github.com/lib/pq"
-	"os"
-	"time"
 )
 
-type credentials struct {
-	Username string
-	Password string
-	Database string
-	Host     string
-	Port     string
-}
-
 var DB *sql.DB
 
-func Init() {
+func Init(dbConfig config.DatabaseConfig) {
 	var log = logger.Logger()
 	log.Info("[START] db.init")
 
-	dbCreds := credentials{
-		Username: os.Getenv("DB_USER"),
-		Password: os.Getenv("DB_PASS"),
-		Database: os.Getenv("DB_NAME"),
-		Host:     os.Getenv("DB_HOST"),
-		Port:     os.Getenv("DB_PORT"),
-	}
-
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Baku",
-		dbCreds.Host, dbCreds.Username, dbCreds.Password, dbCreds.Database, dbCreds.Port)
-	log.Debugf("[DEBUG] conn-string: %s", dsn)
+	dsnFormat := "host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s"
+	dsn := fmt.Sprintf(dsnFormat, dbConfig.Host, dbConfig.User, dbConfig.Password, dbConfig.Name,
+		dbConfig.Port, dbConfig.SSLMode, dbConfig.TimeZone)
+	log.Debugf("[DEBUG] conn-string: %s", fmt.Sprintf(dsnFormat, dbConfig.Host, dbConfig.User, "******", dbConfig.Name,
+		dbConfig.Port, dbConfig.SSLMode, dbConfig.TimeZone))
 
 	var err error
 	DB, err = sql.Open("postgres", dsn)
@@ -45,9 +30,13 @@ func Init() {
 		log.WithError(err).Fatal("[ERROR] db.init | Failed to ping database")
 	}
 
-	DB.SetMaxIdleConns(10)
-	DB.SetMaxOpenConns(100)
-	DB.SetConnMaxLifetime(time.Hour)
+	DB.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	DB.SetMaxOpenConns(dbConfig.MaxOpenConns)
+	DB.SetConnMaxLifetime(dbConfig.ConnMaxLifetime)
+
+	if err = Migrate(); err != nil {
+		log.WithError(err).Fatal("[ERROR] db.init | Failed to migrate database schema")
+	}
 
 	log.Info("[END] db.init")
 }
@@ -0,0 +1,265 @@
+package db
+
+import (
+	"Solflora/logger"
+	"fmt"
+)
+
+// migrations are idempotent and executed in order on every start-up;
+// append new statements, never edit the ones that already shipped.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS temperature (
+		id                SERIAL PRIMARY KEY,
+		present_value     DOUBLE PRECISION NOT NULL,
+		controller_output DOUBLE PRECISION NOT NULL,
+		set_point         DOUBLE PRECISION NOT NULL,
+		created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS humidity (
+		id            SERIAL PRIMARY KEY,
+		present_value DOUBLE PRECISION NOT NULL,
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS moisture (
+		id            SERIAL PRIMARY KEY,
+		present_value DOUBLE PRECISION NOT NULL,
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS tune_profile (
+		id                SERIAL PRIMARY KEY,
+		proportional_gain DOUBLE PRECISION NOT NULL,
+		integral_gain     DOUBLE PRECISION NOT NULL,
+		derivative_gain   DOUBLE PRECISION NOT NULL,
+		created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`ALTER TABLE temperature ADD COLUMN IF NOT EXISTS quality VARCHAR(16) NOT NULL DEFAULT 'good'`,
+	`ALTER TABLE humidity ADD COLUMN IF NOT EXISTS quality VARCHAR(16) NOT NULL DEFAULT 'good'`,
+	`ALTER TABLE moisture ADD COLUMN IF NOT EXISTS quality VARCHAR(16) NOT NULL DEFAULT 'good'`,
+	`ALTER TABLE temperature ADD COLUMN IF NOT EXISTS device_id VARCHAR(64) NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE humidity ADD COLUMN IF NOT EXISTS device_id VARCHAR(64) NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE moisture ADD COLUMN IF NOT EXISTS device_id VARCHAR(64) NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE temperature ADD COLUMN IF NOT EXISTS raw_value DOUBLE PRECISION`,
+	`ALTER TABLE humidity ADD COLUMN IF NOT EXISTS raw_value DOUBLE PRECISION`,
+	`ALTER TABLE moisture ADD COLUMN IF NOT EXISTS raw_value DOUBLE PRECISION`,
+	`CREATE TABLE IF NOT EXISTS sensor_calibration (
+		device_id    VARCHAR(64) NOT NULL,
+		variable     VARCHAR(32) NOT NULL,
+		offset_value DOUBLE PRECISION NOT NULL DEFAULT 0,
+		gain         DOUBLE PRECISION NOT NULL DEFAULT 1,
+		points       JSONB NOT NULL DEFAULT '[]',
+		updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (device_id, variable)
+	)`,
+	`CREATE TABLE IF NOT EXISTS calibration_point (
+		id              SERIAL PRIMARY KEY,
+		device_id       VARCHAR(64) NOT NULL,
+		variable        VARCHAR(32) NOT NULL,
+		label           VARCHAR(64) NOT NULL,
+		raw_value       DOUBLE PRECISION NOT NULL,
+		reference_value DOUBLE PRECISION NOT NULL,
+		created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`ALTER TABLE temperature ADD COLUMN IF NOT EXISTS filtered_value DOUBLE PRECISION`,
+	`ALTER TABLE humidity ADD COLUMN IF NOT EXISTS filtered_value DOUBLE PRECISION`,
+	`ALTER TABLE moisture ADD COLUMN IF NOT EXISTS filtered_value DOUBLE PRECISION`,
+	`CREATE TABLE IF NOT EXISTS signal_filter (
+		variable          VARCHAR(32) PRIMARY KEY,
+		kind              VARCHAR(32) NOT NULL,
+		window_size       INTEGER NOT NULL DEFAULT 0,
+		alpha             DOUBLE PRECISION NOT NULL DEFAULT 0,
+		process_noise     DOUBLE PRECISION NOT NULL DEFAULT 0,
+		measurement_noise DOUBLE PRECISION NOT NULL DEFAULT 0,
+		updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS measurement (
+		id             BIGSERIAL PRIMARY KEY,
+		device_id      VARCHAR(64) NOT NULL,
+		variable       VARCHAR(32) NOT NULL,
+		present_value  DOUBLE PRECISION NOT NULL,
+		raw_value      DOUBLE PRECISION,
+		filtered_value DOUBLE PRECISION,
+		quality        VARCHAR(16) NOT NULL DEFAULT 'good',
+		created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS measurement_variable_created_at_idx ON measurement (variable, created_at)`,
+	`CREATE TABLE IF NOT EXISTS light_schedule (
+		id         INTEGER PRIMARY KEY CHECK (id = 1),
+		mode       VARCHAR(16) NOT NULL,
+		on_at      VARCHAR(5) NOT NULL,
+		off_at     VARCHAR(5) NOT NULL,
+		dli_target DOUBLE PRECISION NOT NULL DEFAULT 0,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS alarm (
+		id         BIGSERIAL PRIMARY KEY,
+		source     VARCHAR(32) NOT NULL,
+		code       VARCHAR(64) NOT NULL,
+		message    TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS alarm_created_at_idx ON alarm (created_at)`,
+	`CREATE TABLE IF NOT EXISTS pump_run (
+		id          BIGSERIAL PRIMARY KEY,
+		started_at  TIMESTAMPTZ NOT NULL,
+		duration_ms BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS pump_run_started_at_idx ON pump_run (started_at)`,
+	`ALTER TABLE pump_run ADD COLUMN IF NOT EXISTS device_id VARCHAR(64) NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE pump_run ADD COLUMN IF NOT EXISTS requested_ml DOUBLE PRECISION NOT NULL DEFAULT 0`,
+	`ALTER TABLE pump_run ADD COLUMN IF NOT EXISTS delivered_ml DOUBLE PRECISION NOT NULL DEFAULT 0`,
+	`ALTER TABLE pump_run ADD COLUMN IF NOT EXISTS metered BOOLEAN NOT NULL DEFAULT FALSE`,
+	`CREATE TABLE IF NOT EXISTS fan_settings (
+		id          INTEGER PRIMARY KEY CHECK (id = 1),
+		mode        VARCHAR(32) NOT NULL,
+		manual_duty DOUBLE PRECISION NOT NULL DEFAULT 0,
+		start_value DOUBLE PRECISION NOT NULL DEFAULT 0,
+		full_value  DOUBLE PRECISION NOT NULL DEFAULT 0,
+		updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS control_loop (
+		loop_name     VARCHAR(16) PRIMARY KEY,
+		mode          VARCHAR(16) NOT NULL,
+		manual_output DOUBLE PRECISION NOT NULL DEFAULT 0,
+		updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS pump_flow_calibration (
+		device_id     VARCHAR(64) PRIMARY KEY,
+		ml_per_second DOUBLE PRECISION NOT NULL,
+		ml_per_pulse  DOUBLE PRECISION NOT NULL DEFAULT 0,
+		updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS device_config (
+		device_id  VARCHAR(64) NOT NULL,
+		version    INTEGER NOT NULL,
+		document   JSONB NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (device_id, version)
+	)`,
+	`CREATE TABLE IF NOT EXISTS firmware_image (
+		version     VARCHAR(32) PRIMARY KEY,
+		sha256      CHAR(64) NOT NULL,
+		size        BIGINT NOT NULL,
+		uploaded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS firmware_target (
+		scope      VARCHAR(16) NOT NULL,
+		name       VARCHAR(64) NOT NULL,
+		version    VARCHAR(32) NOT NULL REFERENCES firmware_image (version),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (scope, name)
+	)`,
+	`CREATE TABLE IF NOT EXISTS device_group (
+		device_id  VARCHAR(64) PRIMARY KEY,
+		group_name VARCHAR(64) NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS firmware_update (
+		device_id        VARCHAR(64) PRIMARY KEY,
+		target_version   VARCHAR(32) NOT NULL,
+		reported_version VARCHAR(64) NOT NULL,
+		status           VARCHAR(16) NOT NULL,
+		message          TEXT NOT NULL DEFAULT '',
+		updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS temperature_created_at_idx ON temperature (created_at)`,
+	`CREATE INDEX IF NOT EXISTS humidity_created_at_idx ON humidity (created_at)`,
+	`CREATE INDEX IF NOT EXISTS moisture_created_at_idx ON moisture (created_at)`,
+	`CREATE INDEX IF NOT EXISTS measurement_created_at_idx ON measurement (created_at)`,
+	`CREATE TABLE IF NOT EXISTS rollup_hourly (
+		variable     VARCHAR(32) NOT NULL,
+		device_id    VARCHAR(64) NOT NULL,
+		bucket       TIMESTAMPTZ NOT NULL,
+		avg_value    DOUBLE PRECISION NOT NULL,
+		min_value    DOUBLE PRECISION NOT NULL,
+		max_value    DOUBLE PRECISION NOT NULL,
+		filtered_avg DOUBLE PRECISION,
+		sample_count BIGINT NOT NULL,
+		PRIMARY KEY (variable, device_id, bucket)
+	)`,
+	`CREATE INDEX IF NOT EXISTS rollup_hourly_bucket_idx ON rollup_hourly (bucket)`,
+	`CREATE TABLE IF NOT EXISTS rollup_daily (
+		variable     VARCHAR(32) NOT NULL,
+		device_id    VARCHAR(64) NOT NULL,
+		bucket       TIMESTAMPTZ NOT NULL,
+		avg_value    DOUBLE PRECISION NOT NULL,
+		min_value    DOUBLE PRECISION NOT NULL,
+		max_value    DOUBLE PRECISION NOT NULL,
+		filtered_avg DOUBLE PRECISION,
+		sample_count BIGINT NOT NULL,
+		PRIMARY KEY (variable, device_id, bucket)
+	)`,
+	`CREATE INDEX IF NOT EXISTS rollup_daily_bucket_idx ON rollup_daily (bucket)`,
+	`ALTER TABLE tune_profile ADD COLUMN IF NOT EXISTS author VARCHAR(64) NOT NULL DEFAULT ''`,
+	`ALTER TABLE tune_profile ADD COLUMN IF NOT EXISTS rolled_back_from INTEGER`,
+	`CREATE INDEX IF NOT EXISTS tune_profile_created_at_idx ON tune_profile (created_at)`,
+	`ALTER TABLE tune_profile ADD COLUMN IF NOT EXISTS output_min DOUBLE PRECISION`,
+	`ALTER TABLE tune_profile ADD COLUMN IF NOT EXISTS output_max DOUBLE PRECISION`,
+	`ALTER TABLE tune_profile ADD COLUMN IF NOT EXISTS preset VARCHAR(64) NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS tune_preset (
+		name              VARCHAR(64) PRIMARY KEY,
+		description       TEXT NOT NULL DEFAULT '',
+		proportional_gain DOUBLE PRECISION NOT NULL,
+		integral_gain     DOUBLE PRECISION NOT NULL,
+		derivative_gain   DOUBLE PRECISION NOT NULL,
+		output_min        DOUBLE PRECISION NOT NULL,
+		output_max        DOUBLE PRECISION NOT NULL,
+		set_point         DOUBLE PRECISION NOT NULL,
+		created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS fan_run (
+		id          BIGSERIAL PRIMARY KEY,
+		device_id   VARCHAR(64) NOT NULL,
+		started_at  TIMESTAMPTZ NOT NULL,
+		duration_ms BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS fan_run_started_at_idx ON fan_run (started_at)`,
+	`CREATE TABLE IF NOT EXISTS daily_report (
+		device_id    VARCHAR(64) NOT NULL,
+		day          DATE NOT NULL,
+		document     JSONB NOT NULL,
+		generated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (device_id, day)
+	)`,
+	`CREATE TABLE IF NOT EXISTS actuator_event (
+		id          BIGSERIAL PRIMARY KEY,
+		device_id   VARCHAR(64) NOT NULL,
+		actuator    VARCHAR(32) NOT NULL,
+		value       DOUBLE PRECISION NOT NULL,
+		source      VARCHAR(16) NOT NULL,
+		started_at  TIMESTAMPTZ NOT NULL,
+		duration_ms BIGINT
+	)`,
+	`CREATE INDEX IF NOT EXISTS actuator_event_actuator_started_at_idx ON actuator_event (actuator, started_at)`,
+	`CREATE TABLE IF NOT EXISTS crop_recipe (
+		name        VARCHAR(64) PRIMARY KEY,
+		description TEXT NOT NULL DEFAULT '',
+		stages      JSONB NOT NULL,
+		created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS recipe_assignment (
+		device_id      VARCHAR(64) PRIMARY KEY,
+		recipe         VARCHAR(64) NOT NULL REFERENCES crop_recipe (name),
+		start_date     DATE NOT NULL,
+		stage_override VARCHAR(64) NOT NULL DEFAULT '',
+		assigned_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`ALTER TABLE daily_report ADD COLUMN IF NOT EXISTS complete BOOLEAN NOT NULL DEFAULT TRUE`,
+	`UPDATE daily_report SET complete = FALSE WHERE complete AND document->>'complete' = 'false'`,
+	`CREATE INDEX IF NOT EXISTS actuator_event_device_id_actuator_started_at_idx ON actuator_event (device_id, actuator, started_at)`,
+}
+
+func Migrate() error {
+	var log = logger.Logger()
+	log.Info("[START] db.Migrate")
+
+	for i, statement := range migrations {
+		if _, err := DB.Exec(statement); err != nil {
+			return fmt.Errorf("migration #%d failed: %w", i, err)
+		}
+	}
+
+	log.Infof("[END] db.Migrate | %d migrations applied", len(migrations))
+	return nil
+}
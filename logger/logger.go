@@ -2,17 +2,15 @@ package logger
 
 import (
 	log "github.com/sirupsen/logrus"
-	"os"
 	"strings"
 )
 
 var logger *log.Logger
 
-func Init() {
+func Init(loggerLevel string) {
 	logger = log.New()
 	logger.SetFormatter(&log.TextFormatter{})
 
-	loggerLevel := os.Getenv("LOG_LEVEL")
 	logger.SetLevel(parseLogLevel(loggerLevel))
 
 	logger.Infof("[INFO] logger active with level: %s", loggerLevel)
@@ -3,42 +3,197 @@ package main
 import (
 	"Solflora/api/esp"
 	"Solflora/api/web"
+	"Solflora/config"
 	"Solflora/db"
 	"Solflora/logger"
+	"Solflora/metrics"
 	"Solflora/state"
 	"Solflora/util"
-	sys "github.com/joho/godotenv"
 	"net/http"
+	"os"
+	"time"
 )
 
 func main() {
-	err := sys.Overload(".env.local", ".env.cloud")
-
-	logger.Init()
-	db.Init()
+	cfg, err := config.Load(os.Args[1:])
 
+	logger.Init(cfg.Log.Level)
 	var log = logger.Logger()
 	if err != nil {
-		log.Fatal("[ERROR] main() | failed to load .env.cloud / .env.local file | %s", err.Error())
+		log.Fatalf("[ERROR] main() | failed to load configuration | %s", err.Error())
 	}
+	log.Infof("[INFO] main() | effective configuration:\n%s", cfg.Redacted())
+	time.Local = cfg.Server.Location()
+
+	db.Init(cfg.Database)
 
 	// Database write testing
 	//mock.Mock_db_population_from_state()
 
 	modelState := state.NewModelState()
+	modelState.Set(state.CO2SP, cfg.Control.CO2SPDefault)
 	deviceState := state.NewDeviceState()
 	tuneState := state.NewTuneState()
+	tuneState.SetOutputLimits(cfg.Control.TemperatureCOMin, cfg.Control.TemperatureCOMax)
+	tunePresetState := state.NewTunePresetState()
 	integralState := state.NewTrackingIntegralState()
+	sampleHistory := state.NewSampleHistory(cfg.Validation.SpikeHistorySize)
+	calibrationState := state.NewCalibrationState()
+	filterState := state.NewFilterState()
+	lightState := state.NewLightState()
+	pumpState := state.NewPumpState()
+	fanState := state.NewFanState()
+	heaterOutput := state.NewTimeProportioningState()
+	loopState := state.NewLoopState()
+	commandState := state.NewCommandState()
+	deviceConfigState := state.NewDeviceConfigState()
+	firmwareState := state.NewFirmwareState()
+	actuatorState := state.NewActuatorState()
+	recipeState := state.NewRecipeState()
+	variableRegistry, err := newVariableRegistry(cfg.Validation)
+	if err != nil {
+		log.Fatalf("[ERROR] main() | failed to build variable registry | %s", err.Error())
+	}
 
-	controlSamplingService := esp.NewControlSamplingService(modelState, deviceState, tuneState, integralState)
-	controlHandlerService := web.NewControlHandlerService(deviceState, modelState, tuneState)
+	actuatorRecorder := util.NewActuatorRecorder(actuatorState)
+	pumpController := util.NewPumpController(deviceState, modelState, pumpState, loopState, actuatorRecorder, cfg.Control)
+	controlSamplingService := esp.NewControlSamplingService(
+		modelState, deviceState, tuneState, integralState, sampleHistory, calibrationState, filterState, variableRegistry,
+		lightState, pumpState, fanState, heaterOutput, loopState, pumpController, actuatorRecorder, commandState,
+		deviceConfigState, firmwareState, cfg.Control, cfg.Firmware)
+	controlHandlerService := web.NewControlHandlerService(
+		deviceState, modelState, tuneState, tunePresetState, calibrationState, filterState, variableRegistry,
+		lightState, pumpState, fanState, integralState, loopState, pumpController, actuatorRecorder, commandState,
+		deviceConfigState, firmwareState, recipeState, cfg.Control, cfg.Firmware, cfg.Retention, cfg.Report)
 
-	http.HandleFunc("/api/esp", util.WithCors(esp.ControlSampler(controlSamplingService)))
-	http.HandleFunc("/api/pump-water", util.WithCors(web.WaterPumpControl(controlHandlerService)))
-	http.HandleFunc("/api/fan-control", util.WithCors(web.AirFanControl(controlHandlerService)))
-	http.HandleFunc("/api/temp-control-sp", util.WithCors(web.TemperatureSetPointControl(controlHandlerService)))
-	http.HandleFunc("/api/temp-sp", util.WithCors(web.ReturnTemperatureSetPoint(controlHandlerService)))
-	http.HandleFunc("/api/temp-coef", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+	if err := controlHandlerService.LoadSensorCalibrations(); err != nil {
+		log.Warnf("[WARN] main() | sensor calibrations not restored, raw values are used | %s", err.Error())
+	}
+	if err := controlHandlerService.LoadSignalFilters(); err != nil {
+		log.Warnf("[WARN] main() | signal filters not restored, values are not filtered | %s", err.Error())
+	}
+	if err := controlHandlerService.LoadLightSchedule(); err != nil {
+		log.Warnf("[WARN] main() | light schedule not restored, lights stay manual | %s", err.Error())
+	}
+	if err := controlHandlerService.LoadTuneProfile(); err != nil {
+		log.Warnf("[WARN] main() | tune profile not restored, gains start at zero | %s", err.Error())
+	}
+	if err := controlHandlerService.LoadTunePresets(); err != nil {
+		log.Warnf("[WARN] main() | tune presets not restored | %s", err.Error())
+	}
+	if err := controlHandlerService.LoadLoopSettings(); err != nil {
+		log.Warnf("[WARN] main() | loop settings not restored, default modes are used | %s", err.Error())
+	}
+	if err := controlHandlerService.LoadFanSettings(); err != nil {
+		log.Warnf("[WARN] main() | fan settings not restored, fan stays off | %s", err.Error())
+	}
+	if err := controlHandlerService.LoadFlowCalibrations(); err != nil {
+		log.Warnf("[WARN] main() | pump flow calibrations not restored, volume dosing is unavailable | %s", err.Error())
+	}
+	if err := controlHandlerService.LoadPumpRuns(); err != nil {
+		log.Warnf("[WARN] main() | pump runs not restored, daily runtime starts at zero | %s", err.Error())
+	}
+	if err := controlHandlerService.LoadDeviceConfigs(); err != nil {
+		log.Warnf("[WARN] main() | device configs not restored, devices keep their firmware defaults | %s", err.Error())
+	}
+	if err := controlHandlerService.LoadFirmware(); err != nil {
+		log.Warnf("[WARN] main() | firmware not restored, no updates are offered | %s", err.Error())
+	}
+
+	if err := controlHandlerService.LoadCropRecipes(); err != nil {
+		log.Warnf("[WARN] main() | crop recipes not restored, set-points stay at their defaults | %s", err.Error())
+	}
+	if err := controlHandlerService.CloseActuatorHistory(); err != nil {
+		log.Warnf("[WARN] main() | actuator history not closed, open transitions keep no duration | %s", err.Error())
+	}
+
+	controlHandlerService.StartRollupJob()
+	controlHandlerService.StartReportJob()
+	controlHandlerService.StartRecipeJob()
+
+	metrics.SetActuatorState(string(state.FanControl), false)
+	metrics.SetActuatorState(string(state.WaterPumpControl), false)
+	metrics.SetActuatorState(string(state.LightControl), false)
+	metrics.SetActuatorState(string(state.CO2Control), false)
+	metrics.SetActuatorState(string(state.HeaterControl), false)
+
+	handle("/api/esp", util.WithCors(esp.ControlSampler(controlSamplingService)))
+	handle("/api/esp/config", util.WithCors(esp.DeviceConfig(controlSamplingService)))
+	handle("/api/esp/firmware", util.WithCors(esp.FirmwareImage(controlSamplingService)))
+	handle("/api/firmware", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnFirmwareImages(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.UploadFirmware(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	handle("/api/firmware-target", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnFirmwareTargets(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.SetFirmwareTarget(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	handle("/api/device-group", util.WithCors(web.SetDeviceGroup(controlHandlerService)))
+	handle("/api/firmware-status", util.WithCors(web.ReturnFirmwareUpdates(controlHandlerService)))
+	handle("/api/device-config", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnDeviceConfig(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.SetDeviceConfig(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	handle("/api/pump-water", util.WithCors(web.WaterPumpControl(controlHandlerService)))
+	handle("/api/pump-volume", util.WithCors(web.WaterDoseControl(controlHandlerService)))
+	handle("/api/pump-flow-calibration", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnFlowCalibration(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.SetFlowCalibration(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	handle("/api/water-usage", util.WithCors(web.ReturnWaterUsage(controlHandlerService)))
+	handle("/api/fan-control", util.WithCors(web.AirFanControl(controlHandlerService)))
+	handle("/api/fan-speed", util.WithCors(web.FanSpeedControl(controlHandlerService)))
+	handle("/api/fan-settings", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnFanSettings(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.SetFanSettings(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	handle("/api/light-control", util.WithCors(web.LightControl(controlHandlerService)))
+	handle("/api/light-schedule", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnLightSchedule(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.SetLightSchedule(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	handle("/api/light-dli", util.WithCors(web.ReturnDailyLightIntegral(controlHandlerService)))
+	handle("/api/co2-control-sp", util.WithCors(web.CO2SetPointControl(controlHandlerService)))
+	handle("/api/co2-sp", util.WithCors(web.ReturnCO2SetPoint(controlHandlerService)))
+	handle("/api/temp-control-sp", util.WithCors(web.TemperatureSetPointControl(controlHandlerService)))
+	handle("/api/temp-sp", util.WithCors(web.ReturnTemperatureSetPoint(controlHandlerService)))
+	handle("/api/temp-coef", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			web.ReturnTemperatureControlTuneProfile(controlHandlerService)(w, r)
@@ -48,11 +203,153 @@ func main() {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	}))
+	handle("/api/temp-coef-history", util.WithCors(web.ReturnTuneProfileHistory(controlHandlerService)))
+	handle("/api/temp-coef-diff", util.WithCors(web.DiffTuneProfiles(controlHandlerService)))
+	handle("/api/temp-coef-rollback", util.WithCors(web.RollbackTuneProfile(controlHandlerService)))
+	handle("/api/tune-preset", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnTunePresets(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.CreateTunePreset(controlHandlerService)(w, r)
+		case http.MethodPut:
+			web.UpdateTunePreset(controlHandlerService)(w, r)
+		case http.MethodDelete:
+			web.DeleteTunePreset(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	handle("/api/tune-preset-apply", util.WithCors(web.ApplyTunePreset(controlHandlerService)))
+	handle("/api/tune-preset-export", util.WithCors(web.ExportTunePresets(controlHandlerService)))
+	handle("/api/tune-preset-import", util.WithCors(web.ImportTunePresets(controlHandlerService)))
 
-	http.HandleFunc("/api/temp-data", util.WithCors(web.ReturnTemperatureChartData(controlHandlerService)))
-	http.HandleFunc("/api/humidity-data", util.WithCors(web.ReturnHumidityChartData(controlHandlerService)))
-	http.HandleFunc("/api/moisture-data", util.WithCors(web.ReturnMoistureChartData(controlHandlerService)))
+	handle("/api/recipe", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnCropRecipes(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.CreateCropRecipe(controlHandlerService)(w, r)
+		case http.MethodPut:
+			web.UpdateCropRecipe(controlHandlerService)(w, r)
+		case http.MethodDelete:
+			web.DeleteCropRecipe(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	handle("/api/recipe-assignment", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnRecipeAssignments(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.AssignCropRecipe(controlHandlerService)(w, r)
+		case http.MethodDelete:
+			web.UnassignCropRecipe(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	handle("/api/recipe-stage", util.WithCors(web.OverrideRecipeStage(controlHandlerService)))
+
+	handle("/api/calibration", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnSensorCalibration(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.SetSensorCalibration(controlHandlerService)(w, r)
+		case http.MethodDelete:
+			web.ResetSensorCalibration(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	handle("/api/calibration-point", util.WithCors(web.RecordCalibrationPoint(controlHandlerService)))
+
+	handle("/api/filter", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnSignalFilters(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.SetSignalFilter(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	handle("/api/loop-mode", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnLoopSettings(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.SetLoopSettings(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	handle("/api/loop-performance", util.WithCors(web.ReturnLoopPerformance(controlHandlerService)))
+	handle("/api/actuator-history", util.WithCors(web.ReturnActuatorHistory(controlHandlerService)))
+
+	handle("/api/commands", util.WithCors(web.ReturnCommandStatus(controlHandlerService)))
+
+	handle("/api/temp-data", util.WithCors(web.ReturnTemperatureChartData(controlHandlerService)))
+	handle("/api/humidity-data", util.WithCors(web.ReturnHumidityChartData(controlHandlerService)))
+	handle("/api/moisture-data", util.WithCors(web.ReturnMoistureChartData(controlHandlerService)))
+
+	handle("/api/variables", util.WithCors(web.ReturnVariables(controlHandlerService)))
+	handle("/api/series", util.WithCors(web.ReturnSeriesChartData(controlHandlerService)))
+	handle("/api/history", util.WithCors(web.ReturnHistory(controlHandlerService)))
+
+	handle("/api/report", util.WithCors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			web.ReturnDailyReport(controlHandlerService)(w, r)
+		case http.MethodPost:
+			web.GenerateDailyReport(controlHandlerService)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	handle("/api/reports", util.WithCors(web.ReturnDailyReportIndex(controlHandlerService)))
+
+	http.HandleFunc("/metrics", metrics.Handler())
 
 	log.Fatalf("[FATAL] main() | web server shut down | potential-err: %s\n",
-		http.ListenAndServe(":8080", nil).Error())
+		http.ListenAndServe(cfg.Server.ListenAddress, nil).Error())
+}
+
+func handle(route string, handler http.HandlerFunc) {
+	http.HandleFunc(route, metrics.WithMetrics(route, handler))
+}
+
+// newVariableRegistry registers the built-in process values on their legacy
+// tables and then any variables of the configured variables file.
+func newVariableRegistry(validationConfig config.ValidationConfig) (*state.VariableRegistry, error) {
+	registry := state.NewVariableRegistry()
+	builtins := []state.VariableDefinition{
+		{Name: state.TemperaturePV, Unit: "°C", Description: "air temperature", Table: "temperature", Controllable: true,
+			Min: validationConfig.TemperaturePVMin, Max: validationConfig.TemperaturePVMax, MaxStep: validationConfig.TemperaturePVMaxStep},
+		{Name: state.HumidityPV, Unit: "%RH", Description: "relative humidity", Table: "humidity",
+			Min: validationConfig.HumidityPVMin, Max: validationConfig.HumidityPVMax, MaxStep: validationConfig.HumidityPVMaxStep},
+		{Name: state.MoisturePV, Unit: "%", Description: "soil moisture", Table: "moisture",
+			Min: validationConfig.MoisturePVMin, Max: validationConfig.MoisturePVMax, MaxStep: validationConfig.MoisturePVMaxStep},
+		{Name: state.LightPV, Unit: "µmol/m²/s", Description: "photosynthetic photon flux density",
+			Min: 0, Max: validationConfig.LightPVMax},
+		{Name: state.CO2PV, Unit: "ppm", Description: "carbon dioxide concentration", Controllable: true,
+			Min: validationConfig.CO2PVMin, Max: validationConfig.CO2PVMax, MaxStep: validationConfig.CO2PVMaxStep},
+		{Name: state.LightDLI, Unit: "mol/m²/d", Description: "daily light integral", Min: 0, Max: 100},
+	}
+	for _, definition := range builtins {
+		if err := registry.Register(definition); err != nil {
+			return nil, err
+		}
+	}
+
+	if validationConfig.VariablesFile != "" {
+		if err := registry.LoadFile(validationConfig.VariablesFile); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
 }
@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+var registry = NewRegistry()
+
+var (
+	EspSamplesTotal = NewCounterVec(registry,
+		"solflora_esp_samples_total",
+		"Number of samples received from the ESP.")
+
+	EspSamplesRejectedTotal = NewCounterVec(registry,
+		"solflora_esp_samples_rejected_total",
+		"Number of sample values excluded from control by variable and quality flag.",
+		"variable", "quality")
+
+	ControlSamplingDuration = NewHistogramVec(registry,
+		"solflora_control_sampling_duration_seconds",
+		"Latency of HandleControlSampling.",
+		latencyBuckets)
+
+	DbInsertDuration = NewHistogramVec(registry,
+		"solflora_db_insert_duration_seconds",
+		"Latency of database inserts per table.",
+		latencyBuckets, "table")
+
+	DbInsertErrorsTotal = NewCounterVec(registry,
+		"solflora_db_insert_errors_total",
+		"Number of failed database inserts per table.",
+		"table")
+
+	LoopPresentValue = NewGaugeVec(registry,
+		"solflora_loop_present_value",
+		"Last present value reported for a control loop.",
+		"loop")
+
+	LoopSetPoint = NewGaugeVec(registry,
+		"solflora_loop_set_point",
+		"Current set-point of a control loop.",
+		"loop")
+
+	LoopControllerOutput = NewGaugeVec(registry,
+		"solflora_loop_controller_output",
+		"Last controller output calculated for a control loop.",
+		"loop")
+
+	MeasurementValue = NewGaugeVec(registry,
+		"solflora_measurement_value",
+		"Last filtered value of a measured variable per device.",
+		"device_id", "variable")
+
+	ActuatorState = NewGaugeVec(registry,
+		"solflora_actuator_state",
+		"Current actuator state (1 = on, 0 = off).",
+		"actuator")
+
+	PumpRefusalsTotal = NewCounterVec(registry,
+		"solflora_pump_refusals_total",
+		"Number of water pump runs refused by an interlock.",
+		"code")
+
+	WaterDeliveredTotal = NewCounterVec(registry,
+		"solflora_water_delivered_ml_total",
+		"Water volume delivered by the pump in millilitres.",
+		"device_id")
+
+	ActuatorDuty = NewGaugeVec(registry,
+		"solflora_actuator_duty_percent",
+		"Current duty of an analog actuator in percent.",
+		"actuator")
+
+	HttpRequestsTotal = NewCounterVec(registry,
+		"solflora_http_requests_total",
+		"Number of HTTP requests by route and status code.",
+		"route", "status")
+)
+
+var actuatorRuntime = newRuntimeTracker(registry,
+	"solflora_actuator_runtime_seconds_total",
+	"Cumulative time an actuator has spent in the on state.")
+
+func SetActuatorState(actuator string, on bool) {
+	if on {
+		ActuatorState.Set(1, actuator)
+	} else {
+		ActuatorState.Set(0, actuator)
+	}
+	actuatorRuntime.set(actuator, on, time.Now())
+}
+
+func ObserveDbInsert(table string, start time.Time, err error) {
+	DbInsertDuration.Observe(time.Since(start).Seconds(), table)
+	if err != nil {
+		DbInsertErrorsTotal.Inc(table)
+	}
+}
+
+func WriteTo(w io.Writer) {
+	registry.Write(w)
+}
+
+// runtimeTracker accumulates on-time per actuator; a running actuator is
+// included up to the moment of the scrape, not only after it switches off.
+type runtimeTracker struct {
+	metricDesc
+	mutex       sync.Mutex
+	onSince     map[string]time.Time
+	accumulated map[string]time.Duration
+}
+
+func newRuntimeTracker(r *Registry, name string, help string) *runtimeTracker {
+	t := &runtimeTracker{
+		metricDesc:  metricDesc{name: name, help: help, labelNames: []string{"actuator"}},
+		onSince:     make(map[string]time.Time),
+		accumulated: make(map[string]time.Duration),
+	}
+	r.register(t)
+	return t
+}
+
+func (t *runtimeTracker) set(actuator string, on bool, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	since, running := t.onSince[actuator]
+	switch {
+	case on && !running:
+		t.onSince[actuator] = now
+	case !on && running:
+		t.accumulated[actuator] += now.Sub(since)
+		delete(t.onSince, actuator)
+	}
+	if _, ok := t.accumulated[actuator]; !ok {
+		t.accumulated[actuator] = 0
+	}
+}
+
+func (t *runtimeTracker) write(w io.Writer) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	t.writeHeader(w, counterType)
+	for _, actuator := range sortedKeys(t.accumulated) {
+		total := t.accumulated[actuator]
+		if since, running := t.onSince[actuator]; running {
+			total += now.Sub(since)
+		}
+		fmt.Fprintf(w, "%s%s %s\n", t.name, t.labelString([]string{actuator}), formatFloat(total.Seconds()))
+	}
+}
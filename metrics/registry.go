@@ -0,0 +1,270 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+type collector interface {
+	write(w io.Writer)
+}
+
+type Registry struct {
+	mutex      sync.RWMutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) Write(w io.Writer) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, c := range r.collectors {
+		c.write(w)
+	}
+}
+
+type metricDesc struct {
+	name       string
+	help       string
+	labelNames []string
+}
+
+func (d metricDesc) writeHeader(w io.Writer, t metricType) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, d.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, t)
+}
+
+func (d metricDesc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// labelValueEscaper escapes a label value as the text exposition format
+// requires: backslash, double quote and line feed only.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (d metricDesc) labelString(labelValues []string, extra ...string) string {
+	var parts []string
+	for i, name := range d.labelNames {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, name, labelValueEscaper.Replace(labelValues[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extra[i], labelValueEscaper.Replace(extra[i+1])))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+type valueVec struct {
+	metricDesc
+	kind   metricType
+	mutex  sync.RWMutex
+	values map[string]*labelledValue
+}
+
+type labelledValue struct {
+	labelValues []string
+	value       float64
+}
+
+func newValueVec(r *Registry, kind metricType, name string, help string, labelNames ...string) *valueVec {
+	v := &valueVec{
+		metricDesc: metricDesc{name: name, help: help, labelNames: labelNames},
+		kind:       kind,
+		values:     make(map[string]*labelledValue),
+	}
+	r.register(v)
+	return v
+}
+
+func (v *valueVec) update(labelValues []string, fn func(float64) float64) {
+	key := v.key(labelValues)
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	entry, ok := v.values[key]
+	if !ok {
+		entry = &labelledValue{labelValues: append([]string(nil), labelValues...)}
+		v.values[key] = entry
+	}
+	entry.value = fn(entry.value)
+}
+
+func (v *valueVec) get(labelValues []string) float64 {
+	key := v.key(labelValues)
+
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	if entry, ok := v.values[key]; ok {
+		return entry.value
+	}
+	return 0
+}
+
+func (v *valueVec) write(w io.Writer) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	v.writeHeader(w, v.kind)
+	for _, key := range sortedKeys(v.values) {
+		entry := v.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelString(entry.labelValues), formatFloat(entry.value))
+	}
+}
+
+type CounterVec struct {
+	vec *valueVec
+}
+
+func NewCounterVec(r *Registry, name string, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{vec: newValueVec(r, counterType, name, help, labelNames...)}
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.vec.update(labelValues, func(v float64) float64 { return v + delta })
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Get(labelValues ...string) float64 {
+	return c.vec.get(labelValues)
+}
+
+type GaugeVec struct {
+	vec *valueVec
+}
+
+func NewGaugeVec(r *Registry, name string, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{vec: newValueVec(r, gaugeType, name, help, labelNames...)}
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.vec.update(labelValues, func(float64) float64 { return value })
+}
+
+func (g *GaugeVec) Get(labelValues ...string) float64 {
+	return g.vec.get(labelValues)
+}
+
+type HistogramVec struct {
+	metricDesc
+	buckets []float64
+	mutex   sync.RWMutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+func NewHistogramVec(r *Registry, name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	sortedBuckets := append([]float64(nil), buckets...)
+	sort.Float64s(sortedBuckets)
+
+	h := &HistogramVec{
+		metricDesc: metricDesc{name: name, help: help, labelNames: labelNames},
+		buckets:    sortedBuckets,
+		values:     make(map[string]*histogramValue),
+	}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	entry, ok := h.values[key]
+	if !ok {
+		entry = &histogramValue{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = entry
+	}
+
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			entry.counts[i]++
+		}
+	}
+	entry.count++
+	entry.sum += value
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	h.writeHeader(w, histogramType)
+	for _, key := range sortedKeys(h.values) {
+		entry := h.values[key]
+		for i, upperBound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(entry.labelValues, "le", formatFloat(upperBound)), entry.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(entry.labelValues, "le", "+Inf"), entry.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(entry.labelValues), formatFloat(entry.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(entry.labelValues), entry.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
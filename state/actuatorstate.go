@@ -0,0 +1,66 @@
+package state
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// ActuatorSource tells what caused an actuator transition.
+type ActuatorSource string
+
+const (
+	ActuatorSourceManual    ActuatorSource = "manual"
+	ActuatorSourceSchedule  ActuatorSource = "schedule"
+	ActuatorSourceAuto      ActuatorSource = "auto"
+	ActuatorSourceTimer     ActuatorSource = "timer"
+	ActuatorSourceInterlock ActuatorSource = "interlock"
+)
+
+// ActuatorDutyDeadband is the smallest duty change (percentage points) that is
+// recorded as a transition, so a ramping fan does not log every step.
+const ActuatorDutyDeadband = 5.0
+
+// ActuatorTransition is one change of an actuator to Value: 1/0 for on/off
+// actuators, the duty (0-100 %) for analog ones.
+type ActuatorTransition struct {
+	DeviceID string
+	Actuator DeviceControlVariable
+	Value    float64
+	Source   ActuatorSource
+	Time     time.Time
+}
+
+// actuatorKey identifies one actuator of one device.
+type actuatorKey struct {
+	deviceID string
+	actuator DeviceControlVariable
+}
+
+// ActuatorState remembers the last recorded transition of every actuator of
+// every device, so the next one can close it with its duration.
+type ActuatorState struct {
+	mutex sync.Mutex
+	last  map[actuatorKey]ActuatorTransition
+}
+
+func NewActuatorState() *ActuatorState {
+	return &ActuatorState{last: make(map[actuatorKey]ActuatorTransition)}
+}
+
+// Change stores transition unless the actuator already has that value, or a
+// duty within deadband of it while staying on. It returns the transition it
+// replaces; ok is false when there was none.
+func (state *ActuatorState) Change(transition ActuatorTransition, deadband float64) (previous ActuatorTransition, ok bool, changed bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	key := actuatorKey{deviceID: transition.DeviceID, actuator: transition.Actuator}
+	previous, ok = state.last[key]
+	if ok && (previous.Value == transition.Value ||
+		(previous.Value > 0 && transition.Value > 0 && math.Abs(previous.Value-transition.Value) < deadband)) {
+		return previous, ok, false
+	}
+	state.last[key] = transition
+	return previous, ok, true
+}
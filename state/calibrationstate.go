@@ -0,0 +1,183 @@
+package state
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+const DefaultDeviceID = "default"
+
+type CalibrationPoint struct {
+	Label          string  `json:"label"`
+	RawValue       float64 `json:"raw_value"`
+	ReferenceValue float64 `json:"reference_value"`
+}
+
+// Calibration maps a raw sensor reading to engineering units. With two or more
+// points the piecewise-linear curve is used, otherwise raw*Gain + Offset.
+type Calibration struct {
+	Offset float64            `json:"offset"`
+	Gain   float64            `json:"gain"`
+	Points []CalibrationPoint `json:"points"`
+}
+
+func IdentityCalibration() Calibration {
+	return Calibration{Gain: 1}
+}
+
+// CalibrationFromPoints builds the calibration recorded points yield: none
+// leave the sensor raw, one gives an offset correction, two or more a
+// piecewise-linear curve.
+func CalibrationFromPoints(points []CalibrationPoint) Calibration {
+	calibration := IdentityCalibration()
+	switch {
+	case len(points) == 1:
+		calibration.Offset = points[0].ReferenceValue - points[0].RawValue
+	case len(points) > 1:
+		calibration.Points = points
+	}
+	return calibration
+}
+
+// Equal compares offset, gain and curve points, regardless of point order.
+func (c Calibration) Equal(other Calibration) bool {
+	if c.Offset != other.Offset || c.Gain != other.Gain || len(c.Points) != len(other.Points) {
+		return false
+	}
+	points := append([]CalibrationPoint(nil), c.Points...)
+	otherPoints := append([]CalibrationPoint(nil), other.Points...)
+	sort.Slice(points, func(i, j int) bool { return points[i].Label < points[j].Label })
+	sort.Slice(otherPoints, func(i, j int) bool { return otherPoints[i].Label < otherPoints[j].Label })
+	for i := range points {
+		if points[i] != otherPoints[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate requires a finite, non-zero gain and curve points with distinct raw
+// values whose reference values rise or fall monotonically with the raw value.
+func (c Calibration) Validate() error {
+	if math.IsNaN(c.Offset) || math.IsInf(c.Offset, 0) {
+		return fmt.Errorf("offset must be a finite number")
+	}
+	if math.IsNaN(c.Gain) || math.IsInf(c.Gain, 0) || c.Gain == 0 {
+		return fmt.Errorf("gain must be a finite, non-zero number, got %g", c.Gain)
+	}
+
+	points := append([]CalibrationPoint(nil), c.Points...)
+	sort.Slice(points, func(i, j int) bool { return points[i].RawValue < points[j].RawValue })
+	direction := 0.0
+	for i, point := range points {
+		if math.IsNaN(point.RawValue) || math.IsInf(point.RawValue, 0) ||
+			math.IsNaN(point.ReferenceValue) || math.IsInf(point.ReferenceValue, 0) {
+			return fmt.Errorf("point %q contains a value that is not a finite number", point.Label)
+		}
+		if i == 0 {
+			continue
+		}
+		previous := points[i-1]
+		if point.RawValue == previous.RawValue {
+			return fmt.Errorf("points %q and %q share the raw value %g", previous.Label, point.Label, point.RawValue)
+		}
+		step := point.ReferenceValue - previous.ReferenceValue
+		if step == 0 || (direction != 0 && math.Signbit(step) != math.Signbit(direction)) {
+			return fmt.Errorf("reference values must rise or fall monotonically with the raw value, points %q and %q do not",
+				previous.Label, point.Label)
+		}
+		direction = step
+	}
+	return nil
+}
+
+func (c Calibration) Apply(raw float64) float64 {
+	if len(c.Points) < 2 {
+		return raw*c.Gain + c.Offset
+	}
+
+	points := append([]CalibrationPoint(nil), c.Points...)
+	sort.Slice(points, func(i, j int) bool { return points[i].RawValue < points[j].RawValue })
+
+	// Values outside the curve are extrapolated along the outermost segment.
+	i := sort.Search(len(points), func(i int) bool { return points[i].RawValue >= raw })
+	switch {
+	case i == 0:
+		i = 1
+	case i == len(points):
+		i = len(points) - 1
+	}
+
+	lo, hi := points[i-1], points[i]
+	if hi.RawValue == lo.RawValue {
+		return lo.ReferenceValue
+	}
+	ratio := (raw - lo.RawValue) / (hi.RawValue - lo.RawValue)
+	return lo.ReferenceValue + ratio*(hi.ReferenceValue-lo.ReferenceValue)
+}
+
+type deviceVariableKey struct {
+	deviceID string
+	variable ConditionVariable
+}
+
+type CalibrationState struct {
+	mutex          sync.RWMutex
+	calibrationMap map[deviceVariableKey]Calibration
+	lastRawMap     map[deviceVariableKey]float64
+}
+
+func NewCalibrationState() *CalibrationState {
+	return &CalibrationState{
+		calibrationMap: make(map[deviceVariableKey]Calibration),
+		lastRawMap:     make(map[deviceVariableKey]float64),
+	}
+}
+
+func (state *CalibrationState) Get(deviceID string, variable ConditionVariable) Calibration {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	if calibration, ok := state.calibrationMap[deviceVariableKey{deviceID, variable}]; ok {
+		return calibration
+	}
+	return IdentityCalibration()
+}
+
+func (state *CalibrationState) Set(deviceID string, variable ConditionVariable, calibration Calibration) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.calibrationMap[deviceVariableKey{deviceID, variable}] = calibration
+}
+
+func (state *CalibrationState) Reset(deviceID string, variable ConditionVariable) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	delete(state.calibrationMap, deviceVariableKey{deviceID, variable})
+}
+
+// Apply calibrates a raw reading and remembers it, so calibration points can
+// be recorded against the sensor's current reading.
+func (state *CalibrationState) Apply(deviceID string, variable ConditionVariable, raw float64) float64 {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	key := deviceVariableKey{deviceID, variable}
+	state.lastRawMap[key] = raw
+	if calibration, ok := state.calibrationMap[key]; ok {
+		return calibration.Apply(raw)
+	}
+	return raw
+}
+
+func (state *CalibrationState) LastRaw(deviceID string, variable ConditionVariable) (float64, bool) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	raw, ok := state.lastRawMap[deviceVariableKey{deviceID, variable}]
+	return raw, ok
+}
@@ -0,0 +1,164 @@
+package state
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type CommandStatus string
+
+const (
+	CommandPending   CommandStatus = "pending"
+	CommandDelivered CommandStatus = "delivered"
+	CommandApplied   CommandStatus = "applied"
+	CommandTimedOut  CommandStatus = "timed_out"
+)
+
+// Command is the last value of one ESP command delivered to a device. Every
+// change gets a new sequence number, which the ESP echoes once applied.
+type Command struct {
+	Name        string     `json:"name"`
+	Value       float64    `json:"value"`
+	Seq         uint64     `json:"seq"`
+	ChangedAt   time.Time  `json:"changed_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
+
+func (c Command) Status(now time.Time, ackTimeout time.Duration) CommandStatus {
+	switch {
+	case c.AppliedAt != nil:
+		return CommandApplied
+	case c.DeliveredAt == nil:
+		return CommandPending
+	case now.Sub(*c.DeliveredAt) > ackTimeout:
+		return CommandTimedOut
+	default:
+		return CommandDelivered
+	}
+}
+
+// DesiredCommands is the current value of every command the ESP of deviceID
+// receives, keyed by its field name in the sampling response. The pump runs
+// for one device at a time, so only the device of the running pump run is
+// told to switch its pump on.
+func DesiredCommands(deviceID string, deviceState *DeviceState, modelState *ModelState, tuneState *TuneState,
+	pumpState *PumpState) map[string]float64 {
+	deviceStateMap := deviceState.GetAll()
+	analogStateMap := deviceState.GetAllAnalog()
+	modelStateMap := modelState.GetAll()
+	tuneStateMap := tuneState.GetAll()
+	pumpOn := deviceStateMap[WaterPumpControl]
+	if run, ok := pumpState.LastRun(); !ok || run.DeviceID != deviceID {
+		pumpOn = false
+	}
+	return map[string]float64{
+		"temp_sp":            modelStateMap[TemperatureSP],
+		"temp_kp":            tuneStateMap[TemperatureKp],
+		"temp_ki":            tuneStateMap[TemperatureKi],
+		"temp_kd":            tuneStateMap[TemperatureKd],
+		"fan_control":        boolToFloat(deviceStateMap[FanControl]),
+		"fan_duty":           analogStateMap[FanDuty],
+		"heater_control":     boolToFloat(deviceStateMap[HeaterControl]),
+		"heater_duty":        analogStateMap[HeaterDuty],
+		"cooler_duty":        analogStateMap[CoolerDuty],
+		"water_pump_control": boolToFloat(pumpOn),
+		"light_control":      boolToFloat(deviceStateMap[LightControl]),
+		"co2_sp":             modelStateMap[CO2SP],
+		"co2_control":        boolToFloat(deviceStateMap[CO2Control]),
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type CommandState struct {
+	mutex   sync.RWMutex
+	nextSeq uint64
+	devices map[string]map[string]*Command
+}
+
+// NewCommandState starts the sequence at the current Unix time in
+// milliseconds, so numbers keep increasing across restarts and an ESP never
+// acknowledges a new command with a number from before the restart.
+func NewCommandState() *CommandState {
+	return &CommandState{
+		nextSeq: uint64(time.Now().UnixMilli()),
+		devices: make(map[string]map[string]*Command),
+	}
+}
+
+// Deliver records the commands sent to a device in a response, giving changed
+// values a new sequence number, and returns the sequence number per command.
+func (state *CommandState) Deliver(deviceID string, desired map[string]float64, now time.Time) map[string]uint64 {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	commands, ok := state.devices[deviceID]
+	if !ok {
+		commands = make(map[string]*Command)
+		state.devices[deviceID] = commands
+	}
+
+	seqs := make(map[string]uint64, len(desired))
+	for name, value := range desired {
+		c, ok := commands[name]
+		if !ok || c.Value != value {
+			state.nextSeq++
+			c = &Command{Name: name, Value: value, Seq: state.nextSeq, ChangedAt: now}
+			commands[name] = c
+		}
+		if c.DeliveredAt == nil {
+			deliveredAt := now
+			c.DeliveredAt = &deliveredAt
+		}
+		seqs[name] = c.Seq
+	}
+	return seqs
+}
+
+// Acknowledge marks commands as applied whose echoed sequence number is at
+// least the one last delivered.
+func (state *CommandState) Acknowledge(deviceID string, applied map[string]uint64, now time.Time) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	commands := state.devices[deviceID]
+	for name, seq := range applied {
+		c, ok := commands[name]
+		if !ok || c.AppliedAt != nil || seq < c.Seq {
+			continue
+		}
+		appliedAt := now
+		c.AppliedAt = &appliedAt
+	}
+}
+
+func (state *CommandState) Commands(deviceID string) []Command {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	commands := make([]Command, 0, len(state.devices[deviceID]))
+	for _, c := range state.devices[deviceID] {
+		commands = append(commands, *c)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+func (state *CommandState) Devices() []string {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	devices := make([]string, 0, len(state.devices))
+	for deviceID := range state.devices {
+		devices = append(devices, deviceID)
+	}
+	sort.Strings(devices)
+	return devices
+}
@@ -0,0 +1,141 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeviceConfig is the configuration document an ESP fetches instead of
+// compiling it into the firmware.
+type DeviceConfig struct {
+	SamplingIntervalSeconds int             `json:"sampling_interval_seconds"`
+	Sensors                 map[string]bool `json:"sensors"`
+	Pins                    map[string]int  `json:"pins"`
+}
+
+func (c DeviceConfig) Validate() error {
+	if c.SamplingIntervalSeconds < 1 || c.SamplingIntervalSeconds > 3600 {
+		return fmt.Errorf("sampling_interval_seconds must be between 1 and 3600, got %d", c.SamplingIntervalSeconds)
+	}
+	for sensor := range c.Sensors {
+		if sensor == "" {
+			return fmt.Errorf("sensor name must not be empty")
+		}
+	}
+
+	names := make([]string, 0, len(c.Pins))
+	for name := range c.Pins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	assigned := make(map[int]string, len(names))
+	for _, name := range names {
+		pin := c.Pins[name]
+		if name == "" {
+			return fmt.Errorf("pin name must not be empty")
+		}
+		if pin < 0 || pin > 39 {
+			return fmt.Errorf("pin %s must be a GPIO between 0 and 39, got %d", name, pin)
+		}
+		if other, ok := assigned[pin]; ok {
+			return fmt.Errorf("GPIO %d is assigned to both %s and %s", pin, other, name)
+		}
+		assigned[pin] = name
+	}
+	return nil
+}
+
+// VersionedDeviceConfig is one stored revision of a device's configuration.
+// Versions are taken from one sequence across all devices, so a device that
+// falls back to the default configuration sees its version change both when
+// the default is edited and when it gets a configuration of its own.
+type VersionedDeviceConfig struct {
+	DeviceConfig
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type DeviceConfigState struct {
+	mutex   sync.RWMutex
+	configs map[string]VersionedDeviceConfig
+	latest  int
+}
+
+func NewDeviceConfigState() *DeviceConfigState {
+	return &DeviceConfigState{
+		configs: make(map[string]VersionedDeviceConfig),
+	}
+}
+
+func (state *DeviceConfigState) Get(deviceID string) (VersionedDeviceConfig, bool) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	config, ok := state.configs[deviceID]
+	return config, ok
+}
+
+// Effective returns the device's own configuration, or the default device's
+// when it has none.
+func (state *DeviceConfigState) Effective(deviceID string) (VersionedDeviceConfig, bool) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	if config, ok := state.configs[deviceID]; ok {
+		return config, true
+	}
+	config, ok := state.configs[DefaultDeviceID]
+	return config, ok
+}
+
+// Set keeps the newest version, so a slow writer cannot roll a device back.
+func (state *DeviceConfigState) Set(deviceID string, config VersionedDeviceConfig) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if current, ok := state.configs[deviceID]; ok && current.Version >= config.Version {
+		return
+	}
+	state.configs[deviceID] = config
+	if config.Version > state.latest {
+		state.latest = config.Version
+	}
+}
+
+// Update replaces the device's configuration with config under the next
+// version of the sequence, unless expectedVersion is given and differs from
+// the current version. Comparing and replacing under one lock lets only one
+// of two concurrent edits of the same version through. It returns the
+// configuration it replaced for Revert; ok is false on a version conflict.
+func (state *DeviceConfigState) Update(deviceID string, config DeviceConfig, expectedVersion *int, now time.Time) (
+	previous VersionedDeviceConfig, next VersionedDeviceConfig, ok bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	previous = state.configs[deviceID]
+	if expectedVersion != nil && *expectedVersion != previous.Version {
+		return previous, previous, false
+	}
+	state.latest++
+	next = VersionedDeviceConfig{DeviceConfig: config, Version: state.latest, UpdatedAt: now}
+	state.configs[deviceID] = next
+	return previous, next, true
+}
+
+// Revert restores previous once storing next failed, unless a later edit has
+// replaced next already.
+func (state *DeviceConfigState) Revert(deviceID string, previous VersionedDeviceConfig, next VersionedDeviceConfig) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.configs[deviceID].Version != next.Version {
+		return
+	}
+	if previous.Version == 0 {
+		delete(state.configs, deviceID)
+		return
+	}
+	state.configs[deviceID] = previous
+}
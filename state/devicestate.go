@@ -10,17 +10,27 @@ type DeviceControlVariable string
 const (
 	FanControl       DeviceControlVariable = "fan_control"
 	WaterPumpControl DeviceControlVariable = "pump_water"
+	LightControl     DeviceControlVariable = "light_control"
+	CO2Control       DeviceControlVariable = "co2_control"
+	FanDuty          DeviceControlVariable = "fan_duty"
+	HeaterControl    DeviceControlVariable = "heater_control"
+	HeaterDuty       DeviceControlVariable = "heater_duty"
+	CoolerDuty       DeviceControlVariable = "cooler_duty"
 )
 
+// DeviceState holds on/off actuators in ValueMap and analog actuators (0-100 %)
+// in AnalogMap.
 type DeviceState struct {
 	Mutex       sync.RWMutex
 	ValueMap    map[DeviceControlVariable]bool
+	AnalogMap   map[DeviceControlVariable]float64
 	CancelTimer context.CancelFunc
 }
 
 func NewDeviceState() *DeviceState {
 	return &DeviceState{
-		ValueMap: make(map[DeviceControlVariable]bool),
+		ValueMap:  make(map[DeviceControlVariable]bool),
+		AnalogMap: make(map[DeviceControlVariable]float64),
 	}
 }
 
@@ -42,3 +52,22 @@ func (state *DeviceState) Set(variable DeviceControlVariable, value bool) {
 
 	state.ValueMap[variable] = value
 }
+
+func (state *DeviceState) GetAllAnalog() map[DeviceControlVariable]float64 {
+	state.Mutex.RLock()
+	defer state.Mutex.RUnlock()
+
+	copyMap := make(map[DeviceControlVariable]float64, len(state.AnalogMap))
+	for k, v := range state.AnalogMap {
+		copyMap[k] = v
+	}
+
+	return copyMap
+}
+
+func (state *DeviceState) SetAnalog(variable DeviceControlVariable, value float64) {
+	state.Mutex.Lock()
+	defer state.Mutex.Unlock()
+
+	state.AnalogMap[variable] = value
+}
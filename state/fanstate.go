@@ -0,0 +1,139 @@
+package state
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type FanMode string
+
+const (
+	FanModeManual      FanMode = "manual"
+	FanModeTemperature FanMode = "auto_temperature"
+	FanModeHumidity    FanMode = "auto_humidity"
+)
+
+// FanSettings selects how the fan duty (0-100 %) is set. In the auto modes the
+// duty rises proportionally from the minimum duty at StartValue to the maximum
+// duty at FullValue of the controlling variable; below StartValue the fan is off.
+type FanSettings struct {
+	Mode       FanMode `json:"mode"`
+	ManualDuty float64 `json:"manual_duty"`
+	StartValue float64 `json:"start_value"`
+	FullValue  float64 `json:"full_value"`
+}
+
+func DefaultFanSettings() FanSettings {
+	return FanSettings{Mode: FanModeManual}
+}
+
+func (s FanSettings) Validate() error {
+	switch s.Mode {
+	case FanModeManual:
+	case FanModeTemperature, FanModeHumidity:
+		if s.FullValue <= s.StartValue {
+			return fmt.Errorf("full_value (%g) must be greater than start_value (%g)", s.FullValue, s.StartValue)
+		}
+	default:
+		return fmt.Errorf("unknown fan mode [%s]", s.Mode)
+	}
+	if s.ManualDuty < 0 || s.ManualDuty > 100 {
+		return fmt.Errorf("manual_duty must be between 0 and 100, got %g", s.ManualDuty)
+	}
+	return nil
+}
+
+// ControlVariable is the process value an auto mode follows.
+func (s FanSettings) ControlVariable() (ConditionVariable, bool) {
+	switch s.Mode {
+	case FanModeTemperature:
+		return TemperaturePV, true
+	case FanModeHumidity:
+		return HumidityPV, true
+	default:
+		return "", false
+	}
+}
+
+type FanState struct {
+	mutex    sync.RWMutex
+	settings FanSettings
+	duty     float64
+	lastStep time.Time
+	onSince  time.Time
+	onDevice string
+}
+
+func NewFanState() *FanState {
+	return &FanState{settings: DefaultFanSettings()}
+}
+
+func (state *FanState) GetSettings() FanSettings {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	return state.settings
+}
+
+func (state *FanState) SetSettings(settings FanSettings) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.settings = settings
+}
+
+func (state *FanState) Duty() float64 {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	return state.duty
+}
+
+// Step moves the duty towards target by at most rate %/s since the previous
+// step; a rate of zero applies the target at once.
+func (state *FanState) Step(now time.Time, target float64, rate float64) float64 {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if rate <= 0 || state.lastStep.IsZero() {
+		state.duty = target
+	} else {
+		maxChange := rate * now.Sub(state.lastStep).Seconds()
+		state.duty += math.Max(-maxChange, math.Min(maxChange, target-state.duty))
+	}
+	state.lastStep = now
+	return state.duty
+}
+
+// SwitchOn marks the start of a fan run.
+func (state *FanState) SwitchOn(deviceID string, now time.Time) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.onSince, state.onDevice = now, deviceID
+}
+
+// SwitchOff ends the current run and returns its start and the device that
+// started it; ok is false when no run was started, for example when the fan
+// was on before a restart.
+func (state *FanState) SwitchOff() (string, time.Time, bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	deviceID, start := state.onDevice, state.onSince
+	state.onSince, state.onDevice = time.Time{}, ""
+	return deviceID, start, !start.IsZero()
+}
+
+// OnSince returns the start of the run in progress if deviceID started it.
+func (state *FanState) OnSince(deviceID string) (time.Time, bool) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	if state.onDevice != deviceID {
+		return time.Time{}, false
+	}
+	return state.onSince, !state.onSince.IsZero()
+}
@@ -0,0 +1,196 @@
+package state
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+type FilterKind string
+
+const (
+	FilterNone          FilterKind = "none"
+	FilterMovingAverage FilterKind = "moving_average"
+	FilterEMA           FilterKind = "ema"
+	FilterMedian        FilterKind = "median"
+	FilterKalman        FilterKind = "kalman"
+)
+
+type FilterConfig struct {
+	Kind             FilterKind `json:"kind"`
+	Window           int        `json:"window,omitempty"`
+	Alpha            float64    `json:"alpha,omitempty"`
+	ProcessNoise     float64    `json:"process_noise,omitempty"`
+	MeasurementNoise float64    `json:"measurement_noise,omitempty"`
+}
+
+func (c FilterConfig) Validate() error {
+	switch c.Kind {
+	case FilterNone:
+	case FilterMovingAverage, FilterMedian:
+		if c.Window < 1 {
+			return fmt.Errorf("%s filter needs window >= 1, got %d", c.Kind, c.Window)
+		}
+	case FilterEMA:
+		if c.Alpha <= 0 || c.Alpha > 1 {
+			return fmt.Errorf("ema filter needs 0 < alpha <= 1, got %g", c.Alpha)
+		}
+	case FilterKalman:
+		if c.ProcessNoise <= 0 || c.MeasurementNoise <= 0 {
+			return fmt.Errorf("kalman filter needs positive process_noise and measurement_noise")
+		}
+	default:
+		return fmt.Errorf("unknown filter kind [%s]", c.Kind)
+	}
+	return nil
+}
+
+type signalFilter interface {
+	update(value float64) float64
+}
+
+func newSignalFilter(c FilterConfig) signalFilter {
+	switch c.Kind {
+	case FilterMovingAverage:
+		return &windowFilter{size: c.Window, reduce: mean}
+	case FilterMedian:
+		return &windowFilter{size: c.Window, reduce: median}
+	case FilterEMA:
+		return &emaFilter{alpha: c.Alpha}
+	case FilterKalman:
+		return &kalmanFilter{q: c.ProcessNoise, r: c.MeasurementNoise}
+	default:
+		return passThroughFilter{}
+	}
+}
+
+type passThroughFilter struct{}
+
+func (passThroughFilter) update(value float64) float64 {
+	return value
+}
+
+type windowFilter struct {
+	size   int
+	values []float64
+	reduce func([]float64) float64
+}
+
+func (f *windowFilter) update(value float64) float64 {
+	f.values = append(f.values, value)
+	if len(f.values) > f.size {
+		f.values = f.values[len(f.values)-f.size:]
+	}
+	return f.reduce(f.values)
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+type emaFilter struct {
+	alpha       float64
+	value       float64
+	initialised bool
+}
+
+func (f *emaFilter) update(value float64) float64 {
+	if !f.initialised {
+		f.value, f.initialised = value, true
+		return value
+	}
+	f.value += f.alpha * (value - f.value)
+	return f.value
+}
+
+// kalmanFilter is a scalar random-walk Kalman filter: q is the process noise
+// variance per sample and r the measurement noise variance.
+type kalmanFilter struct {
+	q, r        float64
+	estimate    float64
+	errorCov    float64
+	initialised bool
+}
+
+func (f *kalmanFilter) update(value float64) float64 {
+	if !f.initialised {
+		f.estimate, f.errorCov, f.initialised = value, f.r, true
+		return value
+	}
+	f.errorCov += f.q
+	gain := f.errorCov / (f.errorCov + f.r)
+	f.estimate += gain * (value - f.estimate)
+	f.errorCov *= 1 - gain
+	return f.estimate
+}
+
+type FilterState struct {
+	mutex     sync.Mutex
+	configMap map[ConditionVariable]FilterConfig
+	filterMap map[deviceVariableKey]signalFilter
+}
+
+func NewFilterState() *FilterState {
+	return &FilterState{
+		configMap: make(map[ConditionVariable]FilterConfig),
+		filterMap: make(map[deviceVariableKey]signalFilter),
+	}
+}
+
+func (state *FilterState) GetConfig(variable ConditionVariable) FilterConfig {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if c, ok := state.configMap[variable]; ok {
+		return c
+	}
+	return FilterConfig{Kind: FilterNone}
+}
+
+// SetConfig replaces the filter of a variable and drops the filter state of
+// every device, so the new filter starts from the next sample.
+func (state *FilterState) SetConfig(variable ConditionVariable, c FilterConfig) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.configMap[variable] = c
+	for key := range state.filterMap {
+		if key.variable == variable {
+			delete(state.filterMap, key)
+		}
+	}
+}
+
+func (state *FilterState) Apply(deviceID string, variable ConditionVariable, value float64) float64 {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	key := deviceVariableKey{deviceID, variable}
+	f, ok := state.filterMap[key]
+	if !ok {
+		f = newSignalFilter(state.configMap[variable])
+		state.filterMap[key] = f
+	}
+
+	filtered := f.update(value)
+	if math.IsNaN(filtered) || math.IsInf(filtered, 0) {
+		delete(state.filterMap, key)
+		return value
+	}
+	return filtered
+}
@@ -0,0 +1,243 @@
+package state
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// firmwareVersionPattern also keeps versions safe to use as file names.
+var firmwareVersionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]{0,31}$`)
+
+func ValidateFirmwareVersion(version string) error {
+	if !firmwareVersionPattern.MatchString(version) {
+		return fmt.Errorf("firmware version %q must be 1-32 letters, digits, '.', '_', '+' or '-'", version)
+	}
+	return nil
+}
+
+type FirmwareImage struct {
+	Version    string    `json:"version"`
+	SHA256     string    `json:"sha256"`
+	Size       int64     `json:"size"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type FirmwareTargetScope string
+
+const (
+	FirmwareTargetDevice FirmwareTargetScope = "device"
+	FirmwareTargetGroup  FirmwareTargetScope = "group"
+)
+
+type FirmwareUpdateStatus string
+
+const (
+	FirmwareUpToDate    FirmwareUpdateStatus = "up_to_date"
+	FirmwarePending     FirmwareUpdateStatus = "pending"
+	FirmwareDownloading FirmwareUpdateStatus = "downloading"
+	FirmwareFailed      FirmwareUpdateStatus = "failed"
+)
+
+// FirmwareUpdate is the update progress of a device as derived from the
+// version it reports running and the image requests it makes.
+type FirmwareUpdate struct {
+	DeviceID        string               `json:"device_id"`
+	TargetVersion   string               `json:"target_version"`
+	ReportedVersion string               `json:"reported_version"`
+	Status          FirmwareUpdateStatus `json:"status"`
+	Message         string               `json:"message,omitempty"`
+	UpdatedAt       time.Time            `json:"updated_at"`
+}
+
+type FirmwareState struct {
+	mutex         sync.RWMutex
+	images        map[string]FirmwareImage
+	deviceTargets map[string]string
+	groupTargets  map[string]string
+	groups        map[string]string
+	updates       map[string]FirmwareUpdate
+}
+
+func NewFirmwareState() *FirmwareState {
+	return &FirmwareState{
+		images:        make(map[string]FirmwareImage),
+		deviceTargets: make(map[string]string),
+		groupTargets:  make(map[string]string),
+		groups:        make(map[string]string),
+		updates:       make(map[string]FirmwareUpdate),
+	}
+}
+
+func (state *FirmwareState) AddImage(image FirmwareImage) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.images[image.Version] = image
+}
+
+func (state *FirmwareState) Image(version string) (FirmwareImage, bool) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	image, ok := state.images[version]
+	return image, ok
+}
+
+func (state *FirmwareState) Images() []FirmwareImage {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	images := make([]FirmwareImage, 0, len(state.images))
+	for _, image := range state.images {
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].UploadedAt.Before(images[j].UploadedAt) })
+	return images
+}
+
+// SetTarget assigns a version to a device or group; an empty version removes
+// the assignment.
+func (state *FirmwareState) SetTarget(scope FirmwareTargetScope, name string, version string) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	targets := state.deviceTargets
+	if scope == FirmwareTargetGroup {
+		targets = state.groupTargets
+	}
+	if version == "" {
+		delete(targets, name)
+		return
+	}
+	targets[name] = version
+}
+
+// Targets returns the assignments per device and per group.
+func (state *FirmwareState) Targets() (map[string]string, map[string]string) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	devices := make(map[string]string, len(state.deviceTargets))
+	for name, version := range state.deviceTargets {
+		devices[name] = version
+	}
+	groups := make(map[string]string, len(state.groupTargets))
+	for name, version := range state.groupTargets {
+		groups[name] = version
+	}
+	return devices, groups
+}
+
+// SetGroup puts a device into a group; an empty group removes it from its group.
+func (state *FirmwareState) SetGroup(deviceID string, group string) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if group == "" {
+		delete(state.groups, deviceID)
+		return
+	}
+	state.groups[deviceID] = group
+}
+
+func (state *FirmwareState) Groups() map[string]string {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	groups := make(map[string]string, len(state.groups))
+	for deviceID, group := range state.groups {
+		groups[deviceID] = group
+	}
+	return groups
+}
+
+// Target is the image a device should run: its own assignment wins over the
+// one of its group.
+func (state *FirmwareState) Target(deviceID string) (FirmwareImage, bool) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	return state.target(deviceID)
+}
+
+func (state *FirmwareState) target(deviceID string) (FirmwareImage, bool) {
+	version, ok := state.deviceTargets[deviceID]
+	if !ok {
+		version, ok = state.groupTargets[state.groups[deviceID]]
+	}
+	if !ok {
+		return FirmwareImage{}, false
+	}
+	image, ok := state.images[version]
+	return image, ok
+}
+
+// Report updates the progress from the version a device reports running and
+// an optional update error; changed is false when nothing new was learned.
+func (state *FirmwareState) Report(deviceID string, reportedVersion string, updateError string, now time.Time) (FirmwareUpdate, bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	previous := state.updates[deviceID]
+	update := previous
+	update.DeviceID = deviceID
+	update.ReportedVersion = reportedVersion
+
+	target, hasTarget := state.target(deviceID)
+	switch {
+	case !hasTarget || target.Version == reportedVersion:
+		update.TargetVersion = target.Version
+		update.Status = FirmwareUpToDate
+		update.Message = ""
+	case updateError != "":
+		update.TargetVersion = target.Version
+		update.Status = FirmwareFailed
+		update.Message = updateError
+	case previous.TargetVersion != target.Version || previous.Status == FirmwareUpToDate:
+		update.TargetVersion = target.Version
+		update.Status = FirmwarePending
+		update.Message = ""
+	}
+
+	if update.TargetVersion == previous.TargetVersion && update.ReportedVersion == previous.ReportedVersion &&
+		update.Status == previous.Status && update.Message == previous.Message {
+		return previous, false
+	}
+	update.UpdatedAt = now
+	state.updates[deviceID] = update
+	return update, true
+}
+
+// MarkDownloading records that a device requested its target image.
+func (state *FirmwareState) MarkDownloading(deviceID string, version string, now time.Time) (FirmwareUpdate, bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	update, ok := state.updates[deviceID]
+	if !ok || update.TargetVersion != version || update.Status == FirmwareDownloading || update.Status == FirmwareUpToDate {
+		return update, false
+	}
+	update.Status = FirmwareDownloading
+	update.Message = ""
+	update.UpdatedAt = now
+	state.updates[deviceID] = update
+	return update, true
+}
+
+func (state *FirmwareState) RestoreUpdate(update FirmwareUpdate) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.updates[update.DeviceID] = update
+}
+
+func (state *FirmwareState) Updates() []FirmwareUpdate {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	updates := make([]FirmwareUpdate, 0, len(state.updates))
+	for _, update := range state.updates {
+		updates = append(updates, update)
+	}
+	sort.Slice(updates, func(i, j int) bool { return updates[i].DeviceID < updates[j].DeviceID })
+	return updates
+}
@@ -0,0 +1,156 @@
+package state
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	LightPV  ConditionVariable = "light_pv"
+	LightDLI ConditionVariable = "light_dli"
+)
+
+type LightMode string
+
+const (
+	LightModeManual     LightMode = "manual"
+	LightModeSchedule   LightMode = "schedule"
+	LightModeSupplement LightMode = "supplement"
+)
+
+// LightSchedule is the photoperiod of the grow lights. OnAt and OffAt are
+// local "15:04" clock times; a window that ends before it starts spans midnight.
+// In supplement mode lights only run inside the window while natural light
+// alone would miss the DLI target (mol/m²/d).
+type LightSchedule struct {
+	Mode      LightMode `json:"mode"`
+	OnAt      string    `json:"on_at"`
+	OffAt     string    `json:"off_at"`
+	DLITarget float64   `json:"dli_target"`
+}
+
+func DefaultLightSchedule() LightSchedule {
+	return LightSchedule{Mode: LightModeManual, OnAt: "06:00", OffAt: "22:00"}
+}
+
+func (s LightSchedule) Validate() error {
+	switch s.Mode {
+	case LightModeManual, LightModeSchedule, LightModeSupplement:
+	default:
+		return fmt.Errorf("unknown light mode [%s]", s.Mode)
+	}
+	if _, err := time.Parse("15:04", s.OnAt); err != nil {
+		return fmt.Errorf("on_at [%s] is not a HH:MM time", s.OnAt)
+	}
+	if _, err := time.Parse("15:04", s.OffAt); err != nil {
+		return fmt.Errorf("off_at [%s] is not a HH:MM time", s.OffAt)
+	}
+	if s.OnAt == s.OffAt {
+		return fmt.Errorf("on_at and off_at must differ")
+	}
+	if s.DLITarget < 0 {
+		return fmt.Errorf("dli_target must not be negative")
+	}
+	if s.Mode == LightModeSupplement && s.DLITarget == 0 {
+		return fmt.Errorf("supplement mode needs a dli_target")
+	}
+	return nil
+}
+
+// WithPhotoperiod keeps the switch-on time and moves the switch-off time so
+// the lights are scheduled on for the given hours.
+func (s LightSchedule) WithPhotoperiod(hours float64) LightSchedule {
+	onAt, _ := time.Parse("15:04", s.OnAt)
+	s.OffAt = onAt.Add(time.Duration(math.Round(hours*60)) * time.Minute).Format("15:04")
+	return s
+}
+
+// Window returns the photoperiod that contains now, or the next one when now
+// is outside of it.
+func (s LightSchedule) Window(now time.Time) (start time.Time, end time.Time) {
+	onAt, _ := time.Parse("15:04", s.OnAt)
+	offAt, _ := time.Parse("15:04", s.OffAt)
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start = midnight.Add(time.Duration(onAt.Hour())*time.Hour + time.Duration(onAt.Minute())*time.Minute)
+	end = midnight.Add(time.Duration(offAt.Hour())*time.Hour + time.Duration(offAt.Minute())*time.Minute)
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	if now.Before(start) && now.Before(end.AddDate(0, 0, -1)) {
+		start, end = start.AddDate(0, 0, -1), end.AddDate(0, 0, -1)
+	}
+	if !now.Before(end) {
+		start, end = start.AddDate(0, 0, 1), end.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+type LightState struct {
+	mutex      sync.RWMutex
+	schedule   LightSchedule
+	dli        float64
+	dliDay     time.Time
+	lastSample time.Time
+	lastPPFD   float64
+}
+
+func NewLightState() *LightState {
+	return &LightState{schedule: DefaultLightSchedule()}
+}
+
+func (state *LightState) GetSchedule() LightSchedule {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	return state.schedule
+}
+
+func (state *LightState) SetSchedule(schedule LightSchedule) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.schedule = schedule
+}
+
+// Integrate adds a PPFD sample (µmol/m²/s) to the daily light integral using
+// the trapezoidal rule and starts a new day at local midnight. Gaps longer
+// than maxGap are not integrated.
+func (state *LightState) Integrate(now time.Time, ppfd float64, maxGap time.Duration) float64 {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if !day.Equal(state.dliDay) {
+		state.dliDay = day
+		state.dli = 0
+		state.lastSample = time.Time{}
+	}
+
+	if !state.lastSample.IsZero() {
+		if dt := now.Sub(state.lastSample); dt > 0 && dt <= maxGap {
+			state.dli += (state.lastPPFD + ppfd) / 2 * dt.Seconds() / 1e6
+		}
+	}
+	state.lastSample = now
+	state.lastPPFD = ppfd
+	return state.dli
+}
+
+// RestoreDLI seeds today's integral, e.g. after a restart.
+func (state *LightState) RestoreDLI(now time.Time, dli float64) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.dliDay = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	state.dli = dli
+}
+
+func (state *LightState) GetDLI() (dli float64, ppfd float64, lastSample time.Time) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	return state.dli, state.lastPPFD, state.lastSample
+}
@@ -0,0 +1,96 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type LoopName string
+
+const (
+	LoopTemperature LoopName = "temperature"
+	LoopHumidity    LoopName = "humidity"
+	LoopMoisture    LoopName = "moisture"
+)
+
+type LoopMode string
+
+const (
+	LoopModeManual LoopMode = "manual"
+	LoopModeAuto   LoopMode = "auto"
+	LoopModeOff    LoopMode = "off"
+)
+
+// LoopSettings is the mode of a control loop. In manual mode ManualOutput is
+// applied directly: temp_co for temperature and the fan duty in % for
+// humidity. The moisture loop has no continuous output; manual allows operator
+// pump runs only, auto also waters when moisture drops below the threshold.
+type LoopSettings struct {
+	Mode         LoopMode `json:"mode"`
+	ManualOutput float64  `json:"manual_output"`
+}
+
+func (s LoopSettings) Validate() error {
+	switch s.Mode {
+	case LoopModeManual, LoopModeAuto, LoopModeOff:
+		return nil
+	default:
+		return fmt.Errorf("unknown loop mode [%s]", s.Mode)
+	}
+}
+
+func IsLoop(name LoopName) bool {
+	switch name {
+	case LoopTemperature, LoopHumidity, LoopMoisture:
+		return true
+	default:
+		return false
+	}
+}
+
+type LoopState struct {
+	mutex    sync.RWMutex
+	settings map[LoopName]LoopSettings
+}
+
+// NewLoopState starts temperature and humidity (the fan settings) in auto and
+// moisture in manual, which is how the loops behaved before modes existed.
+func NewLoopState() *LoopState {
+	return &LoopState{
+		settings: map[LoopName]LoopSettings{
+			LoopTemperature: {Mode: LoopModeAuto},
+			LoopHumidity:    {Mode: LoopModeAuto},
+			LoopMoisture:    {Mode: LoopModeManual},
+		},
+	}
+}
+
+func (state *LoopState) Get(name LoopName) LoopSettings {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	return state.settings[name]
+}
+
+// Set stores the settings of a loop and returns the previous ones.
+func (state *LoopState) Set(name LoopName, settings LoopSettings) LoopSettings {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	previous := state.settings[name]
+	state.settings[name] = settings
+	return previous
+}
+
+func (state *LoopState) Names() []LoopName {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	names := make([]LoopName, 0, len(state.settings))
+	for name := range state.settings {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
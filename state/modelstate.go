@@ -10,6 +10,12 @@ const (
 	TemperatureSP ConditionVariable = "temp_sp"
 	MoisturePV    ConditionVariable = "moist_pv"
 	HumidityPV    ConditionVariable = "humidity_pv"
+	CO2PV         ConditionVariable = "co2_pv"
+	CO2SP         ConditionVariable = "co2_sp"
+	HumidityMin   ConditionVariable = "humidity_sp_min"
+	HumidityMax   ConditionVariable = "humidity_sp_max"
+	MoistureMin   ConditionVariable = "moist_sp_min"
+	MoistureMax   ConditionVariable = "moist_sp_max"
 )
 
 type ModelState struct {
@@ -41,3 +47,10 @@ func (state *ModelState) Set(variable ConditionVariable, value float64) {
 
 	state.valueMap[variable] = value
 }
+
+func (state *ModelState) Delete(variable ConditionVariable) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	delete(state.valueMap, variable)
+}
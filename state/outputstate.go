@@ -0,0 +1,31 @@
+package state
+
+import (
+	"sync"
+	"time"
+)
+
+// TimeProportioningState turns a duty into an on/off relay signal: every
+// cycle starts with the relay on for duty % of the period. The duty is latched
+// at the start of a cycle, so changes within a cycle do not make it chatter.
+type TimeProportioningState struct {
+	mutex      sync.Mutex
+	cycleStart time.Time
+	cycleDuty  float64
+}
+
+func NewTimeProportioningState() *TimeProportioningState {
+	return &TimeProportioningState{}
+}
+
+func (state *TimeProportioningState) Output(now time.Time, duty float64, period time.Duration) bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.cycleStart.IsZero() || now.Sub(state.cycleStart) >= period {
+		state.cycleStart = now
+		state.cycleDuty = duty
+	}
+	onTime := time.Duration(state.cycleDuty / 100 * float64(period))
+	return now.Before(state.cycleStart.Add(onTime))
+}
@@ -0,0 +1,185 @@
+package state
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type PumpInterlockCode string
+
+const (
+	PumpRunTooLong      PumpInterlockCode = "pump_run_too_long"
+	PumpAlreadyRunning  PumpInterlockCode = "pump_already_running"
+	PumpMinOffTime      PumpInterlockCode = "pump_min_off_time"
+	PumpDailyRuntime    PumpInterlockCode = "pump_daily_runtime_exceeded"
+	PumpTankLow         PumpInterlockCode = "pump_tank_low"
+	PumpMoistureCeiling PumpInterlockCode = "pump_moisture_ceiling"
+	PumpLoopOff         PumpInterlockCode = "pump_loop_off"
+)
+
+// PumpRuntimeWindow is the rolling window of the daily runtime limit.
+const PumpRuntimeWindow = 24 * time.Hour
+
+// PumpRun is one activation of the water pump. RequestedML is zero for runs
+// started by duration; DeliveredML is counted from flow-meter pulses when
+// Metered, otherwise estimated from the flow calibration when the run ends.
+type PumpRun struct {
+	DeviceID    string
+	Start       time.Time
+	Duration    time.Duration
+	RequestedML float64
+	DeliveredML float64
+	Metered     bool
+}
+
+// FlowCalibration converts between pump on-time, flow-meter pulses and volume.
+type FlowCalibration struct {
+	MLPerSecond float64 `json:"ml_per_second"`
+	MLPerPulse  float64 `json:"ml_per_pulse"`
+}
+
+func (c FlowCalibration) Validate() error {
+	if c.MLPerSecond <= 0 {
+		return fmt.Errorf("ml_per_second must be positive, got %g", c.MLPerSecond)
+	}
+	if c.MLPerPulse < 0 {
+		return fmt.Errorf("ml_per_pulse must not be negative, got %g", c.MLPerPulse)
+	}
+	return nil
+}
+
+// DurationFor returns the on-time needed to deliver volumeML.
+func (c FlowCalibration) DurationFor(volumeML float64) time.Duration {
+	return time.Duration(volumeML / c.MLPerSecond * float64(time.Second))
+}
+
+func (run PumpRun) End() time.Time {
+	return run.Start.Add(run.Duration)
+}
+
+// PumpState keeps the runs of the last 24 h and the tank level switch of
+// every device, which the pump interlocks are checked against.
+type PumpState struct {
+	mutex           sync.RWMutex
+	runs            []PumpRun
+	tankLow         map[string]bool
+	flowCalibration map[string]FlowCalibration
+}
+
+func NewPumpState() *PumpState {
+	return &PumpState{tankLow: make(map[string]bool), flowCalibration: make(map[string]FlowCalibration)}
+}
+
+func (state *PumpState) GetFlowCalibration(deviceID string) (FlowCalibration, bool) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	c, ok := state.flowCalibration[deviceID]
+	return c, ok
+}
+
+func (state *PumpState) SetFlowCalibration(deviceID string, c FlowCalibration) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.flowCalibration[deviceID] = c
+}
+
+// Finish ends the latest run at now (or keeps its planned end when that is
+// earlier) and estimates the delivered volume of unmetered runs.
+func (state *PumpState) Finish(now time.Time) (PumpRun, bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if len(state.runs) == 0 {
+		return PumpRun{}, false
+	}
+	last := &state.runs[len(state.runs)-1]
+	if now.After(last.Start) && now.Before(last.End()) {
+		last.Duration = now.Sub(last.Start)
+	}
+	if c, ok := state.flowCalibration[last.DeviceID]; ok && !last.Metered {
+		last.DeliveredML = last.Duration.Seconds() * c.MLPerSecond
+	}
+	return *last, true
+}
+
+// AddPulses adds flow-meter pulses reported by deviceID to the latest run if
+// it is that device's run and was still running within maxLag. It returns the
+// updated run and whether its requested volume has been reached.
+func (state *PumpState) AddPulses(deviceID string, now time.Time, pulses int64, maxLag time.Duration) (PumpRun, bool, bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if len(state.runs) == 0 || pulses <= 0 {
+		return PumpRun{}, false, false
+	}
+	last := &state.runs[len(state.runs)-1]
+	if last.DeviceID != deviceID {
+		return PumpRun{}, false, false
+	}
+	c, ok := state.flowCalibration[last.DeviceID]
+	if !ok || c.MLPerPulse <= 0 || now.Sub(last.End()) > maxLag {
+		return PumpRun{}, false, false
+	}
+
+	last.Metered = true
+	last.DeliveredML += float64(pulses) * c.MLPerPulse
+	reached := last.RequestedML > 0 && last.DeliveredML >= last.RequestedML
+	return *last, true, reached
+}
+
+func (state *PumpState) Record(run PumpRun) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.runs = append(state.runs, run)
+	cutoff := run.Start.Add(-PumpRuntimeWindow)
+	for len(state.runs) > 0 && state.runs[0].End().Before(cutoff) {
+		state.runs = state.runs[1:]
+	}
+}
+
+// RuntimeSince sums the runtime of all runs that overlap [since, now].
+func (state *PumpState) RuntimeSince(since time.Time) time.Duration {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	var total time.Duration
+	for _, run := range state.runs {
+		start, end := run.Start, run.End()
+		if end.Before(since) {
+			continue
+		}
+		if start.Before(since) {
+			start = since
+		}
+		total += end.Sub(start)
+	}
+	return total
+}
+
+func (state *PumpState) LastRun() (PumpRun, bool) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	if len(state.runs) == 0 {
+		return PumpRun{}, false
+	}
+	return state.runs[len(state.runs)-1], true
+}
+
+func (state *PumpState) SetTankLow(deviceID string, tankLow bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.tankLow[deviceID] = tankLow
+}
+
+func (state *PumpState) TankLow(deviceID string) bool {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	return state.tankLow[deviceID]
+}
@@ -0,0 +1,256 @@
+package state
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RecipeDateLayout is the layout of the start date of a recipe assignment, a
+// calendar day of the server time zone.
+const RecipeDateLayout = "2006-01-02"
+
+// GrowthStage holds the targets of one stage of a crop recipe, for example
+// "germination". The temperature set-point follows the photoperiod: day while
+// the lights are scheduled on, night otherwise. Below moisture_min the pump
+// waters automatically, moisture_max is the pump ceiling, capped by the
+// configured one. The fan runs in proportion to the humidity between
+// humidity_min and humidity_max.
+type GrowthStage struct {
+	Name               string  `json:"name"`
+	DurationDays       int     `json:"duration_days"`
+	TemperatureDaySP   float64 `json:"temp_sp_day"`
+	TemperatureNightSP float64 `json:"temp_sp_night"`
+	HumidityMin        float64 `json:"humidity_min"`
+	HumidityMax        float64 `json:"humidity_max"`
+	MoistureMin        float64 `json:"moisture_min"`
+	MoistureMax        float64 `json:"moisture_max"`
+	PhotoperiodHours   float64 `json:"photoperiod_hours"`
+}
+
+// Validate checks the stage on its own; the configured temp_sp range is
+// checked by the service.
+func (s GrowthStage) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("stage name must not be empty")
+	}
+	for _, value := range []float64{s.TemperatureDaySP, s.TemperatureNightSP, s.HumidityMin, s.HumidityMax,
+		s.MoistureMin, s.MoistureMax, s.PhotoperiodHours} {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("stage %s contains a value that is not a finite number", s.Name)
+		}
+	}
+	if s.DurationDays < 1 {
+		return fmt.Errorf("stage %s: duration_days must be at least 1, got %d", s.Name, s.DurationDays)
+	}
+	if s.HumidityMin < 0 || s.HumidityMax > 100 || s.HumidityMin >= s.HumidityMax {
+		return fmt.Errorf("stage %s: humidity band [%g, %g] must lie within 0-100 with min below max",
+			s.Name, s.HumidityMin, s.HumidityMax)
+	}
+	if s.MoistureMin < 0 || s.MoistureMax > 100 || s.MoistureMin >= s.MoistureMax {
+		return fmt.Errorf("stage %s: moisture thresholds [%g, %g] must lie within 0-100 with min below max",
+			s.Name, s.MoistureMin, s.MoistureMax)
+	}
+	if s.PhotoperiodHours <= 0 || s.PhotoperiodHours >= 24 {
+		return fmt.Errorf("stage %s: photoperiod_hours must be between 0 and 24 exclusive, got %g", s.Name, s.PhotoperiodHours)
+	}
+	return nil
+}
+
+// CropRecipe is a named sequence of growth stages that run one after the
+// other from the start date of an assignment.
+type CropRecipe struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Stages      []GrowthStage `json:"stages"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+func (r CropRecipe) Validate() error {
+	if !tunePresetNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("name %q must be 1-64 lower-case letters, digits, '-' or '_'", r.Name)
+	}
+	if len(r.Stages) == 0 {
+		return fmt.Errorf("recipe %s needs at least one stage", r.Name)
+	}
+	seen := make(map[string]bool, len(r.Stages))
+	for _, stage := range r.Stages {
+		if err := stage.Validate(); err != nil {
+			return err
+		}
+		if seen[stage.Name] {
+			return fmt.Errorf("stage %s is listed more than once", stage.Name)
+		}
+		seen[stage.Name] = true
+	}
+	return nil
+}
+
+// StageIndex returns the position of the named stage.
+func (r CropRecipe) StageIndex(name string) (int, bool) {
+	for i, stage := range r.Stages {
+		if stage.Name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// StageAt returns the stage that is due at now for a recipe started at start,
+// with the time it began and ends. Before start index is -1; after the last
+// stage has ended it stays the last stage and finished is set.
+func (r CropRecipe) StageAt(start time.Time, now time.Time) (index int, from time.Time, to time.Time, finished bool) {
+	if now.Before(start) {
+		return -1, time.Time{}, start, false
+	}
+	from = start
+	for i, stage := range r.Stages {
+		to = from.AddDate(0, 0, stage.DurationDays)
+		if now.Before(to) {
+			return i, from, to, false
+		}
+		if i < len(r.Stages)-1 {
+			from = to
+		}
+	}
+	return len(r.Stages) - 1, from, to, true
+}
+
+// RecipeAssignment runs a recipe on a device from StartDate. A StageOverride
+// holds the named stage until it is cleared, instead of the stage that is due.
+type RecipeAssignment struct {
+	DeviceID      string    `json:"device_id"`
+	Recipe        string    `json:"recipe"`
+	StartDate     string    `json:"start_date"`
+	StageOverride string    `json:"stage_override,omitempty"`
+	AssignedAt    time.Time `json:"assigned_at"`
+}
+
+// Start is midnight of the start date in the server time zone.
+func (a RecipeAssignment) Start() (time.Time, error) {
+	start, err := time.ParseInLocation(RecipeDateLayout, a.StartDate, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("start_date [%s] is not a YYYY-MM-DD date", a.StartDate)
+	}
+	return start, nil
+}
+
+// RecipeState holds the recipes, the assignment of each device and the
+// targets last applied for it, so the periodic evaluation only pushes
+// targets when the stage or the day/night period changes.
+type RecipeState struct {
+	mutex       sync.RWMutex
+	recipes     map[string]CropRecipe
+	assignments map[string]RecipeAssignment
+	applied     map[string]string
+}
+
+func NewRecipeState() *RecipeState {
+	return &RecipeState{
+		recipes:     make(map[string]CropRecipe),
+		assignments: make(map[string]RecipeAssignment),
+		applied:     make(map[string]string),
+	}
+}
+
+func (state *RecipeState) Get(name string) (CropRecipe, bool) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	recipe, ok := state.recipes[name]
+	return recipe, ok
+}
+
+// GetAll returns the recipes sorted by name.
+func (state *RecipeState) GetAll() []CropRecipe {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	recipes := make([]CropRecipe, 0, len(state.recipes))
+	for _, recipe := range state.recipes {
+		recipes = append(recipes, recipe)
+	}
+	sort.Slice(recipes, func(i, j int) bool { return recipes[i].Name < recipes[j].Name })
+	return recipes
+}
+
+// Set stores the recipe and makes the devices running it apply its targets
+// again.
+func (state *RecipeState) Set(recipe CropRecipe) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.recipes[recipe.Name] = recipe
+	for deviceID, assignment := range state.assignments {
+		if assignment.Recipe == recipe.Name {
+			delete(state.applied, deviceID)
+		}
+	}
+}
+
+func (state *RecipeState) Delete(name string) bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	_, ok := state.recipes[name]
+	delete(state.recipes, name)
+	return ok
+}
+
+func (state *RecipeState) GetAssignment(deviceID string) (RecipeAssignment, bool) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	assignment, ok := state.assignments[deviceID]
+	return assignment, ok
+}
+
+// GetAssignments returns the assignments sorted by device.
+func (state *RecipeState) GetAssignments() []RecipeAssignment {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	assignments := make([]RecipeAssignment, 0, len(state.assignments))
+	for _, assignment := range state.assignments {
+		assignments = append(assignments, assignment)
+	}
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].DeviceID < assignments[j].DeviceID })
+	return assignments
+}
+
+func (state *RecipeState) SetAssignment(assignment RecipeAssignment) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.assignments[assignment.DeviceID] = assignment
+	delete(state.applied, assignment.DeviceID)
+}
+
+func (state *RecipeState) DeleteAssignment(deviceID string) bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	_, ok := state.assignments[deviceID]
+	delete(state.assignments, deviceID)
+	delete(state.applied, deviceID)
+	return ok
+}
+
+// IsApplied reports whether key identifies the targets last applied for the
+// device.
+func (state *RecipeState) IsApplied(deviceID string, key string) bool {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	return state.applied[deviceID] == key
+}
+
+// MarkApplied records key as the targets applied for the device.
+func (state *RecipeState) MarkApplied(deviceID string, key string) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.applied[deviceID] = key
+}
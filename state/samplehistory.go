@@ -0,0 +1,81 @@
+package state
+
+import "sync"
+
+type SampleQuality string
+
+const (
+	QualityGood       SampleQuality = "good"
+	QualityMissing    SampleQuality = "missing"
+	QualityInvalid    SampleQuality = "invalid"
+	QualityOutOfRange SampleQuality = "out_of_range"
+	QualitySpike      SampleQuality = "spike"
+	QualityUnknown    SampleQuality = "unknown_variable"
+)
+
+func (q SampleQuality) IsGood() bool {
+	return q == QualityGood
+}
+
+type SampleHistory struct {
+	mutex     sync.RWMutex
+	size      int
+	valueMap  map[deviceVariableKey][]float64
+	spikeRuns map[deviceVariableKey]int
+}
+
+func NewSampleHistory(size int) *SampleHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &SampleHistory{
+		size:      size,
+		valueMap:  make(map[deviceVariableKey][]float64),
+		spikeRuns: make(map[deviceVariableKey]int),
+	}
+}
+
+// Median returns the median of the recently accepted values of a device's variable,
+// ok is false while no value has been accepted yet.
+func (h *SampleHistory) Median(deviceID string, variable ConditionVariable) (float64, bool) {
+	key := deviceVariableKey{deviceID, variable}
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	values := h.valueMap[key]
+	if len(values) == 0 {
+		return 0, false
+	}
+
+	return median(values), true
+}
+
+func (h *SampleHistory) Accept(deviceID string, variable ConditionVariable, value float64) {
+	key := deviceVariableKey{deviceID, variable}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.spikeRuns[key] = 0
+	values := append(h.valueMap[key], value)
+	if len(values) > h.size {
+		values = values[len(values)-h.size:]
+	}
+	h.valueMap[key] = values
+}
+
+// RecordSpike counts consecutive spikes of a variable. Once a full history
+// worth of samples agrees on the new level the history is reset, so a real
+// step change is accepted instead of being rejected forever.
+func (h *SampleHistory) RecordSpike(deviceID string, variable ConditionVariable) (reset bool) {
+	key := deviceVariableKey{deviceID, variable}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.spikeRuns[key]++
+	if h.spikeRuns[key] >= h.size {
+		h.spikeRuns[key] = 0
+		delete(h.valueMap, key)
+		return true
+	}
+	return false
+}
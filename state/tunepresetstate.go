@@ -0,0 +1,91 @@
+package state
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+var tunePresetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// TunePreset is a named set of temperature loop settings, for example
+// "seedling-winter". Applying it sets the gains, the temp_co limits and temp_sp.
+type TunePreset struct {
+	Name             string    `json:"name"`
+	Description      string    `json:"description,omitempty"`
+	ProportionalGain float64   `json:"temp_kp"`
+	IntegralGain     float64   `json:"temp_ki"`
+	DerivativeGain   float64   `json:"temp_kd"`
+	OutputMin        float64   `json:"temp_co_min"`
+	OutputMax        float64   `json:"temp_co_max"`
+	SetPoint         float64   `json:"temp_sp"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Validate checks the preset on its own; the configured temp_sp and temp_co
+// ranges are checked by the service.
+func (p TunePreset) Validate() error {
+	if !tunePresetNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("name %q must be 1-64 lower-case letters, digits, '-' or '_'", p.Name)
+	}
+	for _, value := range []float64{p.ProportionalGain, p.IntegralGain, p.DerivativeGain, p.OutputMin, p.OutputMax, p.SetPoint} {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("preset %s contains a value that is not a finite number", p.Name)
+		}
+	}
+	if p.OutputMin >= p.OutputMax {
+		return fmt.Errorf("temp_co_min (%g) must be less than temp_co_max (%g)", p.OutputMin, p.OutputMax)
+	}
+	return nil
+}
+
+type TunePresetState struct {
+	mutex   sync.RWMutex
+	presets map[string]TunePreset
+}
+
+func NewTunePresetState() *TunePresetState {
+	return &TunePresetState{
+		presets: make(map[string]TunePreset),
+	}
+}
+
+func (state *TunePresetState) Get(name string) (TunePreset, bool) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	preset, ok := state.presets[name]
+	return preset, ok
+}
+
+// GetAll returns the presets sorted by name.
+func (state *TunePresetState) GetAll() []TunePreset {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	presets := make([]TunePreset, 0, len(state.presets))
+	for _, preset := range state.presets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets
+}
+
+func (state *TunePresetState) Set(preset TunePreset) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.presets[preset.Name] = preset
+}
+
+func (state *TunePresetState) Delete(name string) bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	_, ok := state.presets[name]
+	delete(state.presets, name)
+	return ok
+}
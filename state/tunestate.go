@@ -10,9 +10,13 @@ const (
 	TemperatureKi TuneVariable = "temp_ki"
 )
 
+// TuneState holds the temperature PID gains and the output limits temp_co is
+// clamped to; the limits start at the configured temp-co-min/max.
 type TuneState struct {
-	mutex    sync.RWMutex
-	valueMap map[TuneVariable]float64
+	mutex     sync.RWMutex
+	valueMap  map[TuneVariable]float64
+	outputMin float64
+	outputMax float64
 }
 
 func NewTuneState() *TuneState {
@@ -39,3 +43,17 @@ func (state *TuneState) Set(variable TuneVariable, value float64) {
 
 	state.valueMap[variable] = value
 }
+
+func (state *TuneState) GetOutputLimits() (float64, float64) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	return state.outputMin, state.outputMax
+}
+
+func (state *TuneState) SetOutputLimits(min float64, max float64) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.outputMin, state.outputMax = min, max
+}
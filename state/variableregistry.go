@@ -0,0 +1,115 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+const MeasurementTable = "measurement"
+
+// VariableDefinition describes a measured variable. Variables without a
+// table are stored in the generic measurement table; only the built-in
+// variables map onto their legacy tables.
+type VariableDefinition struct {
+	Name         ConditionVariable `json:"name"`
+	Unit         string            `json:"unit"`
+	Description  string            `json:"description,omitempty"`
+	Min          float64           `json:"min"`
+	Max          float64           `json:"max"`
+	MaxStep      float64           `json:"max_step,omitempty"`
+	Controllable bool              `json:"controllable"`
+	Table        string            `json:"-"`
+}
+
+var variableNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+func (d VariableDefinition) Validate() error {
+	if !variableNamePattern.MatchString(string(d.Name)) {
+		return fmt.Errorf("variable name [%s] must match %s", d.Name, variableNamePattern)
+	}
+	if d.Min >= d.Max {
+		return fmt.Errorf("variable %s: min (%g) must be less than max (%g)", d.Name, d.Min, d.Max)
+	}
+	if d.MaxStep < 0 {
+		return fmt.Errorf("variable %s: max_step must not be negative", d.Name)
+	}
+	return nil
+}
+
+func (d VariableDefinition) StorageTable() string {
+	if d.Table == "" {
+		return MeasurementTable
+	}
+	return d.Table
+}
+
+type VariableRegistry struct {
+	mutex         sync.RWMutex
+	definitionMap map[ConditionVariable]VariableDefinition
+}
+
+func NewVariableRegistry() *VariableRegistry {
+	return &VariableRegistry{
+		definitionMap: make(map[ConditionVariable]VariableDefinition),
+	}
+}
+
+func (registry *VariableRegistry) Register(definition VariableDefinition) error {
+	if err := definition.Validate(); err != nil {
+		return err
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if existing, ok := registry.definitionMap[definition.Name]; ok && existing.Table != "" {
+		definition.Table = existing.Table
+	}
+	registry.definitionMap[definition.Name] = definition
+	return nil
+}
+
+func (registry *VariableRegistry) Get(name ConditionVariable) (VariableDefinition, bool) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	definition, ok := registry.definitionMap[name]
+	return definition, ok
+}
+
+func (registry *VariableRegistry) GetAll() []VariableDefinition {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	definitions := make([]VariableDefinition, 0, len(registry.definitionMap))
+	for _, definition := range registry.definitionMap {
+		definitions = append(definitions, definition)
+	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Name < definitions[j].Name })
+	return definitions
+}
+
+// LoadFile registers the variables of a JSON array file. Definitions of
+// built-in variables override their ranges but keep their legacy table.
+func (registry *VariableRegistry) LoadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read variables file: %w", err)
+	}
+
+	var definitions []VariableDefinition
+	if err := json.Unmarshal(content, &definitions); err != nil {
+		return fmt.Errorf("%s is not a valid JSON array of variables: %w", path, err)
+	}
+
+	for _, definition := range definitions {
+		if err := registry.Register(definition); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
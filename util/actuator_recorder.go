@@ -0,0 +1,55 @@
+package util
+
+import (
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/state"
+	"time"
+)
+
+// ActuatorRecorder stores every actuator transition together with what caused
+// it. Each stored transition is closed with its duration by the next one of
+// the same actuator on the same device.
+type ActuatorRecorder struct {
+	actuatorState *state.ActuatorState
+}
+
+func NewActuatorRecorder(actuatorState *state.ActuatorState) *ActuatorRecorder {
+	return &ActuatorRecorder{actuatorState: actuatorState}
+}
+
+// Switch records an on/off actuator as 1 or 0.
+func (r *ActuatorRecorder) Switch(deviceID string, actuator state.DeviceControlVariable, on bool, source state.ActuatorSource) {
+	value := 0.0
+	if on {
+		value = 1
+	}
+	r.record(state.ActuatorTransition{DeviceID: deviceID, Actuator: actuator, Value: value, Source: source, Time: time.Now()}, 0)
+}
+
+// Duty records an analog actuator; changes below state.ActuatorDutyDeadband
+// are skipped unless the actuator switches on or off.
+func (r *ActuatorRecorder) Duty(deviceID string, actuator state.DeviceControlVariable, duty float64, source state.ActuatorSource) {
+	r.record(state.ActuatorTransition{DeviceID: deviceID, Actuator: actuator, Value: duty, Source: source, Time: time.Now()},
+		state.ActuatorDutyDeadband)
+}
+
+func (r *ActuatorRecorder) record(transition state.ActuatorTransition, deadband float64) {
+	var log = logger.Logger()
+
+	previous, ok, changed := r.actuatorState.Change(transition, deadband)
+	if !changed {
+		return
+	}
+	if ok {
+		previousEntity := dao.ActuatorEventEntity{Transition: previous}
+		if err := previousEntity.Close(transition.Time); err != nil {
+			log.Errorf("[ERROR] util.ActuatorRecorder | failed to close actuator event entity: %s", err.Error())
+		}
+	}
+	entity := dao.ActuatorEventEntity{Transition: transition}
+	if err := entity.Commit(); err != nil {
+		log.Errorf("[ERROR] util.ActuatorRecorder | failed to commit actuator event entity: %s", err.Error())
+	}
+	log.Debugf("[DEBUG] util.ActuatorRecorder | %s -> %g (%s)", transition.Actuator, transition.Value, transition.Source)
+}
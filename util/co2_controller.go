@@ -0,0 +1,21 @@
+package util
+
+import "fmt"
+
+// EvaluateCO2Enrichment is an on/off controller with a switching band of
+// hysteresis around the set-point. Enrichment is only allowed while the lights
+// are on and the fan is off, otherwise bottled CO2 is wasted.
+func EvaluateCO2Enrichment(pv float64, sp float64, hysteresis float64, valveOpen bool, lightsOn bool, fanOn bool) (bool, string) {
+	switch {
+	case !lightsOn:
+		return false, "lights are off"
+	case fanOn:
+		return false, "fan is running"
+	case pv < sp-hysteresis/2:
+		return true, fmt.Sprintf("co2 %.0f ppm below set-point %.0f ppm", pv, sp)
+	case pv >= sp+hysteresis/2:
+		return false, fmt.Sprintf("co2 %.0f ppm reached set-point %.0f ppm", pv, sp)
+	default:
+		return valveOpen, fmt.Sprintf("co2 %.0f ppm inside switching band", pv)
+	}
+}
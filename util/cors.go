@@ -1,10 +1,19 @@
 package util
 
-import "net/http"
+import (
+	"Solflora/config"
+	"net/http"
+	"slices"
+)
 
 func WithCors(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if origin := allowedOrigin(r.Header.Get("Origin")); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if origin != "*" {
+				w.Header().Add("Vary", "Origin")
+			}
+		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
@@ -16,3 +25,14 @@ func WithCors(handler http.HandlerFunc) http.HandlerFunc {
 		handler(w, r)
 	}
 }
+
+func allowedOrigin(origin string) string {
+	origins := config.Get().Server.CorsOrigins
+	if slices.Contains(origins, "*") {
+		return "*"
+	}
+	if origin != "" && slices.Contains(origins, origin) {
+		return origin
+	}
+	return ""
+}
@@ -0,0 +1,20 @@
+package util
+
+// ProportionalFanDuty maps pv linearly from minDuty at start to maxDuty at
+// full. Below start the fan is off.
+func ProportionalFanDuty(pv float64, start float64, full float64, minDuty float64, maxDuty float64) float64 {
+	if pv < start {
+		return 0
+	}
+	fraction := Clamp((pv-start)/(full-start), 0, 1)
+	return minDuty + fraction*(maxDuty-minDuty)
+}
+
+// LimitFanDuty keeps a running fan between minDuty and maxDuty, since most fans
+// stall below a minimum PWM duty. A duty of zero switches the fan off.
+func LimitFanDuty(duty float64, minDuty float64, maxDuty float64) float64 {
+	if duty <= 0 {
+		return 0
+	}
+	return Clamp(duty, minDuty, maxDuty)
+}
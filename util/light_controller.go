@@ -0,0 +1,34 @@
+package util
+
+import (
+	"Solflora/state"
+	"fmt"
+	"time"
+)
+
+// EvaluateLights decides the grow light state for the automatic light modes.
+// naturalPPFD is the measured PPFD without the contribution of the lamps.
+func EvaluateLights(now time.Time, schedule state.LightSchedule, dli float64, naturalPPFD float64) (bool, string) {
+	start, end := schedule.Window(now)
+	inWindow := !now.Before(start) && now.Before(end)
+	if !inWindow {
+		return false, fmt.Sprintf("outside photoperiod %s-%s", schedule.OnAt, schedule.OffAt)
+	}
+
+	if schedule.Mode != state.LightModeSupplement {
+		return true, fmt.Sprintf("inside photoperiod %s-%s", schedule.OnAt, schedule.OffAt)
+	}
+
+	if naturalPPFD < 0 {
+		naturalPPFD = 0
+	}
+	projected := dli + naturalPPFD*end.Sub(now).Seconds()/1e6
+	if projected < schedule.DLITarget {
+		return true, fmt.Sprintf("projected DLI %.2f below target %.2f", projected, schedule.DLITarget)
+	}
+	return false, fmt.Sprintf("projected DLI %.2f reaches target %.2f", projected, schedule.DLITarget)
+}
+
+func LuxToPPFD(lux float64, factor float64) float64 {
+	return lux * factor
+}
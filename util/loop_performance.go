@@ -0,0 +1,266 @@
+package util
+
+import (
+	"math"
+	"time"
+)
+
+// LoopSample is one stored control step of the temperature loop.
+type LoopSample struct {
+	Time             time.Time
+	PresentValue     float64
+	SetPoint         float64
+	ControllerOutput float64
+}
+
+// LoopPerformanceOptions configures AnalyzeLoop. Samples further apart than
+// MaxGap are treated as a data hole and not integrated. The error has to
+// stay within SettlingBand for a step to count as settled.
+type LoopPerformanceOptions struct {
+	OutputMin    float64
+	OutputMax    float64
+	SettlingBand float64
+	MaxGap       time.Duration
+}
+
+// StepResponse describes how the loop followed one setpoint change.
+// SettlingSeconds is nil when the error never stayed inside the band before
+// the next change or the end of the window.
+type StepResponse struct {
+	Time             time.Time `json:"time"`
+	From             float64   `json:"from"`
+	To               float64   `json:"to"`
+	OvershootPercent float64   `json:"overshoot_percent"`
+	SettlingSeconds  *float64  `json:"settling_seconds"`
+}
+
+// Oscillation is detected when the error keeps crossing zero outside the
+// settling band with peaks that do not decay.
+type Oscillation struct {
+	Detected      bool    `json:"detected"`
+	ZeroCrossings int     `json:"zero_crossings"`
+	PeriodSeconds float64 `json:"period_seconds,omitempty"`
+	Amplitude     float64 `json:"amplitude,omitempty"`
+}
+
+// LoopPerformance holds the error integrals (error = sp - pv, time in seconds)
+// and the step, saturation and oscillation figures of a run of samples.
+// ITAE weights the error with the time since the last setpoint change, or
+// since the first sample before any change.
+type LoopPerformance struct {
+	Samples           int            `json:"samples"`
+	DurationSeconds   float64        `json:"duration_seconds"`
+	IAE               float64        `json:"iae"`
+	ISE               float64        `json:"ise"`
+	ITAE              float64        `json:"itae"`
+	SteadyStateError  *float64       `json:"steady_state_error"`
+	SaturationPercent float64        `json:"saturation_percent"`
+	Steps             []StepResponse `json:"steps"`
+	MaxOvershoot      float64        `json:"max_overshoot_percent"`
+	MeanSettling      *float64       `json:"mean_settling_seconds"`
+	Oscillation       Oscillation    `json:"oscillation"`
+}
+
+// minOscillationCrossings is the number of zero crossings (two full cycles)
+// before an oscillation is reported; minOscillationDecay is the smallest
+// ratio of late to early peak amplitude that still counts as sustained.
+const (
+	minOscillationCrossings = 4
+	minOscillationDecay     = 0.8
+)
+
+// AnalyzeLoop computes the performance figures of samples ordered by time.
+func AnalyzeLoop(samples []LoopSample, options LoopPerformanceOptions) LoopPerformance {
+	result := LoopPerformance{Samples: len(samples), Steps: []StepResponse{}}
+	if len(samples) < 2 {
+		return result
+	}
+
+	var saturated float64
+	for i := 1; i < len(samples); i++ {
+		dt := samples[i].Time.Sub(samples[i-1].Time)
+		if dt <= 0 || dt > options.MaxGap {
+			continue
+		}
+		seconds := dt.Seconds()
+		result.DurationSeconds += seconds
+		if samples[i].ControllerOutput <= options.OutputMin || samples[i].ControllerOutput >= options.OutputMax {
+			saturated += seconds
+		}
+	}
+	if result.DurationSeconds > 0 {
+		result.SaturationPercent = saturated / result.DurationSeconds * 100
+	}
+
+	var steadyErr, steadyTime, settlingSum float64
+	var settled int
+	for _, segment := range splitBySetPoint(samples) {
+		analyzeSegment(segment, options, &result)
+
+		// steady state is judged on the last quarter of each constant setpoint
+		start, end := segment.samples[0].Time, segment.samples[len(segment.samples)-1].Time
+		tail := start.Add(end.Sub(start) * 3 / 4)
+		for i := 1; i < len(segment.samples); i++ {
+			dt := segment.samples[i].Time.Sub(segment.samples[i-1].Time)
+			if segment.samples[i].Time.Before(tail) || dt <= 0 || dt > options.MaxGap {
+				continue
+			}
+			steadyErr += (segment.samples[i].SetPoint - segment.samples[i].PresentValue) * dt.Seconds()
+			steadyTime += dt.Seconds()
+		}
+	}
+	if steadyTime > 0 {
+		steadyState := steadyErr / steadyTime
+		result.SteadyStateError = &steadyState
+	}
+
+	for _, step := range result.Steps {
+		result.MaxOvershoot = math.Max(result.MaxOvershoot, step.OvershootPercent)
+		if step.SettlingSeconds != nil {
+			settlingSum += *step.SettlingSeconds
+			settled++
+		}
+	}
+	if settled > 0 {
+		meanSettling := settlingSum / float64(settled)
+		result.MeanSettling = &meanSettling
+	}
+	return result
+}
+
+// setPointSegment is a run of samples with a constant setpoint; step is set
+// when the run starts with a setpoint change from previous.
+type setPointSegment struct {
+	samples  []LoopSample
+	step     bool
+	previous float64
+}
+
+func splitBySetPoint(samples []LoopSample) []setPointSegment {
+	var segments []setPointSegment
+	current := setPointSegment{}
+	start := 0
+	for i := 1; i < len(samples); i++ {
+		if samples[i].SetPoint != samples[i-1].SetPoint {
+			current.samples = samples[start:i]
+			segments = append(segments, current)
+			current = setPointSegment{step: true, previous: samples[i-1].SetPoint}
+			start = i
+		}
+	}
+	current.samples = samples[start:]
+	return append(segments, current)
+}
+
+func analyzeSegment(segment setPointSegment, options LoopPerformanceOptions, result *LoopPerformance) {
+	samples := segment.samples
+	origin := samples[0].Time
+	for i := 1; i < len(samples); i++ {
+		dt := samples[i].Time.Sub(samples[i-1].Time)
+		if dt <= 0 || dt > options.MaxGap {
+			continue
+		}
+		e := samples[i].SetPoint - samples[i].PresentValue
+		seconds := dt.Seconds()
+		result.IAE += math.Abs(e) * seconds
+		result.ISE += e * e * seconds
+		result.ITAE += samples[i].Time.Sub(origin).Seconds() * math.Abs(e) * seconds
+	}
+
+	if segment.step {
+		result.Steps = append(result.Steps, stepResponse(segment, options))
+	}
+	mergeOscillation(&result.Oscillation, detectOscillation(samples, options))
+}
+
+// stepResponse measures the overshoot past the new setpoint relative to the
+// step size and the time until the error enters the settling band for good.
+func stepResponse(segment setPointSegment, options LoopPerformanceOptions) StepResponse {
+	samples := segment.samples
+	first := samples[0]
+	step := StepResponse{Time: first.Time, From: segment.previous, To: first.SetPoint}
+
+	direction := 1.0
+	if step.To < step.From {
+		direction = -1
+	}
+	var overshoot float64
+	settledAt := -1
+	for i, sample := range samples {
+		overshoot = math.Max(overshoot, (sample.PresentValue-sample.SetPoint)*direction)
+		inBand := math.Abs(sample.SetPoint-sample.PresentValue) <= options.SettlingBand
+		if !inBand {
+			settledAt = -1
+		} else if settledAt < 0 {
+			settledAt = i
+		}
+	}
+	if size := math.Abs(step.To - step.From); size > 0 {
+		step.OvershootPercent = overshoot / size * 100
+	}
+	if settledAt >= 0 {
+		settling := samples[settledAt].Time.Sub(first.Time).Seconds()
+		step.SettlingSeconds = &settling
+	}
+	return step
+}
+
+// detectOscillation counts the zero crossings of the error, ignoring the
+// settling band around zero, and compares the early and late half-cycle peaks.
+func detectOscillation(samples []LoopSample, options LoopPerformanceOptions) Oscillation {
+	var result Oscillation
+	var crossings []time.Time
+	var peaks []float64
+	sign, peak := 0, 0.0
+	for _, sample := range samples {
+		e := sample.SetPoint - sample.PresentValue
+		if math.Abs(e) <= options.SettlingBand {
+			continue
+		}
+		current := 1
+		if e < 0 {
+			current = -1
+		}
+		if sign != 0 && current != sign {
+			crossings = append(crossings, sample.Time)
+			peaks = append(peaks, peak)
+			peak = 0
+		}
+		sign = current
+		peak = math.Max(peak, math.Abs(e))
+	}
+
+	result.ZeroCrossings = len(crossings)
+	if len(crossings) < minOscillationCrossings {
+		return result
+	}
+	result.PeriodSeconds = 2 * crossings[len(crossings)-1].Sub(crossings[0]).Seconds() / float64(len(crossings)-1)
+	// the first peak belongs to the approach, not to a full half cycle
+	peaks = peaks[1:]
+	half := len(peaks) / 2
+	early, late := mean(peaks[:half]), mean(peaks[half:])
+	result.Amplitude = mean(peaks)
+	result.Detected = early > 0 && late/early >= minOscillationDecay
+	return result
+}
+
+// mergeOscillation combines the results of several setpoint segments; the
+// period and amplitude are taken from the segment with the most crossings.
+func mergeOscillation(total *Oscillation, segment Oscillation) {
+	if segment.ZeroCrossings > total.ZeroCrossings {
+		total.PeriodSeconds, total.Amplitude = segment.PeriodSeconds, segment.Amplitude
+	}
+	total.ZeroCrossings += segment.ZeroCrossings
+	total.Detected = total.Detected || segment.Detected
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
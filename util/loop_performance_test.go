@@ -0,0 +1,139 @@
+package util
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var loopTestStart = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// loopSamples builds samples 10 s apart; co defaults to 50 when nil.
+func loopSamples(sp []float64, pv []float64, co []float64) []LoopSample {
+	samples := make([]LoopSample, len(pv))
+	for i := range pv {
+		samples[i] = LoopSample{
+			Time:             loopTestStart.Add(time.Duration(i) * 10 * time.Second),
+			PresentValue:     pv[i],
+			SetPoint:         sp[i],
+			ControllerOutput: 50,
+		}
+		if co != nil {
+			samples[i].ControllerOutput = co[i]
+		}
+	}
+	return samples
+}
+
+func constant(value float64, n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
+
+func TestAnalyzeLoop(t *testing.T) {
+	options := LoopPerformanceOptions{OutputMin: 0, OutputMax: 100, SettlingBand: 0.5, MaxGap: time.Minute}
+
+	gap := loopSamples(constant(20, 5), constant(19, 5), nil)
+	for i := 3; i < len(gap); i++ {
+		gap[i].Time = gap[i].Time.Add(10 * time.Minute)
+	}
+
+	settling := 20.0
+	tests := []struct {
+		name            string
+		samples         []LoopSample
+		wantIAE         float64
+		wantSaturation  float64
+		wantSteps       int
+		wantOvershoot   float64
+		wantSettling    *float64
+		wantOscillation bool
+		wantCrossings   int
+	}{
+		{
+			name:    "constant error",
+			samples: loopSamples(constant(20, 7), constant(19, 7), nil),
+			wantIAE: 60,
+		},
+		{
+			name:    "gap is not integrated",
+			samples: gap,
+			wantIAE: 30,
+		},
+		{
+			name: "output saturation",
+			samples: loopSamples(constant(20, 5), constant(20, 5),
+				[]float64{50, 100, 100, 50, 50}),
+			wantSaturation: 50,
+		},
+		{
+			name: "step with overshoot and settling",
+			samples: loopSamples([]float64{20, 22, 22, 22, 22, 22, 22},
+				[]float64{20, 20, 21, 22.5, 22.2, 22, 22}, nil),
+			wantIAE:       17,
+			wantSteps:     1,
+			wantOvershoot: 25,
+			wantSettling:  &settling,
+		},
+		{
+			name: "sustained oscillation",
+			samples: loopSamples(constant(20, 10),
+				[]float64{22, 18, 22, 18, 22, 18, 22, 18, 22, 18}, nil),
+			wantIAE:         180,
+			wantOscillation: true,
+			wantCrossings:   9,
+		},
+		{
+			name: "decaying oscillation",
+			samples: loopSamples(constant(20, 7),
+				[]float64{16, 23, 18, 21.5, 19, 20.8, 19.4}, nil),
+			wantIAE:       89,
+			wantCrossings: 6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AnalyzeLoop(tt.samples, options)
+
+			if math.Abs(got.IAE-tt.wantIAE) > 1e-9 {
+				t.Errorf("IAE = %g, want %g", got.IAE, tt.wantIAE)
+			}
+			if math.Abs(got.SaturationPercent-tt.wantSaturation) > 1e-9 {
+				t.Errorf("SaturationPercent = %g, want %g", got.SaturationPercent, tt.wantSaturation)
+			}
+			if len(got.Steps) != tt.wantSteps {
+				t.Fatalf("got %d steps, want %d", len(got.Steps), tt.wantSteps)
+			}
+			if math.Abs(got.MaxOvershoot-tt.wantOvershoot) > 1e-9 {
+				t.Errorf("MaxOvershoot = %g, want %g", got.MaxOvershoot, tt.wantOvershoot)
+			}
+			switch {
+			case tt.wantSettling == nil && got.MeanSettling != nil:
+				t.Errorf("MeanSettling = %g, want none", *got.MeanSettling)
+			case tt.wantSettling != nil && got.MeanSettling == nil:
+				t.Errorf("MeanSettling missing, want %g", *tt.wantSettling)
+			case tt.wantSettling != nil && math.Abs(*got.MeanSettling-*tt.wantSettling) > 1e-9:
+				t.Errorf("MeanSettling = %g, want %g", *got.MeanSettling, *tt.wantSettling)
+			}
+			if got.Oscillation.Detected != tt.wantOscillation {
+				t.Errorf("Oscillation.Detected = %t, want %t", got.Oscillation.Detected, tt.wantOscillation)
+			}
+			if got.Oscillation.ZeroCrossings != tt.wantCrossings {
+				t.Errorf("Oscillation.ZeroCrossings = %d, want %d", got.Oscillation.ZeroCrossings, tt.wantCrossings)
+			}
+		})
+	}
+}
+
+func TestAnalyzeLoopOscillationPeriod(t *testing.T) {
+	options := LoopPerformanceOptions{OutputMin: 0, OutputMax: 100, SettlingBand: 0.5, MaxGap: time.Minute}
+	samples := loopSamples(constant(20, 10), []float64{22, 18, 22, 18, 22, 18, 22, 18, 22, 18}, nil)
+
+	got := AnalyzeLoop(samples, options).Oscillation
+	if math.Abs(got.PeriodSeconds-20) > 1e-9 || math.Abs(got.Amplitude-2) > 1e-9 {
+		t.Fatalf("period %g s, amplitude %g, want 20 s and 2", got.PeriodSeconds, got.Amplitude)
+	}
+}
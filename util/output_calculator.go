@@ -5,7 +5,13 @@ import (
 	"Solflora/state"
 )
 
-func CalculateCO(sp float64, pv float64, integralState *state.TrackingIntegralState, tuneState *state.TuneState) float64 {
+// CalculateCO runs one step of the temperature PID. The integral is the sum of
+// the errors of all steps, so Ki acts per sample. The output is clamped to
+// [outputMin, outputMax]; while it saturates, the integral is back-calculated
+// to the value that just reaches the limit, so it does not wind up and the
+// output leaves the limit as soon as the error reverses.
+func CalculateCO(sp float64, pv float64, outputMin float64, outputMax float64,
+	integralState *state.TrackingIntegralState, tuneState *state.TuneState) float64 {
 	var log = logger.Logger()
 
 	tuneMap := tuneState.GetAll()
@@ -14,11 +20,47 @@ func CalculateCO(sp float64, pv float64, integralState *state.TrackingIntegralSt
 	kd := tuneMap[state.TemperatureKd]
 
 	pidErr := sp - pv
-	integralState.SetTrackingIntegralValue(integralState.GetTrackingIntegralValue() + pidErr)
+	previousIntegral := integralState.GetTrackingIntegralValue()
+	integral := previousIntegral + pidErr
 	derivative := pidErr - integralState.GetTrackingErrorValue()
-	output := kp*pidErr + ki*integralState.GetTrackingErrorValue() + kd*derivative
+	output := kp*pidErr + ki*integral + kd*derivative
 
+	if limited := Clamp(output, outputMin, outputMax); limited != output {
+		if ki != 0 {
+			integral = (limited - kp*pidErr - kd*derivative) / ki
+		} else {
+			integral = previousIntegral
+		}
+		output = limited
+	}
+
+	integralState.SetTrackingIntegralValue(integral)
 	integralState.SetTrackingErrorValue(pidErr)
 	log.Debugf("[DEBUG] api.esp.ControlSampler() | calculated temp_co: %.4f\n", output)
 	return output
 }
+
+func Clamp(value float64, min float64, max float64) float64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+// InitializeBumpless seeds the integral so that the next CalculateCO with the
+// same error returns co, which makes a switch to auto mode bumpless.
+func InitializeBumpless(co float64, pidErr float64, integralState *state.TrackingIntegralState, tuneState *state.TuneState) {
+	tuneMap := tuneState.GetAll()
+	kp := tuneMap[state.TemperatureKp]
+	ki := tuneMap[state.TemperatureKi]
+
+	integral := 0.0
+	if ki != 0 {
+		integral = (co-kp*pidErr)/ki - pidErr
+	}
+	integralState.SetTrackingIntegralValue(integral)
+	integralState.SetTrackingErrorValue(pidErr)
+}
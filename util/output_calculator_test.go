@@ -0,0 +1,60 @@
+package util
+
+import (
+	"Solflora/logger"
+	"Solflora/state"
+	"math"
+	"testing"
+)
+
+func newTestTuneState(kp float64, ki float64, kd float64) *state.TuneState {
+	tuneState := state.NewTuneState()
+	tuneState.Set(state.TemperatureKp, kp)
+	tuneState.Set(state.TemperatureKi, ki)
+	tuneState.Set(state.TemperatureKd, kd)
+	return tuneState
+}
+
+func TestCalculateCO(t *testing.T) {
+	logger.Init("error")
+
+	tests := []struct {
+		name       string
+		kp, ki, kd float64
+		min, max   float64
+		errors     []float64
+		want       []float64
+	}{
+		{"proportional", 2, 0, 0, -100, 100, []float64{2, -1}, []float64{4, -2}},
+		{"integral accumulates", 0, 0.5, 0, -100, 100, []float64{1, 1, 1}, []float64{0.5, 1, 1.5}},
+		{"derivative of the error", 0, 0, 1, -100, 100, []float64{1, 3, 2}, []float64{1, 2, -1}},
+		{"clamped to the output limits", 10, 0, 0, 0, 50, []float64{10, -1}, []float64{50, 0}},
+		// without anti-windup the integral would reach 25 and hold the output
+		// at the limit after the error reverses
+		{"no integral windup", 0, 1, 0, 0, 10, []float64{5, 5, 5, 5, 5, -1}, []float64{5, 10, 10, 10, 10, 9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			integralState := state.NewTrackingIntegralState()
+			tuneState := newTestTuneState(tt.kp, tt.ki, tt.kd)
+			for i, pidErr := range tt.errors {
+				got := CalculateCO(20+pidErr, 20, tt.min, tt.max, integralState, tuneState)
+				if math.Abs(got-tt.want[i]) > 1e-9 {
+					t.Fatalf("step %d: CalculateCO = %g, want %g", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestInitializeBumpless(t *testing.T) {
+	logger.Init("error")
+
+	integralState := state.NewTrackingIntegralState()
+	tuneState := newTestTuneState(1, 0.1, 0.5)
+
+	InitializeBumpless(30, 2, integralState, tuneState)
+	if got := CalculateCO(22, 20, -100, 100, integralState, tuneState); math.Abs(got-30) > 1e-9 {
+		t.Fatalf("first CalculateCO after InitializeBumpless = %g, want 30", got)
+	}
+}
@@ -0,0 +1,255 @@
+package util
+
+import (
+	"Solflora/config"
+	"Solflora/dao"
+	"Solflora/logger"
+	"Solflora/metrics"
+	"Solflora/state"
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type PumpInterlockError struct {
+	Code    state.PumpInterlockCode
+	Message string
+}
+
+func (e *PumpInterlockError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// PumpController starts and stops the water pump for operator requests and
+// automatic watering alike, so every run passes the same interlocks.
+type PumpController struct {
+	deviceState   *state.DeviceState
+	modelState    *state.ModelState
+	pumpState     *state.PumpState
+	loopState     *state.LoopState
+	recorder      *ActuatorRecorder
+	controlConfig config.ControlConfig
+
+	// runMutex serializes start, stop and timer expiry, so the database
+	// writes of one run complete before the next transition and need not
+	// hold the device state lock
+	runMutex sync.Mutex
+
+	mutex           sync.Mutex
+	lastAutoRefusal state.PumpInterlockCode
+}
+
+func NewPumpController(
+	deviceState *state.DeviceState,
+	modelState *state.ModelState,
+	pumpState *state.PumpState,
+	loopState *state.LoopState,
+	recorder *ActuatorRecorder,
+	controlConfig config.ControlConfig) *PumpController {
+	return &PumpController{
+		deviceState:   deviceState,
+		modelState:    modelState,
+		pumpState:     pumpState,
+		loopState:     loopState,
+		recorder:      recorder,
+		controlConfig: controlConfig}
+}
+
+// Start switches the pump on for run.Duration once every interlock passes. A
+// refusal is returned as *PumpInterlockError and recorded as an alarm.
+func (c *PumpController) Start(run state.PumpRun) error {
+	if err := c.start(run, state.ActuatorSourceManual); err != nil {
+		c.raiseAlarm(err)
+		return err
+	}
+	return nil
+}
+
+// StartAuto is Start for automatic watering, which retries on every sample:
+// a refusal only raises an alarm when its code differs from the last one.
+func (c *PumpController) StartAuto(run state.PumpRun) error {
+	err := c.start(run, state.ActuatorSourceAuto)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err == nil {
+		c.lastAutoRefusal = ""
+		return nil
+	}
+	if err.Code != c.lastAutoRefusal && err.Code != state.PumpMinOffTime && err.Code != state.PumpAlreadyRunning {
+		c.raiseAlarm(err)
+	}
+	c.lastAutoRefusal = err.Code
+	return err
+}
+
+func (c *PumpController) start(run state.PumpRun, source state.ActuatorSource) *PumpInterlockError {
+	var log = logger.Logger()
+
+	c.runMutex.Lock()
+	defer c.runMutex.Unlock()
+
+	c.deviceState.Mutex.Lock()
+	if err := c.checkInterlocks(run, c.deviceState.ValueMap[state.WaterPumpControl]); err != nil {
+		c.deviceState.Mutex.Unlock()
+		return err
+	}
+	c.deviceState.ValueMap[state.WaterPumpControl] = true
+	ctx, cancel := context.WithCancel(context.Background())
+	c.deviceState.CancelTimer = cancel
+	c.deviceState.Mutex.Unlock()
+
+	metrics.SetActuatorState(string(state.WaterPumpControl), true)
+	c.pumpState.Record(run)
+	runEntity := dao.PumpRunEntity{Run: run}
+	if err := runEntity.Commit(); err != nil {
+		log.Errorf("[ERROR] util.PumpController.Start | failed to commit pump run entity: %s", err.Error())
+	}
+	c.recorder.Switch(run.DeviceID, state.WaterPumpControl, true, source)
+
+	go func() {
+		select {
+		case <-time.After(run.Duration):
+			c.expire(ctx, run)
+		case <-ctx.Done():
+		}
+	}()
+
+	log.Debugf("[DEBUG] util.PumpController.Start | pump on for %s: %+v", run.Duration, run)
+	return nil
+}
+
+// expire switches the pump off when the timer of run fires. A Stop that got
+// the run mutex first has cancelled ctx, and the pump may already belong to
+// a newer run by then, so nothing is done.
+func (c *PumpController) expire(ctx context.Context, run state.PumpRun) {
+	c.runMutex.Lock()
+	defer c.runMutex.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+	c.deviceState.Mutex.Lock()
+	c.deviceState.ValueMap[state.WaterPumpControl] = false
+	c.deviceState.CancelTimer()
+	c.deviceState.CancelTimer = nil
+	c.deviceState.Mutex.Unlock()
+
+	metrics.SetActuatorState(string(state.WaterPumpControl), false)
+	c.recorder.Switch(run.DeviceID, state.WaterPumpControl, false, state.ActuatorSourceTimer)
+	c.finish()
+}
+
+// Stop switches a running pump off before its timer expires and closes the
+// current run, recording source as the cause. It returns false when the pump
+// was not running.
+func (c *PumpController) Stop(source state.ActuatorSource) bool {
+	return c.stop("", source)
+}
+
+// StopDevice is Stop for the run of deviceID only; the run of another device
+// keeps running.
+func (c *PumpController) StopDevice(deviceID string, source state.ActuatorSource) bool {
+	return c.stop(deviceID, source)
+}
+
+func (c *PumpController) stop(deviceID string, source state.ActuatorSource) bool {
+	c.runMutex.Lock()
+	defer c.runMutex.Unlock()
+
+	runDeviceID := state.DefaultDeviceID
+	if run, ok := c.pumpState.LastRun(); ok {
+		runDeviceID = run.DeviceID
+	}
+	if deviceID != "" && deviceID != runDeviceID {
+		return false
+	}
+
+	c.deviceState.Mutex.Lock()
+	running := c.deviceState.ValueMap[state.WaterPumpControl]
+	if running {
+		c.deviceState.ValueMap[state.WaterPumpControl] = false
+		if c.deviceState.CancelTimer != nil {
+			c.deviceState.CancelTimer()
+			c.deviceState.CancelTimer = nil
+		}
+	}
+	c.deviceState.Mutex.Unlock()
+
+	if running {
+		metrics.SetActuatorState(string(state.WaterPumpControl), false)
+		c.recorder.Switch(runDeviceID, state.WaterPumpControl, false, source)
+		c.finish()
+	}
+	return running
+}
+
+func (c *PumpController) finish() {
+	var log = logger.Logger()
+
+	run, ok := c.pumpState.Finish(time.Now())
+	if !ok {
+		return
+	}
+	runEntity := dao.PumpRunEntity{Run: run}
+	if err := runEntity.Update(); err != nil {
+		log.Errorf("[ERROR] util.PumpController.finish | failed to update pump run entity: %s", err.Error())
+	}
+	metrics.WaterDeliveredTotal.Add(run.DeliveredML, run.DeviceID)
+}
+
+// checkInterlocks must be called with the device state locked.
+func (c *PumpController) checkInterlocks(run state.PumpRun, running bool) *PumpInterlockError {
+	cfg := c.controlConfig
+	now, duration := run.Start, run.Duration
+
+	if c.loopState.Get(state.LoopMoisture).Mode == state.LoopModeOff {
+		return &PumpInterlockError{state.PumpLoopOff, "moisture loop is switched off"}
+	}
+	if duration > cfg.WaterPumpMaxRun {
+		return &PumpInterlockError{state.PumpRunTooLong,
+			fmt.Sprintf("requested run of %s exceeds the maximum of %s", duration, cfg.WaterPumpMaxRun)}
+	}
+	if running {
+		return &PumpInterlockError{state.PumpAlreadyRunning, "pump is already running"}
+	}
+	if c.pumpState.TankLow(run.DeviceID) {
+		return &PumpInterlockError{state.PumpTankLow, fmt.Sprintf("tank level sensor of device %s reports low water", run.DeviceID)}
+	}
+	// a recipe may lower the configured ceiling but never raise it
+	modelStateMap := c.modelState.GetAll()
+	ceiling := cfg.WaterPumpMoistureCeiling
+	if recipeMax, ok := modelStateMap[state.MoistureMax]; ok {
+		ceiling = math.Min(recipeMax, cfg.WaterPumpMoistureCeiling)
+	}
+	if moisture, ok := modelStateMap[state.MoisturePV]; ok && moisture >= ceiling {
+		return &PumpInterlockError{state.PumpMoistureCeiling,
+			fmt.Sprintf("moisture %.1f%% is at or above the ceiling of %.1f%%", moisture, ceiling)}
+	}
+	if last, ok := c.pumpState.LastRun(); ok {
+		if offTime := now.Sub(last.End()); offTime < cfg.WaterPumpMinOffTime {
+			return &PumpInterlockError{state.PumpMinOffTime,
+				fmt.Sprintf("pump was off for %s, minimum off-time is %s", offTime.Round(time.Second), cfg.WaterPumpMinOffTime)}
+		}
+	}
+	runtime := c.pumpState.RuntimeSince(now.Add(-state.PumpRuntimeWindow))
+	if runtime+duration > cfg.WaterPumpMaxDailyRuntime {
+		return &PumpInterlockError{state.PumpDailyRuntime,
+			fmt.Sprintf("pump ran %s in the last 24 h, another %s exceeds the limit of %s",
+				runtime.Round(time.Second), duration, cfg.WaterPumpMaxDailyRuntime)}
+	}
+	return nil
+}
+
+func (c *PumpController) raiseAlarm(interlockErr *PumpInterlockError) {
+	var log = logger.Logger()
+	log.Warnf("[WARN] util.PumpController | pump run refused | %s", interlockErr.Error())
+	metrics.PumpRefusalsTotal.Inc(string(interlockErr.Code))
+
+	alarm := dao.AlarmEntity{Source: string(state.WaterPumpControl), Code: string(interlockErr.Code), Message: interlockErr.Message}
+	if err := alarm.Commit(); err != nil {
+		log.Errorf("[ERROR] util.PumpController | failed to commit alarm entity: %s", err.Error())
+	}
+}
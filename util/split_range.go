@@ -0,0 +1,14 @@
+package util
+
+// SplitRange maps the controller output onto a heating and a cooling duty in
+// percent: positive outputs scale from 0 to coMax for heating, negative
+// outputs from 0 to coMin for cooling. Both duties are capped by their limits.
+func SplitRange(co float64, coMin float64, coMax float64, heaterMax float64, coolerMax float64) (heating float64, cooling float64) {
+	if co > 0 && coMax > 0 {
+		heating = Clamp(co/coMax*100, 0, heaterMax)
+	}
+	if co < 0 && coMin < 0 {
+		cooling = Clamp(co/coMin*100, 0, coolerMax)
+	}
+	return heating, cooling
+}